@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+type userRelation struct {
+	UserId    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// errBlocked is returned by a relation change that a block between the two users rules out
+var errBlocked = errors.New("there is a block between you and this user")
+
+func (cfg *apiConfig) usersBlockHandler(w http.ResponseWriter, r *http.Request) {
+	//blocks a user and drops any follows between the two of you
+	cfg.setRelation(w, r, "block", func(ctx context.Context, callerID, userID uuid.UUID) error {
+		err := cfg.db.BlockUser(ctx, database.BlockUserParams{
+			BlockerID: callerID,
+			BlockedID: userID,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		err = cfg.db.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: callerID, FolloweeID: userID})
+		if err != nil {
+			return err
+		}
+		return cfg.db.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: userID, FolloweeID: callerID})
+	})
+}
+
+func (cfg *apiConfig) usersUnblockHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setRelation(w, r, "unblock", func(ctx context.Context, callerID, userID uuid.UUID) error {
+		return cfg.db.UnblockUser(ctx, database.UnblockUserParams{
+			BlockerID: callerID,
+			BlockedID: userID,
+		})
+	})
+}
+
+func (cfg *apiConfig) usersMuteHandler(w http.ResponseWriter, r *http.Request) {
+	//mutes a user, their chirps stop showing up in your listings but nothing else changes
+	cfg.setRelation(w, r, "mute", func(ctx context.Context, callerID, userID uuid.UUID) error {
+		return cfg.db.MuteUser(ctx, database.MuteUserParams{
+			MuterID:   callerID,
+			MutedID:   userID,
+			CreatedAt: time.Now(),
+		})
+	})
+}
+
+func (cfg *apiConfig) usersUnmuteHandler(w http.ResponseWriter, r *http.Request) {
+	cfg.setRelation(w, r, "unmute", func(ctx context.Context, callerID, userID uuid.UUID) error {
+		return cfg.db.UnmuteUser(ctx, database.UnmuteUserParams{
+			MuterID: callerID,
+			MutedID: userID,
+		})
+	})
+}
+
+func (cfg *apiConfig) blocksListHandler(w http.ResponseWriter, r *http.Request) {
+	//the users the caller has blocked, most recent first
+	cfg.listOwnRelations(w, r, func(ctx context.Context, callerID uuid.UUID, page pageRequest) ([]userRelation, error) {
+		blocks, err := cfg.db.ListBlocks(ctx, database.ListBlocksParams{
+			BlockerID:       callerID,
+			BeforeCreatedAt: page.Cursor.CreatedAt,
+			BeforeUserID:    page.Cursor.ID,
+			Limit:           fetchLimit(page.Limit),
+		})
+		relations := make([]userRelation, 0, len(blocks))
+		for _, block := range blocks {
+			relations = append(relations, userRelation{UserId: block.BlockedID, CreatedAt: block.CreatedAt})
+		}
+		return relations, err
+	})
+}
+
+func (cfg *apiConfig) mutesListHandler(w http.ResponseWriter, r *http.Request) {
+	//the users the caller has muted, most recent first
+	cfg.listOwnRelations(w, r, func(ctx context.Context, callerID uuid.UUID, page pageRequest) ([]userRelation, error) {
+		mutes, err := cfg.db.ListMutes(ctx, database.ListMutesParams{
+			MuterID:         callerID,
+			BeforeCreatedAt: page.Cursor.CreatedAt,
+			BeforeUserID:    page.Cursor.ID,
+			Limit:           fetchLimit(page.Limit),
+		})
+		relations := make([]userRelation, 0, len(mutes))
+		for _, mute := range mutes {
+			relations = append(relations, userRelation{UserId: mute.MutedID, CreatedAt: mute.CreatedAt})
+		}
+		return relations, err
+	})
+}
+
+// listOwnRelations pages through the caller's blocks or mutes, which only they get to see
+func (cfg *apiConfig) listOwnRelations(w http.ResponseWriter, r *http.Request, list func(ctx context.Context, callerID uuid.UUID, page pageRequest) ([]userRelation, error)) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return
+	}
+	validatedUserID, err := cfg.validateToken(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return
+	}
+	page, err := parseNewestFirstPage(r.URL.Query())
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing page: %v", err), http.StatusBadRequest)
+		return
+	}
+	relations, err := list(context.Background(), validatedUserID, page)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting users: %v", err))
+		return
+	}
+	if len(relations) > page.Limit {
+		relations = relations[:page.Limit]
+		last := relations[len(relations)-1]
+		setNextLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.UserId}.encode())
+	}
+
+	jsonResp, err := json.Marshal(relations)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing users: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
+
+// allowInteraction stops a user from replying to, quoting, liking or rechirping
+// a chirp whose author has blocked them. on failure the error response has already been written
+func (cfg *apiConfig) allowInteraction(w http.ResponseWriter, ctx context.Context, userID uuid.UUID, target database.Chirp) bool {
+	blocked, err := cfg.db.IsBlocked(ctx, database.IsBlockedParams{
+		BlockerID: target.UserID,
+		BlockedID: userID,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error checking blocks: %v", err))
+		return false
+	}
+	if blocked {
+		errHandler(w, fmt.Errorf("you have been blocked by this chirp's author"), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// filterVisible drops the chirps a viewer shouldn't see: anything written by
+// someone on either side of a block with them, plus anyone they muted when
+// hideMuted is set. rechirps and quotes are judged by the original's author too
+func (cfg *apiConfig) filterVisible(ctx context.Context, viewer uuid.NullUUID, chirps []database.Chirp, hideMuted bool) ([]database.Chirp, error) {
+	if !viewer.Valid || len(chirps) == 0 {
+		return chirps, nil
+	}
+	authorIDs := make([]uuid.UUID, 0, len(chirps))
+	var originalIDs []uuid.UUID
+	for _, chrp := range chirps {
+		authorIDs = append(authorIDs, chrp.UserID)
+		if original := repostOf(chrp); original.Valid {
+			originalIDs = append(originalIDs, original.UUID)
+		}
+	}
+	originalAuthors := map[uuid.UUID]uuid.UUID{}
+	if len(originalIDs) > 0 {
+		originals, err := cfg.db.GetChirpsByIds(ctx, originalIDs)
+		if err != nil {
+			return nil, fmt.Errorf("error getting original chirps: %w", err)
+		}
+		for _, original := range originals {
+			originalAuthors[original.ID] = original.UserID
+			authorIDs = append(authorIDs, original.UserID)
+		}
+	}
+
+	hidden := map[uuid.UUID]bool{}
+	blocked, err := cfg.db.GetBlockedBetween(ctx, database.GetBlockedBetweenParams{
+		UserID:  viewer.UUID,
+		UserIds: authorIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting blocks: %w", err)
+	}
+	for _, id := range blocked {
+		hidden[id] = true
+	}
+	if hideMuted {
+		muted, err := cfg.db.GetMutedAmong(ctx, database.GetMutedAmongParams{
+			MuterID: viewer.UUID,
+			UserIds: authorIDs,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting mutes: %w", err)
+		}
+		for _, id := range muted {
+			hidden[id] = true
+		}
+	}
+	if len(hidden) == 0 {
+		return chirps, nil
+	}
+
+	visible := make([]database.Chirp, 0, len(chirps))
+	for _, chrp := range chirps {
+		if hidden[chrp.UserID] {
+			continue
+		}
+		if original := repostOf(chrp); original.Valid && hidden[originalAuthors[original.UUID]] {
+			continue
+		}
+		visible = append(visible, chrp)
+	}
+	return visible, nil
+}
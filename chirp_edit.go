@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+type chirpRevision struct {
+	Id         uuid.UUID `json:"id"`
+	ChirpId    uuid.UUID `json:"chirp_id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+
+func (cfg *apiConfig) chirpsPutHandler(w http.ResponseWriter, r *http.Request) {
+	//edits a chirp's body
+	//same ownership rules as deleting, the old body is kept in the chirp's history
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, _ := uuid.Parse(chirpID)
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return
+	}
+	validatedUserID, scopes, err := cfg.authorize(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return
+	}
+	if !requireScope(w, scopes, auth.ScopeChirpsWrite) {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	parameter := chirp{}
+	err = decoder.Decode(&parameter)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing chirp info: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(parameter.Body) > maxChirpLength {
+		errHandler(w, fmt.Errorf("chirp is too long"), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	chirpData, err := cfg.db.GetChirpById(ctx, chirpUUID)
+	if errors.Is(err, sql.ErrNoRows) || chirpData.DeletedAt.Valid {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return
+	}
+	if chirpData.UserID != validatedUserID {
+		errHandler(w, fmt.Errorf("unauthorized to edit chirp"), http.StatusForbidden)
+		return
+	}
+	if chirpData.RechirpOf.Valid {
+		errHandler(w, fmt.Errorf("rechirps have no body to edit"), http.StatusBadRequest)
+		return
+	}
+	updated, err := cfg.db.EditChirp(ctx, database.EditChirpParams{
+		RevisionID: uuid.New(),
+		UpdatedAt:  time.Now(),
+		ID:         chirpUUID,
+		Body:       profanityFilter(parameter.Body),
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error editing chirp: %v", err))
+		return
+	}
+	respChirps, err := cfg.chirpViews(ctx, uuid.NullUUID{UUID: validatedUserID, Valid: true}, []database.Chirp{updated})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error editing chirp: %v", err))
+		return
+	}
+
+	resp, _ := json.Marshal(respChirps[0])
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) chirpsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	//lists the earlier versions of a chirp, oldest first
+	//someone on either side of a block with the author gets a 404, same as the chirp itself
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, _ := uuid.Parse(chirpID)
+	ctx := context.Background()
+	chirpData, err := cfg.db.GetChirpById(ctx, chirpUUID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err), http.StatusNotFound)
+		return
+	}
+	if chirpData.DeletedAt.Valid {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	visible, err := cfg.filterVisible(ctx, cfg.viewerID(r), []database.Chirp{chirpData}, false)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return
+	}
+	if len(visible) == 0 {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	revisions, err := cfg.db.GetChirpRevisions(ctx, chirpUUID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp history: %v", err))
+		return
+	}
+	history := []chirpRevision{}
+	for _, revision := range revisions {
+		history = append(history, chirpRevision{
+			Id:         revision.ID,
+			ChirpId:    revision.ChirpID,
+			Body:       revision.Body,
+			CreatedAt:  revision.CreatedAt,
+			ReplacedAt: revision.ReplacedAt,
+		})
+	}
+	jsonResp, err := json.Marshal(history)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing chirp history: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
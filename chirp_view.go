@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// chirpFromDB maps a chirps row to its json shape
+// a deleted chirp is a tombstone that only keeps its place in a thread
+func chirpFromDB(chrp database.Chirp) chirp {
+	parsedChirp := chirp{}
+	parsedChirp.Id = chrp.ID
+	parsedChirp.CreatedAt = chrp.CreatedAt
+	parsedChirp.UpdatedAt = chrp.UpdatedAt
+	parsedChirp.Body = chrp.Body
+	parsedChirp.UserId = chrp.UserID
+	parsedChirp.InReplyTo = nullableID(chrp.InReplyTo)
+	parsedChirp.RechirpOf = nullableID(chrp.RechirpOf)
+	parsedChirp.QuoteOf = nullableID(chrp.QuoteOf)
+	parsedChirp.Deleted = chrp.DeletedAt.Valid
+	return parsedChirp
+}
+
+func nullableID(id uuid.NullUUID) *uuid.UUID {
+	if !id.Valid {
+		return nil
+	}
+	return &id.UUID
+}
+
+// repostOf is the chirp a rechirp or quote points at
+func repostOf(chrp database.Chirp) uuid.NullUUID {
+	if chrp.RechirpOf.Valid {
+		return chrp.RechirpOf
+	}
+	return chrp.QuoteOf
+}
+
+// viewerID is the user behind an optional bearer token, used for the
+// per-viewer fields like liked_by_me. a missing or bad token just
+// means the chirps are seen anonymously
+func (cfg *apiConfig) viewerID(r *http.Request) uuid.NullUUID {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	userID, err := cfg.validateToken(token)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: userID, Valid: true}
+}
+
+// chirpViews maps a page of chirps, embeds the originals of any
+// rechirps and quotes, and fills in the counts that live in other
+// rows, using one query per count for the whole page
+func (cfg *apiConfig) chirpViews(ctx context.Context, viewer uuid.NullUUID, chirps []database.Chirp) ([]chirp, error) {
+	views := make([]chirp, 0, len(chirps))
+	var originalIDs []uuid.UUID
+	for _, chrp := range chirps {
+		views = append(views, chirpFromDB(chrp))
+		if original := repostOf(chrp); original.Valid {
+			originalIDs = append(originalIDs, original.UUID)
+		}
+	}
+	targets := make([]*chirp, 0, len(views)+len(originalIDs))
+	for idx := range views {
+		targets = append(targets, &views[idx])
+	}
+	originals := map[uuid.UUID]*chirp{}
+	if len(originalIDs) > 0 {
+		rows, err := cfg.db.GetChirpsByIds(ctx, originalIDs)
+		if err != nil {
+			return nil, fmt.Errorf("error getting original chirps: %w", err)
+		}
+		for _, row := range rows {
+			original := chirpFromDB(row)
+			originals[row.ID] = &original
+			targets = append(targets, &original)
+		}
+	}
+	if err := cfg.fillCounts(ctx, viewer, targets); err != nil {
+		return nil, err
+	}
+	for idx, chrp := range chirps {
+		if original := repostOf(chrp); original.Valid {
+			views[idx].Original = originals[original.UUID]
+		}
+	}
+	return views, nil
+}
+
+// listingViews is chirpViews for chirp listings. it first drops the chirps
+// from anyone the viewer has blocked, been blocked by or muted, so every
+// endpoint that lists chirps should go through here
+func (cfg *apiConfig) listingViews(ctx context.Context, viewer uuid.NullUUID, chirps []database.Chirp) ([]chirp, error) {
+	visible, err := cfg.filterVisible(ctx, viewer, chirps, true)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.chirpViews(ctx, viewer, visible)
+}
+
+func (cfg *apiConfig) fillCounts(ctx context.Context, viewer uuid.NullUUID, targets []*chirp) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, 0, len(targets))
+	for _, target := range targets {
+		ids = append(ids, target.Id)
+	}
+	replyRows, err := cfg.db.CountReplies(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("error counting replies: %w", err)
+	}
+	replies := map[uuid.UUID]int64{}
+	for _, row := range replyRows {
+		replies[row.InReplyTo.UUID] = row.ReplyCount
+	}
+	rechirpRows, err := cfg.db.CountRechirps(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("error counting rechirps: %w", err)
+	}
+	rechirps := map[uuid.UUID]int64{}
+	for _, row := range rechirpRows {
+		rechirps[row.RechirpOf.UUID] = row.RechirpCount
+	}
+	quoteRows, err := cfg.db.CountQuotes(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("error counting quotes: %w", err)
+	}
+	quotes := map[uuid.UUID]int64{}
+	for _, row := range quoteRows {
+		quotes[row.QuoteOf.UUID] = row.QuoteCount
+	}
+	likeRows, err := cfg.db.CountLikes(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("error counting likes: %w", err)
+	}
+	likes := map[uuid.UUID]int64{}
+	for _, row := range likeRows {
+		likes[row.ChirpID] = row.LikeCount
+	}
+	likedByMe := map[uuid.UUID]bool{}
+	if viewer.Valid {
+		liked, err := cfg.db.GetLikedChirpIds(ctx, database.GetLikedChirpIdsParams{
+			UserID:   viewer.UUID,
+			ChirpIds: ids,
+		})
+		if err != nil {
+			return fmt.Errorf("error getting likes: %w", err)
+		}
+		for _, id := range liked {
+			likedByMe[id] = true
+		}
+	}
+	for _, target := range targets {
+		target.ReplyCount = replies[target.Id]
+		target.RechirpCount = rechirps[target.Id]
+		target.QuoteCount = quotes[target.Id]
+		target.LikeCount = likes[target.Id]
+		target.LikedByMe = likedByMe[target.Id]
+	}
+	return nil
+}
+
+// originalChirp resolves a chirp id for replying, quoting or rechirping,
+// following a rechirp through to the chirp it reposts
+func (cfg *apiConfig) originalChirp(ctx context.Context, chirpUUID uuid.UUID) (database.Chirp, error) {
+	chrp, err := cfg.db.GetChirpById(ctx, chirpUUID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if chrp.RechirpOf.Valid {
+		chrp, err = cfg.db.GetChirpById(ctx, chrp.RechirpOf.UUID)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+	if chrp.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chrp, nil
+}
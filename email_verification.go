@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+	"github.com/joncaudill/chirpy/internal/mailer"
+)
+
+// how long an email verification token stays usable
+const emailVerificationTTL = 24 * time.Hour
+
+// a user has to wait this long between verification emails
+const verificationResendInterval = time.Minute
+
+type emailVerification struct {
+	Token string `json:"token"`
+}
+
+// sendVerification mails a new verification token for email to the user
+func (cfg *apiConfig) sendVerification(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := auth.MakeSecretToken()
+	if err != nil {
+		return fmt.Errorf("error creating verification token: %w", err)
+	}
+	timeNow := time.Now()
+	err = cfg.db.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		CreatedAt: timeNow,
+		ExpiresAt: timeNow.Add(emailVerificationTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating verification token: %w", err)
+	}
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your chirpy email",
+		Body: fmt.Sprintf("Thanks for signing up for chirpy.\n\n"+
+			"Your verification token is %s\n\n"+
+			"It expires in %s.", token, emailVerificationTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("error sending verification email: %w", err)
+	}
+	return nil
+}
+
+// sendVerificationOrLog is for signups and email changes, where a mail
+// that didn't go out shouldn't fail the request since it can be resent
+func (cfg *apiConfig) sendVerificationOrLog(ctx context.Context, userID uuid.UUID, email string) {
+	if err := cfg.sendVerification(ctx, userID, email); err != nil {
+		log.Printf("error sending verification to user %s: %v", userID, err)
+	}
+}
+
+// allowPosting stops users with an unverified email from creating chirps when
+// REQUIRE_EMAIL_VERIFICATION is on. on failure the error response has already been written
+func (cfg *apiConfig) allowPosting(w http.ResponseWriter, ctx context.Context, userID uuid.UUID) bool {
+	if !cfg.requireVerifiedEmail {
+		return true
+	}
+	user, err := cfg.db.GetUserById(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		errHandler(w, fmt.Errorf("verify your email before posting"), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	//marks a user's email verified given a token from a verification email
+	verification := emailVerification{}
+	err := json.NewDecoder(r.Body).Decode(&verification)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing verification: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	consumed, err := cfg.db.ConsumeEmailVerification(ctx, database.ConsumeEmailVerificationParams{
+		TokenHash: auth.HashToken(verification.Token),
+		Now:       time.Now(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("invalid or expired verification token"), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error checking verification token: %v", err))
+		return
+	}
+	verified, err := cfg.db.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{
+		VerifiedAt: time.Now(),
+		ID:         consumed.UserID,
+		Email:      consumed.Email,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error verifying email: %v", err))
+		return
+	}
+	if verified == 0 {
+		errHandler(w, fmt.Errorf("verification token is for an email you no longer use"), http.StatusBadRequest)
+		return
+	}
+	err = cfg.db.DeleteUserEmailVerifications(ctx, consumed.UserID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error clearing verification tokens: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) resendVerification(w http.ResponseWriter, r *http.Request) {
+	//sends the caller another verification email, at most once every verificationResendInterval
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return
+	}
+	userID, err := cfg.validateToken(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return
+	}
+	ctx := context.Background()
+	user, err := cfg.db.GetUserById(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		errHandler(w, fmt.Errorf("email is already verified"), http.StatusConflict)
+		return
+	}
+	latest, err := cfg.db.GetLatestEmailVerification(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("error checking verifications: %v", err))
+		return
+	}
+	if wait := verificationResendInterval - time.Since(latest); err == nil && wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		errHandler(w, fmt.Errorf("wait before asking for another verification email"), http.StatusTooManyRequests)
+		return
+	}
+	err = cfg.sendVerification(ctx, userID, user.Email)
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
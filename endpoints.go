@@ -4,15 +4,18 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/joncaudill/chirpy/internal/auth"
 	"github.com/joncaudill/chirpy/internal/database"
+	"github.com/joncaudill/chirpy/internal/mailer"
 )
 
 func healthzHandler(w http.ResponseWriter, r *http.Request) {
@@ -21,6 +24,16 @@ func healthzHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK\n"))
 }
 
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	//the public keys access tokens are signed with, so other services can check them
+	//without holding anything secret
+	resp, _ := json.Marshal(cfg.jwtKeys.JWKS())
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
 func (cfg *apiConfig) getMetrics(w http.ResponseWriter, r *http.Request) {
 	numHits := cfg.fileserverHits.Load()
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -60,7 +73,7 @@ func (cfg *apiConfig) chirpsPostHandler(w http.ResponseWriter, r *http.Request)
 		errHandler(w, fmt.Errorf("error parsing chirp info: %v", err), http.StatusBadRequest)
 		return
 	}
-	if len(parameter.Body) > 140 {
+	if len(parameter.Body) > maxChirpLength {
 		errHandler(w, fmt.Errorf("chirp is too long"), http.StatusBadRequest)
 		return
 	}
@@ -73,27 +86,65 @@ func (cfg *apiConfig) chirpsPostHandler(w http.ResponseWriter, r *http.Request)
 		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
 		return
 	}
-	validatedUserID, err := auth.ValidateJWT(token, cfg.jwt_secret)
+	validatedUserID, scopes, err := cfg.authorize(token)
 	if err != nil {
-		errHandler(w, fmt.Errorf("error validating token: %v", err), http.StatusUnauthorized)
+		tokenErrHandler(w, err)
+		return
+	}
+	if !requireScope(w, scopes, auth.ScopeChirpsWrite) {
+		return
+	}
+
+	ctx := context.Background()
+	if !cfg.allowPosting(w, ctx, validatedUserID) {
 		return
 	}
+	//replies and quotes have to point at a chirp that still exists
+	inReplyTo := uuid.NullUUID{}
+	if parameter.InReplyTo != nil {
+		parent, err := cfg.originalChirp(ctx, *parameter.InReplyTo)
+		if err != nil {
+			errHandler(w, fmt.Errorf("chirp being replied to not found"), http.StatusBadRequest)
+			return
+		}
+		if !cfg.allowInteraction(w, ctx, validatedUserID, parent) {
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+	quoteOf := uuid.NullUUID{}
+	if parameter.QuoteOf != nil {
+		quoted, err := cfg.originalChirp(ctx, *parameter.QuoteOf)
+		if err != nil {
+			errHandler(w, fmt.Errorf("chirp being quoted not found"), http.StatusBadRequest)
+			return
+		}
+		if !cfg.allowInteraction(w, ctx, validatedUserID, quoted) {
+			return
+		}
+		quoteOf = uuid.NullUUID{UUID: quoted.ID, Valid: true}
+	}
 
-	respBody, _ := cfg.db.CreateChirp(context.Background(), database.CreateChirpParams{
+	respBody, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{
 		ID:        newid,
 		CreatedAt: timeNow,
 		UpdatedAt: timeNow,
 		Body:      cleaned,
 		UserID:    validatedUserID,
+		InReplyTo: inReplyTo,
+		QuoteOf:   quoteOf,
 	})
-	respChirp := chirp{}
-	respChirp.Id = respBody.ID
-	respChirp.CreatedAt = respBody.CreatedAt
-	respChirp.UpdatedAt = respBody.UpdatedAt
-	respChirp.Body = respBody.Body
-	respChirp.UserId = respBody.UserID
-
-	resp, _ := json.Marshal(respChirp)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error creating chirp: %v", err))
+		return
+	}
+	respChirps, err := cfg.chirpViews(ctx, uuid.NullUUID{UUID: validatedUserID, Valid: true}, []database.Chirp{respBody})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error creating chirp: %v", err))
+		return
+	}
+
+	resp, _ := json.Marshal(respChirps[0])
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusCreated)
 	w.Write(resp)
@@ -101,28 +152,57 @@ func (cfg *apiConfig) chirpsPostHandler(w http.ResponseWriter, r *http.Request)
 
 func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
-	partUser := AuthUser{}
+	partUser := userRequest{}
 	parameter := User{}
 	err := decoder.Decode(&partUser)
 	if err != nil {
 		errHandler(w, fmt.Errorf("error parsing user info: %v", err))
 		return
 	}
+	if err := validateEmail(partUser.Email); err != nil {
+		errHandler(w, err, http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	//hashed before the email is looked up so a signup for a taken email takes as long as a new one
 	hashedPassword, err := auth.HashPassword(partUser.Password)
 	if err != nil {
 		errHandler(w, fmt.Errorf("unable to hash password: %v", err))
 		return
 	}
-	ctx := context.Background()
+	//a signup without a handle gets a placeholder that can be changed later
+	newProfile, ok := cfg.applyProfile(w, ctx, uuid.Nil, profile{Handle: defaultHandle()}, partUser.profileFields)
+	if !ok {
+		return
+	}
+	existing, err := cfg.db.GetUserByEmail(ctx, partUser.Email)
+	if err == nil {
+		cfg.signupConflict(w, ctx, existing, newProfile)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("error checking email: %v", err))
+		return
+	}
 	newUser, err := cfg.db.CreateUser(ctx,
 		database.CreateUserParams{
 			Email:          partUser.Email,
 			HashedPassword: hashedPassword,
+			Handle:         newProfile.Handle,
+			DisplayName:    newProfile.DisplayName,
+			Bio:            newProfile.Bio,
 		})
 	if err != nil {
-		errHandler(w, fmt.Errorf("error creating user: %v", err))
+		//another signup for the same email got in first
+		if existing, lookupErr := cfg.db.GetUserByEmail(ctx, partUser.Email); lookupErr == nil {
+			cfg.signupConflict(w, ctx, existing, newProfile)
+			return
+		}
+		log.Printf("error creating user: %v", err)
+		errHandler(w, fmt.Errorf("error creating user"))
 		return
 	}
+	cfg.sendVerificationOrLog(ctx, newUser.ID, newUser.Email)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusCreated)
 	parameter.ID = newUser.ID
@@ -130,10 +210,53 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 	parameter.UpdatedAt = newUser.UpdatedAt
 	parameter.Email = newUser.Email
 	parameter.IsChirpyRed = newUser.IsChirpyRed
+	parameter.Handle = newUser.Handle
+	parameter.DisplayName = newUser.DisplayName
+	parameter.Bio = newUser.Bio
+	parameter.EmailVerified = newUser.EmailVerifiedAt.Valid
+	resp, _ := json.Marshal(parameter)
+	w.Write(resp)
+}
+
+// signupConflict answers a signup for an email that already has an account the way a
+// new signup is answered, and tells the owner instead, so signing up can't be used to
+// find out who has an account. nothing is created and the user in the response is made up
+func (cfg *apiConfig) signupConflict(w http.ResponseWriter, ctx context.Context, owner database.User, newProfile profile) {
+	err := cfg.mailer.Send(ctx, mailer.Message{
+		To:      owner.Email,
+		Subject: "Someone tried to sign up for chirpy with your email",
+		Body: "Someone tried to make a chirpy account with this email, but you already have one.\n\n" +
+			"If this was you, log in, or reset your password if you've forgotten it. " +
+			"If it wasn't, you can ignore this email.",
+	})
+	if err != nil {
+		log.Printf("error sending signup notice to user %s: %v", owner.ID, err)
+	}
+	timeNow := time.Now()
+	parameter := User{
+		ID:          uuid.New(),
+		Email:       owner.Email,
+		CreatedAt:   timeNow,
+		UpdatedAt:   timeNow,
+		Handle:      newProfile.Handle,
+		DisplayName: newProfile.DisplayName,
+		Bio:         newProfile.Bio,
+	}
 	resp, _ := json.Marshal(parameter)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
 	w.Write(resp)
 }
 
+// dummyPasswordHash is checked in place of a user's hash when a login's email has no account
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := auth.HashPassword("not a real password")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
 func (cfg *apiConfig) loginUser(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	partUser := AuthUser{}
@@ -145,40 +268,53 @@ func (cfg *apiConfig) loginUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := context.Background()
-	user, err := cfg.db.GetUserByEmail(ctx, partUser.Email)
+	ip := clientIP(r)
+	locked, err := cfg.loginLocked(ctx, partUser.Email, ip)
 	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	user, err := cfg.db.GetUserByEmail(ctx, partUser.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		errHandler(w, fmt.Errorf("error getting user: %v", err))
 		return
 	}
+	//an unknown email, a wrong password and a locked out login all do the same
+	//bcrypt work and get the same answer, so none of them say whether the account exists
+	hashedPassword := user.HashedPassword
 	if user.ID == uuid.Nil {
-		errHandler(w, fmt.Errorf("user not found"), http.StatusNotFound)
+		hashedPassword = dummyPasswordHash()
+	}
+	validated := auth.CheckPasswordHash(partUser.Password, hashedPassword) && user.ID != uuid.Nil
+	if locked {
+		loginFailed(w)
 		return
 	}
-	validated := auth.CheckPasswordHash(partUser.Password, user.HashedPassword)
 	if !validated {
-		errHandler(w, fmt.Errorf("incorrect email or password"), http.StatusUnauthorized)
+		if err := cfg.recordLoginFailure(ctx, partUser.Email, ip); err != nil {
+			errHandler(w, err)
+			return
+		}
+		loginFailed(w)
 		return
 	}
-	token, err := auth.MakeJWT(user.ID, cfg.jwt_secret, time.Hour)
+	//with 2FA on the password only gets a challenge, tokens come from /api/login/2fa
+	challenged, err := cfg.startLoginChallenge(ctx, w, user.ID)
 	if err != nil {
-		errHandler(w, fmt.Errorf("error creating token: %v", err))
+		errHandler(w, err)
 		return
 	}
-
-	refToken, err := auth.MakeRefreshToken()
+	if challenged {
+		return
+	}
+	err = cfg.clearLoginFailures(ctx, partUser.Email)
 	if err != nil {
-		errHandler(w, fmt.Errorf("error creating refresh token: %v", err))
+		errHandler(w, err)
 		return
 	}
-	_, err = cfg.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
-		UserID:    user.ID,
-		Token:     refToken,
-		CreatedAt: time.Now(),
-		ExpiresAt: time.Now().Add(time.Hour * 24 * 60),
-		RevokedAt: sql.NullTime{},
-	})
+	token, refToken, err := cfg.issueTokens(ctx, r, user.ID)
 	if err != nil {
-		errHandler(w, fmt.Errorf("error creating refresh token: %v", err))
+		errHandler(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -188,6 +324,10 @@ func (cfg *apiConfig) loginUser(w http.ResponseWriter, r *http.Request) {
 	parameter.UpdatedAt = user.UpdatedAt
 	parameter.Email = user.Email
 	parameter.IsChirpyRed = user.IsChirpyRed
+	parameter.Handle = user.Handle
+	parameter.DisplayName = user.DisplayName
+	parameter.Bio = user.Bio
+	parameter.EmailVerified = user.EmailVerifiedAt.Valid
 	parameter.TokenJWT = token
 	parameter.RefreshToken = refToken
 	resp, _ := json.Marshal(parameter)
@@ -195,43 +335,115 @@ func (cfg *apiConfig) loginUser(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// issueTokens makes a new access token and a refresh token that starts a new session
+func (cfg *apiConfig) issueTokens(ctx context.Context, r *http.Request, userID uuid.UUID) (string, string, error) {
+	token, err := cfg.jwtKeys.MakeJWT(userID, time.Hour, auth.AllScopes...)
+	if err != nil {
+		return "", "", fmt.Errorf("error creating token: %v", err)
+	}
+	refToken, err := cfg.storeRefreshToken(ctx, r, userID, uuid.New(), uuid.NullUUID{}, auth.AllScopes)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refToken, nil
+}
+
+// storeRefreshToken makes a refresh token in the given family, only its hash is saved
+// along with the device the request came from, the OAuth client it was issued to if any,
+// and the scopes the access tokens it is swapped for get
+func (cfg *apiConfig) storeRefreshToken(ctx context.Context, r *http.Request, userID, familyID uuid.UUID, clientID uuid.NullUUID, scopes []string) (string, error) {
+	refToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", fmt.Errorf("error creating refresh token: %v", err)
+	}
+	timeNow := time.Now()
+	_, err = cfg.db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		TokenHash:  auth.HashToken(refToken),
+		CreatedAt:  timeNow,
+		UpdatedAt:  timeNow,
+		UserID:     userID,
+		ExpiresAt:  timeNow.Add(time.Hour * 24 * 60),
+		RevokedAt:  sql.NullTime{},
+		FamilyID:   familyID,
+		UserAgent:  r.UserAgent(),
+		Ip:         clientIP(r),
+		LastUsedAt: timeNow,
+		ClientID:   clientID,
+		Scopes:     auth.JoinScopes(scopes),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating refresh token: %v", err)
+	}
+	return refToken, nil
+}
+
 func (cfg *apiConfig) chirpsGetHandler(w http.ResponseWriter, r *http.Request) {
 	//get the author_id query parameter
-	//if it doesn't exist, get all chirps
-	//if it does, get chirps by author with user_id
+	//if it doesn't exist, page through all chirps
+	//if it does, page through chirps by author with user_id
+	//limit, cursor and sort=asc|desc pick the page, the sorting happens in sql
 	qauthor := r.URL.Query().Get("author_id")
-	qsort := r.URL.Query().Get("sort")
-	var chirps []database.Chirp
-	var err1 error
-	if qauthor == "" {
-		chirps, err1 = cfg.db.GetAllChirps(context.Background())
-	} else {
-		authorID, err := uuid.Parse(qauthor)
+	page, err := parsePageRequest(r.URL.Query())
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing page: %v", err), http.StatusBadRequest)
+		return
+	}
+	var authorID uuid.UUID
+	if qauthor != "" {
+		authorID, err = uuid.Parse(qauthor)
 		if err != nil {
 			errHandler(w, fmt.Errorf("error parsing author ID: %v", err))
 			return
 		}
-		chirps, err1 = cfg.db.GetChirpsByUserId(context.Background(), authorID)
+	}
+	var chirps []database.Chirp
+	var err1 error
+	ctx := context.Background()
+	switch {
+	case qauthor == "" && !page.Desc:
+		chirps, err1 = cfg.db.ListChirpsAsc(ctx, database.ListChirpsAscParams{
+			AfterCreatedAt: page.Cursor.CreatedAt,
+			AfterID:        page.Cursor.ID,
+			Limit:          fetchLimit(page.Limit),
+		})
+	case qauthor == "" && page.Desc:
+		chirps, err1 = cfg.db.ListChirpsDesc(ctx, database.ListChirpsDescParams{
+			BeforeCreatedAt: page.Cursor.CreatedAt,
+			BeforeID:        page.Cursor.ID,
+			Limit:           fetchLimit(page.Limit),
+		})
+	case !page.Desc:
+		chirps, err1 = cfg.db.ListChirpsByUserAsc(ctx, database.ListChirpsByUserAscParams{
+			UserID:         authorID,
+			AfterCreatedAt: page.Cursor.CreatedAt,
+			AfterID:        page.Cursor.ID,
+			Limit:          fetchLimit(page.Limit),
+		})
+	default:
+		chirps, err1 = cfg.db.ListChirpsByUserDesc(ctx, database.ListChirpsByUserDescParams{
+			UserID:          authorID,
+			BeforeCreatedAt: page.Cursor.CreatedAt,
+			BeforeID:        page.Cursor.ID,
+			Limit:           fetchLimit(page.Limit),
+		})
 	}
 	if err1 != nil {
 		errHandler(w, fmt.Errorf("error getting chirps: %v", err1))
 		return
 	}
-	if qsort == "desc" {
-		sort.Slice(chirps, func(i, j int) bool {
-			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
-		})
+	if len(chirps) > page.Limit {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		setNextLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode())
 	}
-	chirpsResp := []chirp{}
-	for _, chrp := range chirps {
-		parsedChirp := chirp{}
-		parsedChirp.Id = chrp.ID
-		parsedChirp.CreatedAt = chrp.CreatedAt
-		parsedChirp.UpdatedAt = chrp.UpdatedAt
-		parsedChirp.Body = chrp.Body
-		parsedChirp.UserId = chrp.UserID
-		//jsonChirp, _ := json.Marshal(parsedChirp)
-		chirpsResp = append(chirpsResp, parsedChirp)
+	chirpsResp, err := cfg.listingViews(ctx, cfg.viewerID(r), chirps)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirps: %v", err))
+		return
+	}
+	if err := cfg.embedAuthors(ctx, r, chirpsResp); err != nil {
+		errHandler(w, fmt.Errorf("error getting chirps: %v", err))
+		return
 	}
 
 	jsonResp, err := json.Marshal(chirpsResp)
@@ -249,23 +461,37 @@ func (cfg *apiConfig) chirpsGetHandler(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) chirpsGetOneHandler(w http.ResponseWriter, r *http.Request) {
 	chirpID := r.PathValue("chirpID")
 	chirpUUID, _ := uuid.Parse(chirpID)
-	chirpData, err := cfg.db.GetChirpById(context.Background(), chirpUUID)
+	ctx := context.Background()
+	chirpData, err := cfg.db.GetChirpById(ctx, chirpUUID)
 	if err != nil {
 		errHandler(w, fmt.Errorf("error getting chirp: %v", err), http.StatusNotFound)
 		return
 	}
-	if chirpData.ID == uuid.Nil {
+	if chirpData.ID == uuid.Nil || chirpData.DeletedAt.Valid {
 		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
 		return
 	}
-	respChirp := chirp{}
-	respChirp.Id = chirpData.ID
-	respChirp.CreatedAt = chirpData.CreatedAt
-	respChirp.UpdatedAt = chirpData.UpdatedAt
-	respChirp.Body = chirpData.Body
-	respChirp.UserId = chirpData.UserID
+	viewer := cfg.viewerID(r)
+	visible, err := cfg.filterVisible(ctx, viewer, []database.Chirp{chirpData}, false)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return
+	}
+	if len(visible) == 0 {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	respChirps, err := cfg.chirpViews(ctx, viewer, visible)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return
+	}
+	if err := cfg.embedAuthors(ctx, r, respChirps); err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return
+	}
 
-	jsonResp, err := json.Marshal(respChirp)
+	jsonResp, err := json.Marshal(respChirps[0])
 	if err != nil {
 		errHandler(w, fmt.Errorf("error parsing chirp: %v", err))
 		return
@@ -279,78 +505,118 @@ func (cfg *apiConfig) chirpsGetOneHandler(w http.ResponseWriter, r *http.Request
 func (cfg *apiConfig) chirpsDeleteOneHandler(w http.ResponseWriter, r *http.Request) {
 	chirpID := r.PathValue("chirpID")
 	chirpUUID, _ := uuid.Parse(chirpID)
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+	_, ok := cfg.authorizeChirpOwner(w, r, chirpUUID, "delete")
+	if !ok {
 		return
 	}
-	validatedUserID, err := auth.ValidateJWT(token, cfg.jwt_secret)
+	err := cfg.removeChirp(context.Background(), chirpUUID)
 	if err != nil {
-		errHandler(w, fmt.Errorf("error validating token: %v", err), http.StatusUnauthorized)
+		errHandler(w, fmt.Errorf("error deleting chirp: %v", err))
 		return
 	}
-	ctx := context.Background()
-	chirpData, err := cfg.db.GetChirpById(ctx, chirpUUID)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeChirpOwner looks up a live chirp and checks the bearer token belongs to its author
+// and can write chirps. on failure the error response has already been written
+func (cfg *apiConfig) authorizeChirpOwner(w http.ResponseWriter, r *http.Request, chirpUUID uuid.UUID, action string) (database.Chirp, bool) {
+	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
-		return
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return database.Chirp{}, false
+	}
+	validatedUserID, scopes, err := cfg.authorize(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return database.Chirp{}, false
 	}
-	if chirpData.ID == uuid.Nil {
+	if !requireScope(w, scopes, auth.ScopeChirpsWrite) {
+		return database.Chirp{}, false
+	}
+	chirpData, err := cfg.db.GetChirpById(context.Background(), chirpUUID)
+	if errors.Is(err, sql.ErrNoRows) || chirpData.DeletedAt.Valid {
 		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
-		return
+		return database.Chirp{}, false
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return database.Chirp{}, false
 	}
 	if chirpData.UserID != validatedUserID {
-		errHandler(w, fmt.Errorf("unauthorized to delete chirp"), http.StatusForbidden)
-		return
+		errHandler(w, fmt.Errorf("unauthorized to %s chirp", action), http.StatusForbidden)
+		return database.Chirp{}, false
 	}
-	err = cfg.db.DeleteChirp(ctx, chirpUUID)
+	return chirpData, true
+}
+
+// removeChirp deletes a chirp, leaving a tombstone behind when
+// replies or quotes still point at it so they keep their shape
+func (cfg *apiConfig) removeChirp(ctx context.Context, chirpUUID uuid.UUID) error {
+	tombstoned, err := cfg.db.TombstoneChirp(ctx, database.TombstoneChirpParams{
+		DeletedAt: sql.NullTime{Time: time.Now(), Valid: true},
+		ID:        chirpUUID,
+	})
 	if err != nil {
-		errHandler(w, fmt.Errorf("error deleting chirp: %v", err))
-		return
+		return err
 	}
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusNoContent)
+	if tombstoned == 0 {
+		return cfg.db.DeleteChirp(ctx, chirpUUID)
+	}
+	return nil
 }
 
 func (cfg *apiConfig) updateJWTToken(w http.ResponseWriter, r *http.Request) {
-	//updates the JWT token
-	//must have a valid refresh token in header
+	//swaps a refresh token for a new JWT token and a new refresh token
+	//must have a valid refresh token in header, it can't be used again afterwards
 	bearerToken := r.Header.Get("Authorization")
 	if len(bearerToken) < 7 || bearerToken[:7] != "Bearer " {
 		errHandler(w, fmt.Errorf("invalid authorization header"), http.StatusUnauthorized)
 		return
 	}
-	trimmedToken := strings.Trim(bearerToken[7:], " ")
+	tokenHash := auth.HashToken(strings.Trim(bearerToken[7:], " "))
 	ctx := context.Background()
-	refToken, err := cfg.db.GetRefreshToken(ctx, trimmedToken)
-	if err != nil {
-		errHandler(w, fmt.Errorf("error getting refresh token: %v", err), http.StatusUnauthorized)
+	rotated, err := cfg.db.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{
+		Now:       time.Now(),
+		TokenHash: tokenHash,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		//a token that was already rotated out means it leaked or was stolen,
+		//so nobody holding a token from that family can be trusted anymore
+		stale, lookupErr := cfg.db.GetRefreshTokenByHash(ctx, tokenHash)
+		if lookupErr == nil && stale.RotatedAt.Valid {
+			err = cfg.db.RevokeRefreshTokenFamily(ctx, stale.FamilyID)
+			if err != nil {
+				errHandler(w, fmt.Errorf("error revoking token family: %v", err))
+				return
+			}
+			errHandler(w, fmt.Errorf("refresh token reuse detected"), http.StatusUnauthorized)
+			return
+		}
+		errHandler(w, fmt.Errorf("invalid refresh token"), http.StatusUnauthorized)
 		return
 	}
-	if refToken == "" {
-		errHandler(w, fmt.Errorf("no refresh token found"), http.StatusUnauthorized)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting refresh token: %v", err))
 		return
 	}
 
-	ctx = context.Background()
-	userID, err := cfg.db.GetUserFromRefreshToken(ctx, trimmedToken)
+	scopes := auth.SplitScopes(rotated.Scopes)
+	token, err := cfg.jwtKeys.MakeJWT(rotated.UserID, time.Hour, scopes...)
 	if err != nil {
-		errHandler(w, fmt.Errorf("error getting user id: %v", err))
-		return
-	}
-	if userID == uuid.Nil {
-		errHandler(w, fmt.Errorf("user not found"), http.StatusNotFound)
+		errHandler(w, fmt.Errorf("error creating token: %v", err))
 		return
 	}
-	token, err := auth.MakeJWT(userID, cfg.jwt_secret, time.Hour)
+	refToken, err := cfg.storeRefreshToken(ctx, r, rotated.UserID, rotated.FamilyID, uuid.NullUUID{}, scopes)
 	if err != nil {
-		errHandler(w, fmt.Errorf("error creating token: %v", err))
+		errHandler(w, err)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	parameter := User{}
 	parameter.TokenJWT = token
+	parameter.RefreshToken = refToken
 	resp, _ := json.Marshal(parameter)
 	w.Write(resp)
 }
@@ -365,7 +631,7 @@ func (cfg *apiConfig) revokeRefreshToken(w http.ResponseWriter, r *http.Request)
 	}
 	trimmedToken := strings.Trim(bearerToken[7:], " ")
 	ctx := context.Background()
-	err := cfg.db.RevokeRefreshToken(ctx, trimmedToken)
+	err := cfg.db.RevokeRefreshToken(ctx, auth.HashToken(trimmedToken))
 	if err != nil {
 		errHandler(w, fmt.Errorf("error revoking token: %v", err))
 		return
@@ -375,52 +641,47 @@ func (cfg *apiConfig) revokeRefreshToken(w http.ResponseWriter, r *http.Request)
 }
 
 func (cfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
-	//updates a user's email
+	//updates a user's email and password and/or their profile
 	//must have a valid JWT token in header
-	//must have new email and password in request
+	//email and password have to be sent together with current_password and a token from
+	//logging in, profile:write alone only covers the profile. profile fields left out are kept
 	bearerToken := r.Header.Get("Authorization")
 	if len(bearerToken) < 7 || bearerToken[:7] != "Bearer " {
 		errHandler(w, fmt.Errorf("invalid authorization header"), http.StatusUnauthorized)
 		return
 	}
 	trimmedToken := strings.Trim(bearerToken[7:], " ")
-	userID, err := auth.ValidateJWT(trimmedToken, cfg.jwt_secret)
+	userID, scopes, err := cfg.authorize(trimmedToken)
 	if err != nil {
-		errHandler(w, fmt.Errorf("error validating token: %v", err), http.StatusUnauthorized)
+		tokenErrHandler(w, err)
+		return
+	}
+	if !requireScope(w, scopes, auth.ScopeProfileWrite) {
 		return
 	}
 	decoder := json.NewDecoder(r.Body)
-	partUser := AuthUser{}
+	partUser := userRequest{}
 	err = decoder.Decode(&partUser)
 	if err != nil {
 		errHandler(w, fmt.Errorf("error parsing user info: %v", err))
 		return
 	}
-	hashedPassword, err := auth.HashPassword(partUser.Password)
-	if err != nil {
-		errHandler(w, fmt.Errorf("unable to hash password: %v", err))
+	updatesLogin := partUser.Email != "" || partUser.Password != ""
+	if updatesLogin && (partUser.Email == "" || partUser.Password == "") {
+		errHandler(w, fmt.Errorf("email and password must be sent together"), http.StatusBadRequest)
 		return
 	}
-	ctx := context.Background()
-	updatedUser, err := cfg.db.UpdateUser(ctx, database.UpdateUserParams{
-		ID:             userID,
-		Email:          partUser.Email,
-		HashedPassword: hashedPassword,
-	})
-	if err != nil {
-		errHandler(w, fmt.Errorf("error updating user: %v", err))
-		return
+	changes := userChanges{profileFields: partUser.profileFields}
+	if updatesLogin {
+		if !cfg.isLoginToken(trimmedToken) {
+			loginTokenRequired(w)
+			return
+		}
+		changes.Email = &partUser.Email
+		changes.Password = &partUser.Password
+		changes.CurrentPassword = partUser.CurrentPassword
 	}
-	returningUser := User{}
-	returningUser.ID = updatedUser.ID
-	returningUser.CreatedAt = updatedUser.CreatedAt
-	returningUser.UpdatedAt = updatedUser.UpdatedAt
-	returningUser.Email = updatedUser.Email
-	returningUser.IsChirpyRed = updatedUser.IsChirpyRed
-	resp, _ := json.Marshal(returningUser)
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write(resp)
+	cfg.saveUserChanges(w, r, userID, changes)
 }
 
 func (cfg *apiConfig) handlePolkaWebhook(w http.ResponseWriter, r *http.Request) {
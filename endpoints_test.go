@@ -0,0 +1,1864 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+	"github.com/joncaudill/chirpy/internal/mailer"
+	"github.com/joncaudill/chirpy/internal/store"
+	"github.com/joncaudill/chirpy/internal/webauthn"
+	"github.com/joncaudill/chirpy/internal/webauthn/webauthntest"
+)
+
+func newTestServer(t *testing.T) (*apiConfig, *httptest.Server) {
+	t.Helper()
+	cfg := &apiConfig{
+		db:          store.NewMemory(),
+		platform:    "dev",
+		jwtKeys:     auth.NewKeySet(auth.NewHMACKey("", "test-secret")),
+		polka_key:   "test-polka-key",
+		mailer:      &recordingMailer{},
+		webauthn:    &webauthn.RelyingParty{ID: "localhost", Name: "Chirpy", Origins: []string{"http://localhost:8080"}},
+		loginLimits: defaultLoginLimits(),
+		adminKey:    "test-admin-key",
+	}
+	server := httptest.NewServer(cfg.routes())
+	t.Cleanup(server.Close)
+	return cfg, server
+}
+
+// recordingMailer keeps every message instead of sending it
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *recordingMailer) sent() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.messages)
+}
+
+// doJSON sends body (if any) as json and decodes the response into out (if any)
+func doJSON(t *testing.T, method, url, token string, body, out any) *http.Response {
+	t.Helper()
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			t.Fatalf("unable to encode body: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &reqBody)
+	if err != nil {
+		t.Fatalf("unable to build request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("unable to decode %s %s response: %v", method, url, err)
+		}
+	}
+	return resp
+}
+
+// signup creates a user and logs them in
+func signup(t *testing.T, server *httptest.Server, email, password string) User {
+	t.Helper()
+	creds := AuthUser{Email: email, Password: password}
+	resp := doJSON(t, "POST", server.URL+"/api/users", "", creds, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 creating user, got %d", resp.StatusCode)
+	}
+	user := User{}
+	resp = doJSON(t, "POST", server.URL+"/api/login", "", creds, &user)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 logging in, got %d", resp.StatusCode)
+	}
+	return user
+}
+
+func TestChirpLifecycle(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bob := signup(t, server, "bob@example.com", "password")
+
+	posted := chirp{}
+	resp := doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: "what a kerfuffle"}, &posted)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 posting chirp, got %d", resp.StatusCode)
+	}
+	if posted.Body != "what a ****" {
+		t.Fatalf("expected profanity to be filtered, got %q", posted.Body)
+	}
+	if posted.UserId != alice.ID {
+		t.Fatalf("expected chirp to belong to alice")
+	}
+
+	chirps := []chirp{}
+	doJSON(t, "GET", server.URL+"/api/chirps/?author_id="+alice.ID.String(), "", nil, &chirps)
+	if len(chirps) != 1 || chirps[0].Id != posted.Id {
+		t.Fatalf("expected alice's chirp to be listed, got %v", chirps)
+	}
+
+	resp = doJSON(t, "DELETE", server.URL+"/api/chirps/"+posted.Id.String(), bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 deleting someone else's chirp, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "DELETE", server.URL+"/api/chirps/"+posted.Id.String(), alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting own chirp, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/chirps/"+posted.Id.String(), "", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for deleted chirp, got %d", resp.StatusCode)
+	}
+}
+
+func TestChirpEditHistory(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bob := signup(t, server, "bob@example.com", "password")
+	posted := chirp{}
+	doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: "frist"}, &posted)
+	chirpURL := server.URL + "/api/chirps/" + posted.Id.String()
+
+	resp := doJSON(t, "PUT", chirpURL, bob.TokenJWT, chirp{Body: "hijacked"}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 editing someone else's chirp, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "PUT", chirpURL, alice.TokenJWT, chirp{Body: strings.Repeat("a", 141)}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a long edit, got %d", resp.StatusCode)
+	}
+	edited := chirp{}
+	resp = doJSON(t, "PUT", chirpURL, alice.TokenJWT, chirp{Body: "first sharbert"}, &edited)
+	if resp.StatusCode != http.StatusOK || edited.Body != "first ****" {
+		t.Fatalf("expected a filtered edit, got %d %q", resp.StatusCode, edited.Body)
+	}
+	if !edited.UpdatedAt.After(posted.UpdatedAt) {
+		t.Fatalf("expected updated_at to move forward")
+	}
+
+	history := []chirpRevision{}
+	doJSON(t, "GET", chirpURL+"/history", "", nil, &history)
+	if len(history) != 1 || history[0].Body != "frist" {
+		t.Fatalf("expected the original body in the history, got %v", history)
+	}
+}
+
+func TestChirpThread(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	post := func(body string, parent *uuid.UUID) chirp {
+		posted := chirp{}
+		resp := doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: body, InReplyTo: parent}, &posted)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected 201 posting %q, got %d", body, resp.StatusCode)
+		}
+		return posted
+	}
+	root := post("root", nil)
+	reply := post("reply", &root.Id)
+	nested := post("nested", &reply.Id)
+	if nested.InReplyTo == nil || *nested.InReplyTo != reply.Id {
+		t.Fatalf("expected in_reply_to to be echoed back, got %v", nested.InReplyTo)
+	}
+	missing := uuid.New()
+	resp := doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: "lost", InReplyTo: &missing}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 replying to a missing chirp, got %d", resp.StatusCode)
+	}
+
+	thread := threadResponse{}
+	doJSON(t, "GET", server.URL+"/api/chirps/"+reply.Id.String()+"/thread", "", nil, &thread)
+	if len(thread.Ancestors) != 1 || thread.Ancestors[0].Id != root.Id || thread.Ancestors[0].ReplyCount != 1 {
+		t.Fatalf("expected root as the only ancestor, got %+v", thread.Ancestors)
+	}
+	if thread.Chirp.Id != reply.Id || len(thread.Chirp.Replies) != 1 || thread.Chirp.Replies[0].Id != nested.Id {
+		t.Fatalf("expected nested under reply, got %+v", thread.Chirp)
+	}
+
+	//deleting a parent leaves a tombstone in the thread
+	resp = doJSON(t, "DELETE", server.URL+"/api/chirps/"+root.Id.String(), alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting root, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/chirps/"+root.Id.String(), "", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a deleted chirp, got %d", resp.StatusCode)
+	}
+	thread = threadResponse{}
+	doJSON(t, "GET", server.URL+"/api/chirps/"+root.Id.String()+"/thread", "", nil, &thread)
+	if !thread.Chirp.Deleted || thread.Chirp.Body != "" || len(thread.Chirp.Replies) != 1 {
+		t.Fatalf("expected a tombstone with its replies, got %+v", thread.Chirp)
+	}
+}
+
+func TestRechirpsAndQuotes(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bob := signup(t, server, "bob@example.com", "password")
+	original := chirp{}
+	doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: "original"}, &original)
+	rechirpURL := server.URL + "/api/chirps/" + original.Id.String() + "/rechirp"
+
+	rechirp := chirp{}
+	resp := doJSON(t, "POST", rechirpURL, bob.TokenJWT, nil, &rechirp)
+	if resp.StatusCode != http.StatusCreated || rechirp.Original == nil || rechirp.Original.Id != original.Id || rechirp.Original.RechirpCount != 1 {
+		t.Fatalf("expected a rechirp embedding the original, got %d %+v", resp.StatusCode, rechirp)
+	}
+	resp = doJSON(t, "POST", rechirpURL, bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 rechirping twice, got %d", resp.StatusCode)
+	}
+	//rechirping a rechirp reposts the original
+	resp = doJSON(t, "POST", server.URL+"/api/chirps/"+rechirp.Id.String()+"/rechirp", bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 rechirping through a rechirp, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "PUT", server.URL+"/api/chirps/"+rechirp.Id.String(), bob.TokenJWT, chirp{Body: "sneaky"}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 editing a rechirp, got %d", resp.StatusCode)
+	}
+
+	quote := chirp{}
+	resp = doJSON(t, "POST", server.URL+"/api/chirps", bob.TokenJWT, chirp{Body: "so true", QuoteOf: &original.Id}, &quote)
+	if resp.StatusCode != http.StatusCreated || quote.Original == nil || quote.Original.QuoteCount != 1 {
+		t.Fatalf("expected a quote embedding the original, got %d %+v", resp.StatusCode, quote)
+	}
+	got := chirp{}
+	doJSON(t, "GET", server.URL+"/api/chirps/"+original.Id.String(), "", nil, &got)
+	if got.RechirpCount != 1 || got.QuoteCount != 1 {
+		t.Fatalf("expected 1 rechirp and 1 quote, got %+v", got)
+	}
+
+	resp = doJSON(t, "DELETE", server.URL+"/api/rechirps/"+rechirp.Id.String(), alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 undoing someone else's rechirp, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "DELETE", server.URL+"/api/rechirps/"+quote.Id.String(), bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 undoing a quote as a rechirp, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "DELETE", server.URL+"/api/rechirps/"+rechirp.Id.String(), bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 undoing a rechirp, got %d", resp.StatusCode)
+	}
+	got = chirp{}
+	doJSON(t, "GET", server.URL+"/api/chirps/"+original.Id.String(), "", nil, &got)
+	if got.RechirpCount != 0 {
+		t.Fatalf("expected the rechirp count to drop, got %+v", got)
+	}
+}
+
+func TestChirpLikes(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bob := signup(t, server, "bob@example.com", "password")
+	posted := chirp{}
+	doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: "like me"}, &posted)
+	chirpURL := server.URL + "/api/chirps/" + posted.Id.String()
+
+	resp := doJSON(t, "POST", chirpURL+"/like", "", nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 liking without a token, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/chirps/"+uuid.New().String()+"/like", bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 liking a missing chirp, got %d", resp.StatusCode)
+	}
+	for _, user := range []User{alice, bob, bob} {
+		resp = doJSON(t, "POST", chirpURL+"/like", user.TokenJWT, nil, nil)
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("expected 204 liking, got %d", resp.StatusCode)
+		}
+	}
+
+	got := chirp{}
+	doJSON(t, "GET", chirpURL, bob.TokenJWT, nil, &got)
+	if got.LikeCount != 2 || !got.LikedByMe {
+		t.Fatalf("expected 2 likes including bob's, got %+v", got)
+	}
+	got = chirp{}
+	doJSON(t, "GET", chirpURL, "", nil, &got)
+	if got.LikeCount != 2 || got.LikedByMe {
+		t.Fatalf("expected liked_by_me to be false anonymously, got %+v", got)
+	}
+
+	likes := []chirpLike{}
+	resp = doJSON(t, "GET", chirpURL+"/likes?limit=1", "", nil, &likes)
+	if len(likes) != 1 || likes[0].UserId != bob.ID || resp.Header.Get("Link") == "" {
+		t.Fatalf("expected bob first with a next link, got %v", likes)
+	}
+	liked := []chirp{}
+	doJSON(t, "GET", server.URL+"/api/users/"+bob.ID.String()+"/likes", "", nil, &liked)
+	if len(liked) != 1 || liked[0].Id != posted.Id {
+		t.Fatalf("expected bob's liked chirp, got %v", liked)
+	}
+
+	resp = doJSON(t, "DELETE", chirpURL+"/like", bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 unliking, got %d", resp.StatusCode)
+	}
+	got = chirp{}
+	doJSON(t, "GET", chirpURL, bob.TokenJWT, nil, &got)
+	if got.LikeCount != 1 || got.LikedByMe {
+		t.Fatalf("expected bob's like to be gone, got %+v", got)
+	}
+
+	doJSON(t, "DELETE", chirpURL, alice.TokenJWT, nil, nil)
+	resp = doJSON(t, "GET", chirpURL+"/likes", "", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a deleted chirp's likes, got %d", resp.StatusCode)
+	}
+}
+
+func TestFollowsAndTimeline(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bob := signup(t, server, "bob@example.com", "password")
+	carol := signup(t, server, "carol@example.com", "letmein")
+	followURL := func(user User) string {
+		return server.URL + "/api/users/" + user.ID.String() + "/follow"
+	}
+
+	resp := doJSON(t, "POST", followURL(alice), alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 following yourself, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/users/"+uuid.New().String()+"/follow", alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 following a missing user, got %d", resp.StatusCode)
+	}
+	for _, user := range []User{bob, carol} {
+		resp = doJSON(t, "POST", followURL(user), alice.TokenJWT, nil, nil)
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("expected 204 following, got %d", resp.StatusCode)
+		}
+	}
+	following := []followEdge{}
+	doJSON(t, "GET", server.URL+"/api/users/"+alice.ID.String()+"/following", "", nil, &following)
+	if len(following) != 2 {
+		t.Fatalf("expected alice to follow 2 users, got %v", following)
+	}
+	followers := []followEdge{}
+	doJSON(t, "GET", server.URL+"/api/users/"+bob.ID.String()+"/followers", "", nil, &followers)
+	if len(followers) != 1 || followers[0].UserId != alice.ID {
+		t.Fatalf("expected alice to follow bob, got %v", followers)
+	}
+
+	for _, user := range []User{bob, carol, alice, bob} {
+		doJSON(t, "POST", server.URL+"/api/chirps", user.TokenJWT, chirp{Body: "hello from " + user.Email}, nil)
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/timeline", "", nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for the timeline without a token, got %d", resp.StatusCode)
+	}
+	timeline := []chirp{}
+	resp = doJSON(t, "GET", server.URL+"/api/timeline?limit=2", alice.TokenJWT, nil, &timeline)
+	if len(timeline) != 2 || timeline[0].UserId != bob.ID || timeline[1].UserId != carol.ID || resp.Header.Get("Link") == "" {
+		t.Fatalf("expected bob then carol with a next page, got %v", timeline)
+	}
+
+	doJSON(t, "DELETE", followURL(bob), alice.TokenJWT, nil, nil)
+	timeline = []chirp{}
+	doJSON(t, "GET", server.URL+"/api/timeline", alice.TokenJWT, nil, &timeline)
+	if len(timeline) != 1 || timeline[0].UserId != carol.ID {
+		t.Fatalf("expected only carol after unfollowing bob, got %v", timeline)
+	}
+}
+
+func TestBlocksAndMutes(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bob := signup(t, server, "bob@example.com", "password")
+	carol := signup(t, server, "carol@example.com", "letmein")
+	userURL := func(user User, action string) string {
+		return server.URL + "/api/users/" + user.ID.String() + "/" + action
+	}
+
+	aliceChirp := chirp{}
+	doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: "alice here"}, &aliceChirp)
+	doJSON(t, "POST", server.URL+"/api/chirps", carol.TokenJWT, chirp{Body: "carol here"}, nil)
+	doJSON(t, "POST", userURL(alice, "follow"), bob.TokenJWT, nil, nil)
+	doJSON(t, "POST", userURL(carol, "follow"), bob.TokenJWT, nil, nil)
+
+	resp := doJSON(t, "POST", userURL(bob, "block"), alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 blocking, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", userURL(alice, "block"), alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 blocking yourself, got %d", resp.StatusCode)
+	}
+	followers := []followEdge{}
+	doJSON(t, "GET", userURL(alice, "followers"), "", nil, &followers)
+	if len(followers) != 0 {
+		t.Fatalf("expected blocking to remove bob's follow, got %v", followers)
+	}
+	for _, attempt := range []struct {
+		follower, followee User
+	}{{bob, alice}, {alice, bob}} {
+		resp = doJSON(t, "POST", userURL(attempt.followee, "follow"), attempt.follower.TokenJWT, nil, nil)
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected 403 following across a block, got %d", resp.StatusCode)
+		}
+	}
+	doJSON(t, "GET", userURL(alice, "followers"), "", nil, &followers)
+	if len(followers) != 0 {
+		t.Fatalf("expected bob not to be able to follow alice again, got %v", followers)
+	}
+
+	chirpURL := server.URL + "/api/chirps/" + aliceChirp.Id.String()
+	for _, attempt := range []struct{ method, url string }{
+		{"POST", chirpURL + "/like"},
+		{"POST", chirpURL + "/rechirp"},
+	} {
+		resp = doJSON(t, attempt.method, attempt.url, bob.TokenJWT, nil, nil)
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected 403 for %s %s while blocked, got %d", attempt.method, attempt.url, resp.StatusCode)
+		}
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/chirps", bob.TokenJWT, map[string]any{"body": "hey", "in_reply_to": aliceChirp.Id}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 replying while blocked, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "GET", chirpURL, bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for the blocker's chirp, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "GET", chirpURL+"/history", bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for the blocker's chirp history, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "GET", chirpURL+"/likes", bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for the blocker's chirp likes, got %d", resp.StatusCode)
+	}
+	listed := []chirp{}
+	doJSON(t, "GET", server.URL+"/api/chirps", bob.TokenJWT, nil, &listed)
+	if len(listed) != 1 || listed[0].UserId != carol.ID {
+		t.Fatalf("expected only carol's chirp for bob, got %v", listed)
+	}
+
+	resp = doJSON(t, "POST", userURL(carol, "mute"), bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 muting, got %d", resp.StatusCode)
+	}
+	timeline := []chirp{}
+	doJSON(t, "GET", server.URL+"/api/timeline", bob.TokenJWT, nil, &timeline)
+	if len(timeline) != 0 {
+		t.Fatalf("expected muted chirps to be hidden from the timeline, got %v", timeline)
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/chirps/"+listed[0].Id.String(), bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected muted chirps to still be reachable directly, got %d", resp.StatusCode)
+	}
+
+	relations := []userRelation{}
+	doJSON(t, "GET", server.URL+"/api/blocks", alice.TokenJWT, nil, &relations)
+	if len(relations) != 1 || relations[0].UserId != bob.ID {
+		t.Fatalf("expected alice to have blocked bob, got %v", relations)
+	}
+	relations = []userRelation{}
+	doJSON(t, "GET", server.URL+"/api/mutes", bob.TokenJWT, nil, &relations)
+	if len(relations) != 1 || relations[0].UserId != carol.ID {
+		t.Fatalf("expected bob to have muted carol, got %v", relations)
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/blocks", "", nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 listing blocks without a token, got %d", resp.StatusCode)
+	}
+
+	doJSON(t, "DELETE", userURL(bob, "block"), alice.TokenJWT, nil, nil)
+	resp = doJSON(t, "GET", chirpURL, bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after unblocking, got %d", resp.StatusCode)
+	}
+}
+
+func TestUserProfiles(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bob := signup(t, server, "bob@example.com", "password")
+	if !strings.HasPrefix(alice.Handle, "user") {
+		t.Fatalf("expected a placeholder handle, got %q", alice.Handle)
+	}
+
+	updated := User{}
+	resp := doJSON(t, "PUT", server.URL+"/api/users", alice.TokenJWT, map[string]string{"handle": "@Alice", "display_name": "Alice A", "bio": "hello"}, &updated)
+	if resp.StatusCode != http.StatusOK || updated.Handle != "Alice" || updated.Bio != "hello" || updated.Email != "alice@example.com" {
+		t.Fatalf("expected the profile to be updated, got %d %+v", resp.StatusCode, updated)
+	}
+	resp = doJSON(t, "PUT", server.URL+"/api/users", bob.TokenJWT, map[string]string{"handle": "alice"}, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for a taken handle, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "PUT", server.URL+"/api/users", bob.TokenJWT, map[string]string{"handle": "no spaces"}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad handle, got %d", resp.StatusCode)
+	}
+
+	var public map[string]any
+	resp = doJSON(t, "GET", server.URL+"/api/users/@aLiCe", "", nil, &public)
+	if resp.StatusCode != http.StatusOK || public["handle"] != "Alice" || public["display_name"] != "Alice A" {
+		t.Fatalf("expected alice's profile, got %d %v", resp.StatusCode, public)
+	}
+	if _, ok := public["email"]; ok {
+		t.Fatalf("expected the public profile to leave out the email")
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/users/nobody", "", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown handle, got %d", resp.StatusCode)
+	}
+
+	posted := chirp{}
+	doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: "hi"}, &posted)
+	got := chirp{}
+	doJSON(t, "GET", server.URL+"/api/chirps/"+posted.Id.String(), "", nil, &got)
+	if got.Author != nil {
+		t.Fatalf("expected no author unless asked for")
+	}
+	doJSON(t, "GET", server.URL+"/api/chirps/"+posted.Id.String()+"?expand=author", "", nil, &got)
+	if got.Author == nil || got.Author.Handle != "Alice" {
+		t.Fatalf("expected alice's profile embedded, got %+v", got.Author)
+	}
+}
+
+func TestPatchUserAndChangePassword(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	signup(t, server, "bob@example.com", "password")
+
+	patched := User{}
+	resp := doJSON(t, "PATCH", server.URL+"/api/users", alice.TokenJWT, map[string]string{"bio": "just the bio"}, &patched)
+	if resp.StatusCode != http.StatusOK || patched.Bio != "just the bio" || patched.Email != "alice@example.com" {
+		t.Fatalf("expected only the bio to change, got %d %+v", resp.StatusCode, patched)
+	}
+	for _, tc := range []struct {
+		name   string
+		body   map[string]string
+		status int
+	}{
+		{"bad email", map[string]string{"email": "not an email", "current_password": "hunter2"}, http.StatusBadRequest},
+		{"email without current_password", map[string]string{"email": "alice@example.net"}, http.StatusUnauthorized},
+		{"email with the wrong password", map[string]string{"email": "alice@example.net", "current_password": "guess"}, http.StatusUnauthorized},
+		{"taken email", map[string]string{"email": "bob@example.com", "current_password": "hunter2"}, http.StatusConflict},
+		{"password", map[string]string{"password": "sneaky"}, http.StatusBadRequest},
+		{"nothing", map[string]string{}, http.StatusBadRequest},
+	} {
+		resp = doJSON(t, "PATCH", server.URL+"/api/users", alice.TokenJWT, tc.body, nil)
+		if resp.StatusCode != tc.status {
+			t.Fatalf("%s: expected %d, got %d", tc.name, tc.status, resp.StatusCode)
+		}
+	}
+	resp = doJSON(t, "PUT", server.URL+"/api/users", alice.TokenJWT, userRequest{AuthUser: AuthUser{Email: "bob@example.com", Password: "hunter2"}, CurrentPassword: "hunter2"}, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 taking bob's email with PUT, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "PATCH", server.URL+"/api/users", alice.TokenJWT, map[string]string{"email": "alice@example.org", "current_password": "hunter2"}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 changing email, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/login", "", AuthUser{Email: "alice@example.org", Password: "hunter2"}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the password to survive an email change, got %d", resp.StatusCode)
+	}
+
+	bot := personalToken{}
+	doJSON(t, "POST", server.URL+"/api/tokens", alice.TokenJWT, personalTokenRequest{Name: "bot", Scopes: auth.AllScopes}, &bot)
+	resp = doJSON(t, "POST", server.URL+"/api/users/password", bot.Token, passwordChange{CurrentPassword: "hunter2", NewPassword: "better"}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a personal access token not to change the password, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/users/password", alice.TokenJWT, passwordChange{CurrentPassword: "wrong", NewPassword: "better"}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with the wrong current password, got %d", resp.StatusCode)
+	}
+	changed := User{}
+	resp = doJSON(t, "POST", server.URL+"/api/users/password", alice.TokenJWT, passwordChange{CurrentPassword: "hunter2", NewPassword: "better"}, &changed)
+	if resp.StatusCode != http.StatusOK || changed.RefreshToken == "" {
+		t.Fatalf("expected 200 and a new refresh token, got %d %+v", resp.StatusCode, changed)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", alice.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the old refresh token to be revoked, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", changed.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the new refresh token to work, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/login", "", AuthUser{Email: "alice@example.org", Password: "better"}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected to log in with the new password, got %d", resp.StatusCode)
+	}
+}
+
+// racingEmailStore misses the first lookup of an email, like a check that ran
+// just before someone else took it
+type racingEmailStore struct {
+	store.Store
+	missed sync.Map
+}
+
+func (s *racingEmailStore) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	if _, seen := s.missed.LoadOrStore(email, true); !seen {
+		return database.User{}, sql.ErrNoRows
+	}
+	return s.Store.GetUserByEmail(ctx, email)
+}
+
+func TestEmailChangeRace(t *testing.T) {
+	cfg, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	signup(t, server, "bob@example.com", "password")
+	cfg.db = &racingEmailStore{Store: cfg.db}
+
+	resp := doJSON(t, "PATCH", server.URL+"/api/users", alice.TokenJWT, map[string]string{"email": "bob@example.com", "current_password": "hunter2"}, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 when the email is taken after the check, got %d", resp.StatusCode)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	cfg, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	mail := cfg.mailer.(*recordingMailer)
+	//signing up already sent a verification email
+	mailed := len(mail.sent())
+
+	//the mail goes out after the response, so wait for it before looking
+	resp := doJSON(t, "POST", server.URL+"/api/password-reset", "", passwordResetRequest{Email: "nobody@example.com"}, nil)
+	cfg.background.Wait()
+	if resp.StatusCode != http.StatusAccepted || len(mail.sent()) != mailed {
+		t.Fatalf("expected 202 and no mail for an unknown email, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/password-reset", "", passwordResetRequest{Email: "alice@example.com"}, nil)
+	cfg.background.Wait()
+	if resp.StatusCode != http.StatusAccepted || len(mail.sent()) != mailed+1 {
+		t.Fatalf("expected 202 and one mail, got %d", resp.StatusCode)
+	}
+	sent := mail.sent()[mailed]
+	token := regexp.MustCompile(`[0-9a-f]{64}`).FindString(sent.Body)
+	if sent.To != "alice@example.com" || token == "" {
+		t.Fatalf("expected a reset token mailed to alice, got %+v", sent)
+	}
+
+	resp = doJSON(t, "POST", server.URL+"/api/password-reset/confirm", "", passwordResetConfirm{Token: strings.Repeat("0", 64), NewPassword: "better"}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a made up token, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/password-reset/confirm", "", passwordResetConfirm{Token: token, NewPassword: "better"}, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 resetting, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/password-reset/confirm", "", passwordResetConfirm{Token: token, NewPassword: "again"}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 reusing a token, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", alice.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the reset to revoke refresh tokens, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/login", "", AuthUser{Email: "alice@example.com", Password: "better"}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected to log in with the new password, got %d", resp.StatusCode)
+	}
+}
+
+func TestPasswordResetRateLimit(t *testing.T) {
+	cfg, server := newTestServer(t)
+	signup(t, server, "alice@example.com", "hunter2")
+	//an email with no account runs out at the same point as one with an account
+	for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+		for i := 0; i < passwordResetsPerEmail; i++ {
+			resp := doJSON(t, "POST", server.URL+"/api/password-reset", "", passwordResetRequest{Email: email}, nil)
+			if resp.StatusCode != http.StatusAccepted {
+				t.Fatalf("expected 202 for reset %d of %s, got %d", i+1, email, resp.StatusCode)
+			}
+		}
+		resp := doJSON(t, "POST", server.URL+"/api/password-reset", "", passwordResetRequest{Email: email}, nil)
+		if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+			t.Fatalf("expected 429 with Retry-After once %s is over the limit, got %d", email, resp.StatusCode)
+		}
+	}
+
+	//one address spreading requests over many emails runs out too, counting the ones above
+	//that got through. the ones turned away don't count
+	sent := 2 * passwordResetsPerEmail
+	for i := sent; i < passwordResetsPerIP; i++ {
+		resp := doJSON(t, "POST", server.URL+"/api/password-reset", "", passwordResetRequest{Email: fmt.Sprintf("user%d@example.com", i)}, nil)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected 202 for reset %d from one address, got %d", i+1, resp.StatusCode)
+		}
+	}
+	resp := doJSON(t, "POST", server.URL+"/api/password-reset", "", passwordResetRequest{Email: "carol@example.com"}, nil)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the address is over the limit, got %d", resp.StatusCode)
+	}
+	if _, err := cfg.db.GetPasswordResetThrottle(context.Background(), accountThrottleKey("carol@example.com")); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected a request turned away for the address not to count against the email, got %v", err)
+	}
+
+	//an admin can lift the limit early
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(unlockLoginRequest{IP: "127.0.0.1"})
+	req, _ := http.NewRequest("POST", server.URL+"/admin/login-locks/unlock", &body)
+	req.Header.Set("Authorization", "ApiKey test-admin-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 clearing the address's reset limit, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/password-reset", "", passwordResetRequest{Email: "carol@example.com"}, nil)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 once the limit was cleared, got %d", resp.StatusCode)
+	}
+	cfg.background.Wait()
+}
+
+func TestEmailVerification(t *testing.T) {
+	cfg, server := newTestServer(t)
+	cfg.requireVerifiedEmail = true
+	mail := cfg.mailer.(*recordingMailer)
+	resp := doJSON(t, "POST", server.URL+"/api/users", "", AuthUser{Email: "not an email", Password: "hunter2"}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 signing up with a bad email, got %d", resp.StatusCode)
+	}
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	if alice.EmailVerified {
+		t.Fatalf("expected a new user to be unverified")
+	}
+	sent := mail.sent()
+	if len(sent) != 1 || sent[0].To != "alice@example.com" {
+		t.Fatalf("expected a verification email for alice, got %+v", sent)
+	}
+	token := regexp.MustCompile(`[0-9a-f]{64}`).FindString(sent[0].Body)
+
+	resp = doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: "too soon"}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 posting before verifying, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/users/verify/resend", alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After resending right away, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, "POST", server.URL+"/api/users/verify", "", emailVerification{Token: token}, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 verifying, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/users/verify", "", emailVerification{Token: token}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 reusing a verification token, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: "verified now"}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 posting once verified, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/users/verify/resend", alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 resending once verified, got %d", resp.StatusCode)
+	}
+
+	patched := User{}
+	doJSON(t, "PATCH", server.URL+"/api/users", alice.TokenJWT, map[string]string{"email": "alice@example.org", "current_password": "hunter2"}, &patched)
+	if patched.EmailVerified || len(mail.sent()) != 2 {
+		t.Fatalf("expected a new email to need verifying again, got %+v", patched)
+	}
+}
+
+func TestChirpsPagination(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	var posted []chirp
+	for i := 0; i < 5; i++ {
+		newChirp := chirp{}
+		doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: "chirp"}, &newChirp)
+		posted = append(posted, newChirp)
+	}
+
+	var seen []chirp
+	next := "/api/chirps/?sort=desc&limit=2"
+	for next != "" {
+		page := []chirp{}
+		resp := doJSON(t, "GET", server.URL+next, "", nil, &page)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 listing chirps, got %d", resp.StatusCode)
+		}
+		seen = append(seen, page...)
+		next = ""
+		if link := resp.Header.Get("Link"); link != "" {
+			next = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+	if len(seen) != len(posted) {
+		t.Fatalf("expected %d chirps across pages, got %d", len(posted), len(seen))
+	}
+	for i := range seen {
+		if seen[i].Id != posted[len(posted)-1-i].Id {
+			t.Fatalf("expected newest chirps first")
+		}
+	}
+
+	resp := doJSON(t, "GET", server.URL+"/api/chirps/?cursor=garbage", "", nil, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad cursor, got %d", resp.StatusCode)
+	}
+}
+
+func TestChirpsSearch(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	for _, body := range []string{"learning go today", "go go go", "nothing to see"} {
+		doJSON(t, "POST", server.URL+"/api/chirps", alice.TokenJWT, chirp{Body: body}, nil)
+	}
+	results := []chirp{}
+	resp := doJSON(t, "GET", server.URL+"/api/chirps/search?q=go", "", nil, &results)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 searching, got %d", resp.StatusCode)
+	}
+	if len(results) != 2 || results[0].Body != "go go go" {
+		t.Fatalf("expected 2 results with the best match first, got %v", results)
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/chirps/search?q=", "", nil, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty query, got %d", resp.StatusCode)
+	}
+}
+
+func TestRefreshAndRevoke(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+
+	refreshed := User{}
+	resp := doJSON(t, "POST", server.URL+"/api/refresh", alice.RefreshToken, nil, &refreshed)
+	if resp.StatusCode != http.StatusOK || refreshed.TokenJWT == "" || refreshed.RefreshToken == "" {
+		t.Fatalf("expected a new token pair, got %d", resp.StatusCode)
+	}
+	if refreshed.RefreshToken == alice.RefreshToken {
+		t.Fatalf("expected the refresh token to be rotated")
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/revoke", refreshed.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 revoking token, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", refreshed.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for revoked token, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", "not-a-token", nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown token, got %d", resp.StatusCode)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bob := signup(t, server, "bob@example.com", "password")
+	laptop := User{}
+	doJSON(t, "POST", server.URL+"/api/login", "", AuthUser{Email: "alice@example.com", Password: "hunter2"}, &laptop)
+
+	sessions := []session{}
+	resp := doJSON(t, "GET", server.URL+"/api/sessions", alice.TokenJWT, nil, &sessions)
+	if resp.StatusCode != http.StatusOK || len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d (%d)", len(sessions), resp.StatusCode)
+	}
+	if sessions[0].IP != "127.0.0.1" || !strings.HasPrefix(sessions[0].UserAgent, "Go-http-client") {
+		t.Fatalf("expected the device to be recorded, got %+v", sessions[0])
+	}
+
+	//refreshing keeps the session but moves it to the front
+	doJSON(t, "POST", server.URL+"/api/refresh", alice.RefreshToken, nil, nil)
+	resp = doJSON(t, "GET", server.URL+"/api/sessions", alice.TokenJWT, nil, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("expected refreshing not to add a session, got %d", len(sessions))
+	}
+	phone := sessions[0].ID
+
+	resp = doJSON(t, "DELETE", server.URL+"/api/sessions/"+phone.String(), bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 revoking someone else's session, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "DELETE", server.URL+"/api/sessions/"+phone.String(), alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 revoking session, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/sessions", alice.TokenJWT, nil, &sessions)
+	if len(sessions) != 1 || sessions[0].ID == phone {
+		t.Fatalf("expected only the laptop session left, got %+v", sessions)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", laptop.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the laptop to keep working, got %d", resp.StatusCode)
+	}
+
+	resp = doJSON(t, "POST", server.URL+"/api/sessions/logout-all", alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 logging out everywhere, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/sessions", alice.TokenJWT, nil, &sessions)
+	if len(sessions) != 0 {
+		t.Fatalf("expected no sessions left, got %+v", sessions)
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/sessions", bob.TokenJWT, nil, &sessions)
+	if len(sessions) != 1 {
+		t.Fatalf("expected bob's session to survive, got %+v", sessions)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	laptop := User{}
+	doJSON(t, "POST", server.URL+"/api/login", "", AuthUser{Email: "alice@example.com", Password: "hunter2"}, &laptop)
+
+	first := User{}
+	doJSON(t, "POST", server.URL+"/api/refresh", alice.RefreshToken, nil, &first)
+	second := User{}
+	resp := doJSON(t, "POST", server.URL+"/api/refresh", first.RefreshToken, nil, &second)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the rotated token to work, got %d", resp.StatusCode)
+	}
+
+	//replaying a rotated-out token kills everything issued from it
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", alice.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a reused token, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", second.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the rest of the family to be revoked, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", laptop.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected another login's token to keep working, got %d", resp.StatusCode)
+	}
+}
+
+func TestJWKSAndKeyRotation(t *testing.T) {
+	cfg, server := newTestServer(t)
+	dir := t.TempDir()
+	writeKey := func(id string) ed25519.PublicKey {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("unable to generate key: %v", err)
+		}
+		der, _ := x509.MarshalPKCS8PrivateKey(private)
+		err = os.WriteFile(filepath.Join(dir, id+".pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+		if err != nil {
+			t.Fatalf("unable to write key: %v", err)
+		}
+		return public
+	}
+	writeKey("old")
+	newPublic := writeKey("new")
+
+	//a token from before the switch to key files
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	keys, err := openKeySet("test-secret", dir, "new", true)
+	if err != nil {
+		t.Fatalf("unable to open key set: %v", err)
+	}
+	cfg.jwtKeys = keys
+	resp := doJSON(t, "GET", server.URL+"/api/sessions", alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected tokens signed with JWT_SECRET to keep working while switching over, got %d", resp.StatusCode)
+	}
+	keys, err = openKeySet("test-secret", dir, "new", false)
+	if err != nil {
+		t.Fatalf("unable to open key set: %v", err)
+	}
+	cfg.jwtKeys = keys
+	resp = doJSON(t, "GET", server.URL+"/api/sessions", alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected JWT_SECRET to stop working once it isn't kept, got %d", resp.StatusCode)
+	}
+
+	jwks := auth.JWKS{}
+	resp = doJSON(t, "GET", server.URL+"/.well-known/jwks.json", "", nil, &jwks)
+	if resp.StatusCode != http.StatusOK || len(jwks.Keys) != 2 {
+		t.Fatalf("expected both public keys, got %+v (%d)", jwks.Keys, resp.StatusCode)
+	}
+	var published string
+	for _, key := range jwks.Keys {
+		if key.Kid == "new" {
+			published = key.X
+		}
+	}
+	if published != base64.RawURLEncoding.EncodeToString(newPublic) {
+		t.Fatalf("expected the new key to be published")
+	}
+
+	//anyone holding the published key can check a fresh token
+	user := User{}
+	doJSON(t, "POST", server.URL+"/api/login", "", AuthUser{Email: "alice@example.com", Password: "hunter2"}, &user)
+	_, err = jwt.Parse(user.TokenJWT, func(token *jwt.Token) (interface{}, error) {
+		return newPublic, nil
+	}, jwt.WithValidMethods([]string{"EdDSA"}))
+	if err != nil {
+		t.Fatalf("expected the token to verify with the published key: %v", err)
+	}
+
+	if _, err := openKeySet("", dir, "missing", false); err == nil {
+		t.Fatalf("expected an error for an unknown JWT_KEY_ID")
+	}
+}
+
+func TestAccessTokenErrors(t *testing.T) {
+	cfg, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+
+	expired, _ := cfg.jwtKeys.MakeJWT(alice.ID, -time.Minute)
+	otherAudience := auth.NewKeySet(auth.NewHMACKey("", "test-secret"))
+	otherAudience.Audience = "someone-else"
+	misaddressed, _ := otherAudience.MakeJWT(alice.ID, time.Minute)
+	forged, _ := auth.MakeJWT(alice.ID, "not-the-secret", time.Minute)
+	for token, code := range map[string]string{
+		expired:      "token_expired",
+		misaddressed: "wrong_audience",
+		forged:       "bad_signature",
+		"garbage":    "malformed_token",
+	} {
+		body := chirpError{}
+		req, _ := http.NewRequest("GET", server.URL+"/api/sessions", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || body.Code != code {
+			t.Fatalf("expected 401 %s, got %d %+v", code, resp.StatusCode, body)
+		}
+		if !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), `Bearer error="invalid_token"`) {
+			t.Fatalf("expected a WWW-Authenticate header, got %q", resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+
+	bot := personalToken{}
+	resp := doJSON(t, "POST", server.URL+"/api/tokens", alice.TokenJWT, personalTokenRequest{Name: "bot", Scopes: []string{"chirps:write", "chirps:read"}}, &bot)
+	if resp.StatusCode != http.StatusCreated || !strings.HasPrefix(bot.Token, "chirpy_pat_") {
+		t.Fatalf("expected a new token, got %d %+v", resp.StatusCode, bot)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/tokens", alice.TokenJWT, personalTokenRequest{Name: "bad", Scopes: []string{"admin"}}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown scope, got %d", resp.StatusCode)
+	}
+
+	//the bot can post and delete chirps but can't touch the profile
+	posted := chirp{}
+	resp = doJSON(t, "POST", server.URL+"/api/chirps", bot.Token, chirp{Body: "beep"}, &posted)
+	if resp.StatusCode != http.StatusCreated || posted.UserId != alice.ID {
+		t.Fatalf("expected the bot to post as alice, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "PATCH", server.URL+"/api/users", bot.Token, map[string]string{"bio": "hacked"}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 without profile:write, got %d", resp.StatusCode)
+	}
+	for _, scopes := range [][]string{{"chirps:read"}, {"profile:write"}} {
+		resp = doJSON(t, "POST", server.URL+"/api/tokens", bot.Token, personalTokenRequest{Name: "escalate", Scopes: scopes}, nil)
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected a personal access token not to mint another with %v, got %d", scopes, resp.StatusCode)
+		}
+	}
+
+	reader := personalToken{}
+	doJSON(t, "POST", server.URL+"/api/tokens", alice.TokenJWT, personalTokenRequest{Name: "reader", Scopes: []string{"chirps:read"}}, &reader)
+	resp = doJSON(t, "DELETE", server.URL+"/api/chirps/"+posted.Id.String(), reader.Token, nil, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 deleting without chirps:write, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "GET", server.URL+"/api/timeline", reader.Token, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the reader to see the timeline, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "PUT", server.URL+"/api/users", reader.Token, userRequest{profileFields: profileFields{Bio: &posted.Body}}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 updating the user without profile:write, got %d", resp.StatusCode)
+	}
+
+	tokens := []personalToken{}
+	doJSON(t, "GET", server.URL+"/api/tokens", alice.TokenJWT, nil, &tokens)
+	if len(tokens) != 2 || tokens[0].Token != "" || tokens[1].LastUsedAt == nil {
+		t.Fatalf("expected both tokens listed without secrets, got %+v", tokens)
+	}
+	resp = doJSON(t, "DELETE", server.URL+"/api/tokens/"+bot.ID.String(), alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 revoking token, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/chirps", bot.Token, chirp{Body: "beep"}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a revoked token, got %d", resp.StatusCode)
+	}
+}
+
+// postOAuthForm sends a form to an OAuth endpoint as a client, using HTTP Basic auth
+// when there's a secret, and decodes the response whatever its status
+func postOAuthForm(t *testing.T, endpoint string, client oauthClient, form url.Values, out any) *http.Response {
+	t.Helper()
+	if client.Secret == "" {
+		form.Set("client_id", client.ID.String())
+	}
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatalf("unable to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if client.Secret != "" {
+		req.SetBasicAuth(client.ID.String(), client.Secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST %s failed: %v", endpoint, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("unable to decode POST %s response: %v", endpoint, err)
+		}
+	}
+	return resp
+}
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	_, server := newTestServer(t)
+	dev := signup(t, server, "dev@example.com", "hunter2")
+	alice := signup(t, server, "alice@example.com", "password")
+
+	app := oauthClient{}
+	resp := doJSON(t, "POST", server.URL+"/api/oauth/clients", dev.TokenJWT, oauthClientRequest{Name: "app", RedirectURIs: []string{"https://app.example.com/callback"}}, &app)
+	if resp.StatusCode != http.StatusCreated || app.Secret == "" || app.Public {
+		t.Fatalf("expected a confidential client, got %d %+v", resp.StatusCode, app)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/oauth/clients", dev.TokenJWT, oauthClientRequest{Name: "bad", RedirectURIs: []string{"http://evil.example.com/"}}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a plain http redirect_uri, got %d", resp.StatusCode)
+	}
+
+	verifier := "a-verifier-that-is-long-enough-to-satisfy-pkce-rules"
+	request := oauthAuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            app.ID.String(),
+		RedirectURI:         "https://app.example.com/callback",
+		Scope:               "chirps:read chirps:write",
+		State:               "xyz",
+		CodeChallenge:       auth.PKCEChallenge(verifier),
+		CodeChallengeMethod: "S256",
+	}
+
+	//the consent screen gets the client and scopes to show
+	query := url.Values{
+		"response_type":         {request.ResponseType},
+		"client_id":             {request.ClientID},
+		"redirect_uri":          {request.RedirectURI},
+		"scope":                 {request.Scope},
+		"code_challenge":        {request.CodeChallenge},
+		"code_challenge_method": {request.CodeChallengeMethod},
+	}
+	consent := oauthConsent{}
+	resp = doJSON(t, "GET", server.URL+"/api/oauth/authorize?"+query.Encode(), alice.TokenJWT, nil, &consent)
+	if resp.StatusCode != http.StatusOK || consent.ClientName != "app" || len(consent.Scopes) != 2 {
+		t.Fatalf("expected consent details, got %d %+v", resp.StatusCode, consent)
+	}
+	query.Set("redirect_uri", "https://evil.example.com/callback")
+	resp = doJSON(t, "GET", server.URL+"/api/oauth/authorize?"+query.Encode(), alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unregistered redirect_uri, got %d", resp.StatusCode)
+	}
+
+	approve := func(t *testing.T, request oauthAuthorizeRequest) url.Values {
+		t.Helper()
+		answer := map[string]string{}
+		resp := doJSON(t, "POST", server.URL+"/api/oauth/authorize", alice.TokenJWT, request, &answer)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 answering consent, got %d", resp.StatusCode)
+		}
+		redirect, err := url.Parse(answer["redirect_to"])
+		if err != nil || !strings.HasPrefix(answer["redirect_to"], request.RedirectURI+"?") {
+			t.Fatalf("expected a redirect back to the client, got %q", answer["redirect_to"])
+		}
+		return redirect.Query()
+	}
+	denied := approve(t, request)
+	if denied.Get("error") != "access_denied" || denied.Get("state") != "xyz" || denied.Has("code") {
+		t.Fatalf("expected a denial to send back access_denied, got %v", denied)
+	}
+	request.Approve = true
+	code := approve(t, request).Get("code")
+
+	tokenForm := func(code, verifier string) url.Values {
+		return url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {request.RedirectURI},
+			"code_verifier": {verifier},
+		}
+	}
+	oauthErr := oauthError{}
+	resp = postOAuthForm(t, server.URL+"/api/oauth/token", oauthClient{ID: app.ID, Secret: "wrong"}, tokenForm(code, verifier), &oauthErr)
+	if resp.StatusCode != http.StatusUnauthorized || oauthErr.Error != "invalid_client" {
+		t.Fatalf("expected invalid_client for a wrong secret, got %d %+v", resp.StatusCode, oauthErr)
+	}
+	tokens := oauthTokenResponse{}
+	resp = postOAuthForm(t, server.URL+"/api/oauth/token", app, tokenForm(code, verifier), &tokens)
+	if resp.StatusCode != http.StatusOK || tokens.TokenType != "Bearer" || tokens.Scope != "chirps:read chirps:write" {
+		t.Fatalf("expected tokens for the code, got %d %+v", resp.StatusCode, tokens)
+	}
+
+	//the access token works within its scopes only
+	resp = doJSON(t, "POST", server.URL+"/api/chirps", tokens.AccessToken, chirp{Body: "posted by an app"}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected the app to post as alice, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "PATCH", server.URL+"/api/users", tokens.AccessToken, map[string]string{"bio": "hacked"}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 without profile:write, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/oauth/authorize", tokens.AccessToken, request, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected an app not to approve other apps, got %d", resp.StatusCode)
+	}
+	pat := personalToken{}
+	doJSON(t, "POST", server.URL+"/api/tokens", alice.TokenJWT, personalTokenRequest{Name: "bot", Scopes: auth.AllScopes}, &pat)
+	resp = doJSON(t, "POST", server.URL+"/api/oauth/authorize", pat.Token, request, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a personal access token not to approve apps, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/tokens", tokens.AccessToken, personalTokenRequest{Name: "keep", Scopes: []string{"chirps:read"}}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected an app not to mint a personal access token, got %d", resp.StatusCode)
+	}
+
+	//introspection sees the live tokens
+	info := oauthIntrospection{}
+	postOAuthForm(t, server.URL+"/api/oauth/introspect", app, url.Values{"token": {tokens.AccessToken}}, &info)
+	if !info.Active || info.Sub != alice.ID.String() || info.ClientID != app.ID.String() {
+		t.Fatalf("expected the access token to be active for alice, got %+v", info)
+	}
+	info = oauthIntrospection{}
+	postOAuthForm(t, server.URL+"/api/oauth/introspect", app, url.Values{"token": {alice.TokenJWT}}, &info)
+	if info.Active {
+		t.Fatalf("expected a token from another client to be inactive, got %+v", info)
+	}
+
+	//refreshing rotates, and the refresh token only works for its client
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", tokens.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a client's refresh token not to work at /api/refresh, got %d", resp.StatusCode)
+	}
+	refreshed := oauthTokenResponse{}
+	resp = postOAuthForm(t, server.URL+"/api/oauth/token", app, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}, &refreshed)
+	if resp.StatusCode != http.StatusOK || refreshed.RefreshToken == tokens.RefreshToken || refreshed.Scope != tokens.Scope {
+		t.Fatalf("expected new tokens with the same scopes, got %d %+v", resp.StatusCode, refreshed)
+	}
+
+	//replaying the code revokes everything it was swapped for
+	oauthErr = oauthError{}
+	resp = postOAuthForm(t, server.URL+"/api/oauth/token", app, tokenForm(code, verifier), &oauthErr)
+	if resp.StatusCode != http.StatusBadRequest || oauthErr.Error != "invalid_grant" {
+		t.Fatalf("expected invalid_grant for a replayed code, got %d %+v", resp.StatusCode, oauthErr)
+	}
+	info = oauthIntrospection{}
+	postOAuthForm(t, server.URL+"/api/oauth/introspect", app, url.Values{"token": {refreshed.RefreshToken}}, &info)
+	if info.Active {
+		t.Fatalf("expected the grant to be revoked after the code was replayed")
+	}
+
+	//a fresh grant can be revoked by the client
+	code = approve(t, request).Get("code")
+	oauthErr = oauthError{}
+	resp = postOAuthForm(t, server.URL+"/api/oauth/token", app, tokenForm(code, "the-wrong-verifier-which-is-also-long-enough-for-pkce"), &oauthErr)
+	if resp.StatusCode != http.StatusBadRequest || oauthErr.Error != "invalid_grant" {
+		t.Fatalf("expected invalid_grant for a wrong code_verifier, got %d %+v", resp.StatusCode, oauthErr)
+	}
+	wrongRedirect := tokenForm(code, verifier)
+	wrongRedirect.Set("redirect_uri", "https://evil.example.com/callback")
+	oauthErr = oauthError{}
+	resp = postOAuthForm(t, server.URL+"/api/oauth/token", app, wrongRedirect, &oauthErr)
+	if resp.StatusCode != http.StatusBadRequest || oauthErr.Error != "invalid_grant" {
+		t.Fatalf("expected invalid_grant for a wrong redirect_uri, got %d %+v", resp.StatusCode, oauthErr)
+	}
+	//failed exchanges don't use the code up, so whoever saw it can't burn it for the app
+	tokens = oauthTokenResponse{}
+	resp = postOAuthForm(t, server.URL+"/api/oauth/token", app, tokenForm(code, verifier), &tokens)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the code to still work after failed exchanges, got %d", resp.StatusCode)
+	}
+	resp = postOAuthForm(t, server.URL+"/api/oauth/revoke", app, url.Values{"token": {tokens.RefreshToken}}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 revoking a token, got %d", resp.StatusCode)
+	}
+	oauthErr = oauthError{}
+	postOAuthForm(t, server.URL+"/api/oauth/token", app, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}, &oauthErr)
+	if oauthErr.Error != "invalid_grant" {
+		t.Fatalf("expected a revoked refresh token to be rejected, got %+v", oauthErr)
+	}
+}
+
+func TestOAuthPublicClient(t *testing.T) {
+	_, server := newTestServer(t)
+	dev := signup(t, server, "dev@example.com", "hunter2")
+
+	app := oauthClient{}
+	doJSON(t, "POST", server.URL+"/api/oauth/clients", dev.TokenJWT, oauthClientRequest{Name: "cli", RedirectURIs: []string{"http://127.0.0.1:8765/callback"}, Public: true}, &app)
+	if !app.Public || app.Secret != "" {
+		t.Fatalf("expected a public client without a secret, got %+v", app)
+	}
+	request := oauthAuthorizeRequest{
+		ResponseType: "code",
+		ClientID:     app.ID.String(),
+		RedirectURI:  "http://127.0.0.1:8765/callback",
+		State:        "abc",
+		Approve:      true,
+	}
+	oauthErr := oauthError{}
+	resp := doJSON(t, "POST", server.URL+"/api/oauth/authorize", dev.TokenJWT, request, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a PKCE challenge, got %d", resp.StatusCode)
+	}
+
+	verifier := strings.Repeat("v", 43)
+	request.CodeChallenge = auth.PKCEChallenge(verifier)
+	request.CodeChallengeMethod = "S256"
+	answer := map[string]string{}
+	doJSON(t, "POST", server.URL+"/api/oauth/authorize", dev.TokenJWT, request, &answer)
+	redirect, _ := url.Parse(answer["redirect_to"])
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {redirect.Query().Get("code")},
+		"redirect_uri":  {request.RedirectURI},
+		"code_verifier": {verifier},
+	}
+	tokens := oauthTokenResponse{}
+	resp = postOAuthForm(t, server.URL+"/api/oauth/token", app, form, &tokens)
+	if resp.StatusCode != http.StatusOK || tokens.Scope != "chirps:read" {
+		t.Fatalf("expected tokens with the default scope, got %d %+v", resp.StatusCode, tokens)
+	}
+	resp = postOAuthForm(t, server.URL+"/api/oauth/introspect", app, url.Values{"token": {tokens.AccessToken}}, &oauthErr)
+	if resp.StatusCode != http.StatusUnauthorized || oauthErr.Error != "invalid_client" {
+		t.Fatalf("expected public clients not to introspect, got %d %+v", resp.StatusCode, oauthErr)
+	}
+
+	//the grant shows up in the user's sessions and goes away with the client
+	sessions := []session{}
+	doJSON(t, "GET", server.URL+"/api/sessions", dev.TokenJWT, nil, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("expected the login and the app's grant, got %+v", sessions)
+	}
+	resp = doJSON(t, "DELETE", server.URL+"/api/oauth/clients/"+app.ID.String(), dev.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting client, got %d", resp.StatusCode)
+	}
+	sessions = []session{}
+	doJSON(t, "GET", server.URL+"/api/sessions", dev.TokenJWT, nil, &sessions)
+	if len(sessions) != 1 || sessions[0].ClientID != nil {
+		t.Fatalf("expected only the login left, got %+v", sessions)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	cfg, server := newTestServer(t)
+	//this test runs out a challenge's attempts, which would otherwise lock the account
+	cfg.loginLimits.AccountFailures = 0
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	creds := AuthUser{Email: "alice@example.com", Password: "hunter2"}
+
+	pat := personalToken{}
+	doJSON(t, "POST", server.URL+"/api/tokens", alice.TokenJWT, personalTokenRequest{Name: "bot", Scopes: auth.AllScopes}, &pat)
+	resp := doJSON(t, "POST", server.URL+"/api/users/2fa/totp", pat.Token, nil, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a personal access token to be refused, got %d", resp.StatusCode)
+	}
+	enrollment := totpEnrollment{}
+	resp = doJSON(t, "POST", server.URL+"/api/users/2fa/totp", alice.TokenJWT, nil, &enrollment)
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/") {
+		t.Fatalf("expected a secret and provisioning uri, got %d %+v", resp.StatusCode, enrollment)
+	}
+	//not on until confirmed, so logging in still hands out tokens
+	resp = doJSON(t, "POST", server.URL+"/api/login", "", creds, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected login to work before confirming, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/users/2fa/totp/confirm", alice.TokenJWT, secondFactor{Code: "000000"}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a wrong code, got %d", resp.StatusCode)
+	}
+	step := auth.TOTPStep(time.Now())
+	code, _ := auth.TOTPCode(enrollment.Secret, step)
+	recovery := totpRecoveryCodes{}
+	resp = doJSON(t, "POST", server.URL+"/api/users/2fa/totp/confirm", alice.TokenJWT, secondFactor{Code: code}, &recovery)
+	if resp.StatusCode != http.StatusOK || len(recovery.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("expected recovery codes, got %d %+v", resp.StatusCode, recovery)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/users/2fa/totp", alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 enrolling with 2FA on, got %d", resp.StatusCode)
+	}
+
+	challenge := loginChallenge{}
+	resp = doJSON(t, "POST", server.URL+"/api/login", "", creds, &challenge)
+	if resp.StatusCode != http.StatusOK || !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("expected a challenge instead of tokens, got %d %+v", resp.StatusCode, challenge)
+	}
+	//the code used to confirm can't be played back
+	resp = doJSON(t, "POST", server.URL+"/api/login/2fa", "", loginChallengeRequest{ChallengeToken: challenge.ChallengeToken, secondFactor: secondFactor{Code: code}}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a used code to be refused, got %d", resp.StatusCode)
+	}
+	next, _ := auth.TOTPCode(enrollment.Secret, step+1)
+	loggedIn := User{}
+	resp = doJSON(t, "POST", server.URL+"/api/login/2fa", "", loginChallengeRequest{ChallengeToken: challenge.ChallengeToken, secondFactor: secondFactor{Code: next}}, &loggedIn)
+	if resp.StatusCode != http.StatusOK || loggedIn.TokenJWT == "" || loggedIn.RefreshToken == "" || loggedIn.ID != alice.ID {
+		t.Fatalf("expected tokens for alice, got %d %+v", resp.StatusCode, loggedIn)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/login/2fa", "", loginChallengeRequest{ChallengeToken: challenge.ChallengeToken, secondFactor: secondFactor{RecoveryCode: recovery.RecoveryCodes[0]}}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a used challenge to be refused, got %d", resp.StatusCode)
+	}
+
+	//too many wrong codes and the challenge is done for, even with a good code
+	doJSON(t, "POST", server.URL+"/api/login", "", creds, &challenge)
+	for range loginChallengeMaxAttempts {
+		doJSON(t, "POST", server.URL+"/api/login/2fa", "", loginChallengeRequest{ChallengeToken: challenge.ChallengeToken, secondFactor: secondFactor{Code: "000000"}}, nil)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/login/2fa", "", loginChallengeRequest{ChallengeToken: challenge.ChallengeToken, secondFactor: secondFactor{RecoveryCode: recovery.RecoveryCodes[0]}}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the challenge to be locked after too many attempts, got %d", resp.StatusCode)
+	}
+	doJSON(t, "POST", server.URL+"/api/login", "", creds, &challenge)
+	typed := strings.ToUpper(strings.ReplaceAll(recovery.RecoveryCodes[0], "-", ""))
+	resp = doJSON(t, "POST", server.URL+"/api/login/2fa", "", loginChallengeRequest{ChallengeToken: challenge.ChallengeToken, secondFactor: secondFactor{RecoveryCode: typed}}, &loggedIn)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected a recovery code to log in, got %d", resp.StatusCode)
+	}
+
+	disable := totpDisableRequest{Password: "wrong", secondFactor: secondFactor{RecoveryCode: recovery.RecoveryCodes[1]}}
+	resp = doJSON(t, "DELETE", server.URL+"/api/users/2fa/totp", loggedIn.TokenJWT, disable, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected disabling to need the password, got %d", resp.StatusCode)
+	}
+	disable = totpDisableRequest{Password: "hunter2", secondFactor: secondFactor{RecoveryCode: recovery.RecoveryCodes[0]}}
+	resp = doJSON(t, "DELETE", server.URL+"/api/users/2fa/totp", loggedIn.TokenJWT, disable, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a used recovery code to be refused, got %d", resp.StatusCode)
+	}
+	disable.RecoveryCode = recovery.RecoveryCodes[1]
+	resp = doJSON(t, "DELETE", server.URL+"/api/users/2fa/totp", loggedIn.TokenJWT, disable, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 disabling 2FA, got %d", resp.StatusCode)
+	}
+	loggedIn = User{}
+	resp = doJSON(t, "POST", server.URL+"/api/login", "", creds, &loggedIn)
+	if resp.StatusCode != http.StatusOK || loggedIn.TokenJWT == "" {
+		t.Fatalf("expected login to hand out tokens again, got %d %+v", resp.StatusCode, loggedIn)
+	}
+}
+
+func TestPasskeys(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bob := signup(t, server, "bob@example.com", "password")
+	phone := webauthntest.New("http://localhost:8080")
+
+	pat := personalToken{}
+	doJSON(t, "POST", server.URL+"/api/tokens", alice.TokenJWT, personalTokenRequest{Name: "bot", Scopes: auth.AllScopes}, &pat)
+	resp := doJSON(t, "POST", server.URL+"/api/passkeys/register/begin", pat.Token, nil, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a personal access token to be refused, got %d", resp.StatusCode)
+	}
+	creation := passkeyCreationOptions{}
+	resp = doJSON(t, "POST", server.URL+"/api/passkeys/register/begin", alice.TokenJWT, nil, &creation)
+	if resp.StatusCode != http.StatusOK || creation.PublicKey.RP.ID != "localhost" || creation.PublicKey.User.Name != "alice@example.com" {
+		t.Fatalf("expected creation options for alice, got %d %+v", resp.StatusCode, creation)
+	}
+	created, err := phone.Create(creation.PublicKey)
+	if err != nil {
+		t.Fatalf("unable to create passkey: %v", err)
+	}
+	//bob can't finish a registration alice started
+	resp = doJSON(t, "POST", server.URL+"/api/passkeys", bob.TokenJWT, passkeyRegistration{Credential: created, CurrentPassword: "password"}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 finishing someone else's registration, got %d", resp.StatusCode)
+	}
+	doJSON(t, "POST", server.URL+"/api/passkeys/register/begin", alice.TokenJWT, nil, &creation)
+	created, _ = phone.Create(creation.PublicKey)
+	//a login token alone isn't enough, adding a passkey needs the password too
+	for _, password := range []string{"", "wrong"} {
+		resp = doJSON(t, "POST", server.URL+"/api/passkeys", alice.TokenJWT, passkeyRegistration{Name: "phone", Credential: created, CurrentPassword: password}, nil)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected 401 adding a passkey with password %q, got %d", password, resp.StatusCode)
+		}
+	}
+	registered := passkey{}
+	resp = doJSON(t, "POST", server.URL+"/api/passkeys", alice.TokenJWT, passkeyRegistration{Name: "phone", Credential: created, CurrentPassword: "hunter2"}, &registered)
+	if resp.StatusCode != http.StatusCreated || registered.Name != "phone" || !slices.Equal(registered.Transports, []string{"internal"}) {
+		t.Fatalf("expected the passkey to be registered, got %d %+v", resp.StatusCode, registered)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/passkeys", alice.TokenJWT, passkeyRegistration{Name: "again", Credential: created, CurrentPassword: "hunter2"}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a used registration challenge to be refused, got %d", resp.StatusCode)
+	}
+	doJSON(t, "POST", server.URL+"/api/passkeys/register/begin", alice.TokenJWT, nil, &creation)
+	if len(creation.PublicKey.ExcludeCredentials) != 1 {
+		t.Fatalf("expected the registered passkey to be excluded, got %+v", creation.PublicKey.ExcludeCredentials)
+	}
+
+	request := passkeyRequestOptions{}
+	resp = doJSON(t, "POST", server.URL+"/api/login/passkey/begin", "", nil, &request)
+	if resp.StatusCode != http.StatusOK || request.PublicKey.RPID != "localhost" {
+		t.Fatalf("expected request options, got %d %+v", resp.StatusCode, request)
+	}
+	assertion, err := phone.Get(request.PublicKey)
+	if err != nil {
+		t.Fatalf("unable to sign in: %v", err)
+	}
+	loggedIn := User{}
+	resp = doJSON(t, "POST", server.URL+"/api/login/passkey", "", passkeyLoginRequest{Credential: assertion}, &loggedIn)
+	if resp.StatusCode != http.StatusOK || loggedIn.ID != alice.ID || loggedIn.TokenJWT == "" || loggedIn.RefreshToken == "" {
+		t.Fatalf("expected tokens for alice, got %d %+v", resp.StatusCode, loggedIn)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/refresh", loggedIn.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the refresh token to work, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/login/passkey", "", passkeyLoginRequest{Credential: assertion}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a replayed sign in to be refused, got %d", resp.StatusCode)
+	}
+	//a passkey that was never registered
+	doJSON(t, "POST", server.URL+"/api/login/passkey/begin", "", nil, &request)
+	stranger := webauthntest.New("http://localhost:8080")
+	stranger.Create(webauthn.CreationOptions{RP: webauthn.RelyingPartyEntity{ID: "localhost"}, User: webauthn.User{ID: []byte("nobody")}, PubKeyCredParams: creation.PublicKey.PubKeyCredParams})
+	unknown, _ := stranger.Get(request.PublicKey)
+	resp = doJSON(t, "POST", server.URL+"/api/login/passkey", "", passkeyLoginRequest{Credential: unknown}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an unknown passkey to be refused, got %d", resp.StatusCode)
+	}
+
+	passkeys := []passkey{}
+	resp = doJSON(t, "GET", server.URL+"/api/passkeys", alice.TokenJWT, nil, &passkeys)
+	if resp.StatusCode != http.StatusOK || len(passkeys) != 1 || passkeys[0].LastUsedAt == nil {
+		t.Fatalf("expected alice's passkey with a last use, got %d %+v", resp.StatusCode, passkeys)
+	}
+	resp = doJSON(t, "DELETE", server.URL+"/api/passkeys/"+registered.ID.String(), bob.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected bob not to find alice's passkey, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "DELETE", server.URL+"/api/passkeys/"+registered.ID.String(), alice.TokenJWT, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 removing the passkey, got %d", resp.StatusCode)
+	}
+	doJSON(t, "POST", server.URL+"/api/login/passkey/begin", "", nil, &request)
+	assertion, _ = phone.Get(request.PublicKey)
+	resp = doJSON(t, "POST", server.URL+"/api/login/passkey", "", passkeyLoginRequest{Credential: assertion}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a removed passkey to be refused, got %d", resp.StatusCode)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	cfg, server := newTestServer(t)
+	cfg.loginLimits = loginLimits{AccountFailures: 3, IPFailures: 6, Lockout: time.Hour, MaxLockout: time.Hour, Window: time.Hour}
+	signup(t, server, "alice@example.com", "hunter2")
+	signup(t, server, "bob@example.com", "password")
+	creds := AuthUser{Email: "alice@example.com", Password: "hunter2"}
+	login := func(creds AuthUser) (int, string) {
+		t.Helper()
+		resp := doJSON(t, "POST", server.URL+"/api/login", "", creds, nil)
+		body := chirpError{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.Error
+	}
+	unlock := func(key string, body unlockLoginRequest) int {
+		t.Helper()
+		var reqBody bytes.Buffer
+		json.NewEncoder(&reqBody).Encode(body)
+		req, _ := http.NewRequest("POST", server.URL+"/admin/login-locks/unlock", &reqBody)
+		req.Header.Set("Authorization", "ApiKey "+key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unlock failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	wrong := AuthUser{Email: "alice@example.com", Password: "wrong"}
+	var wrongStatus int
+	var wrongError string
+	for range 3 {
+		wrongStatus, wrongError = login(wrong)
+	}
+	if wrongStatus != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, got %d", wrongStatus)
+	}
+	//locked out, the right password gets exactly the wrong password's answer
+	if status, msg := login(creds); status != wrongStatus || msg != wrongError {
+		t.Fatalf("expected a locked login to look like a wrong password, got %d %q", status, msg)
+	}
+	if status, _ := login(AuthUser{Email: "bob@example.com", Password: "password"}); status != http.StatusOK {
+		t.Fatalf("expected bob to be unaffected, got %d", status)
+	}
+
+	if status := unlock("wrong-key", unlockLoginRequest{Email: "alice@example.com"}); status != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong admin key to be refused, got %d", status)
+	}
+	if status := unlock("test-admin-key", unlockLoginRequest{}); status != http.StatusBadRequest {
+		t.Fatalf("expected an empty unlock to be refused, got %d", status)
+	}
+	if status := unlock("test-admin-key", unlockLoginRequest{Email: "alice@example.com"}); status != http.StatusNoContent {
+		t.Fatalf("expected 204 unlocking, got %d", status)
+	}
+	if status, _ := login(creds); status != http.StatusOK {
+		t.Fatalf("expected alice to log in after the unlock, got %d", status)
+	}
+	if status := unlock("test-admin-key", unlockLoginRequest{Email: "alice@example.com"}); status != http.StatusNotFound {
+		t.Fatalf("expected a good login to have cleared alice's failures, got %d", status)
+	}
+
+	//the address has 3 failures so far, guessing at other emails runs it out
+	for _, email := range []string{"carol@example.com", "dave@example.com", "erin@example.com"} {
+		login(AuthUser{Email: email, Password: "guess"})
+	}
+	if status, msg := login(creds); status != wrongStatus || msg != wrongError {
+		t.Fatalf("expected the address to be locked out, got %d %q", status, msg)
+	}
+	if status := unlock("test-admin-key", unlockLoginRequest{IP: "127.0.0.1"}); status != http.StatusNoContent {
+		t.Fatalf("expected 204 unlocking the address, got %d", status)
+	}
+	if status, _ := login(creds); status != http.StatusOK {
+		t.Fatalf("expected alice to log in after the address unlock, got %d", status)
+	}
+
+	cfg.adminKey = ""
+	if status := unlock("", unlockLoginRequest{Email: "alice@example.com"}); status != http.StatusForbidden {
+		t.Fatalf("expected the admin api to be off without a key, got %d", status)
+	}
+}
+
+func TestLoginLockoutBackoff(t *testing.T) {
+	limits := loginLimits{Lockout: time.Minute, MaxLockout: 10 * time.Minute}
+	tests := []struct {
+		failures int
+		limit    int
+		want     time.Duration
+	}{
+		{failures: 4, limit: 5, want: 0},
+		{failures: 5, limit: 5, want: time.Minute},
+		{failures: 6, limit: 5, want: 2 * time.Minute},
+		{failures: 8, limit: 5, want: 8 * time.Minute},
+		{failures: 9, limit: 5, want: 10 * time.Minute},
+		{failures: 500, limit: 5, want: 10 * time.Minute},
+		{failures: 500, limit: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := limits.lockout(tt.failures, tt.limit); got != tt.want {
+			t.Errorf("lockout(%d, %d) = %v, want %v", tt.failures, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestUniformAuthResponses(t *testing.T) {
+	cfg, server := newTestServer(t)
+	mail := cfg.mailer.(*recordingMailer)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	login := func(creds AuthUser) (int, string) {
+		t.Helper()
+		resp := doJSON(t, "POST", server.URL+"/api/login", "", creds, nil)
+		body := chirpError{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body.Error
+	}
+	wrongStatus, wrongError := login(AuthUser{Email: "alice@example.com", Password: "wrong"})
+	if wrongStatus != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, got %d", wrongStatus)
+	}
+	if status, msg := login(AuthUser{Email: "nobody@example.com", Password: "wrong"}); status != wrongStatus || msg != wrongError {
+		t.Fatalf("expected an unknown email to look like a wrong password, got %d %q", status, msg)
+	}
+
+	//signing up with a taken email looks like a new signup, and the owner hears about it
+	mailed := len(mail.sent())
+	again := User{}
+	resp := doJSON(t, "POST", server.URL+"/api/users", "", AuthUser{Email: "alice@example.com", Password: "again"}, &again)
+	if resp.StatusCode != http.StatusCreated || again.Email != "alice@example.com" || again.ID == uuid.Nil || again.ID == alice.ID || again.EmailVerified {
+		t.Fatalf("expected a taken email to get a normal looking signup, got %d %+v", resp.StatusCode, again)
+	}
+	sent := mail.sent()
+	if len(sent) != mailed+1 || sent[mailed].To != "alice@example.com" || strings.Contains(sent[mailed].Body, "token") {
+		t.Fatalf("expected a notice for alice without a verification token, got %+v", sent[mailed:])
+	}
+	if status, _ := login(AuthUser{Email: "alice@example.com", Password: "again"}); status != wrongStatus {
+		t.Fatalf("expected the second signup's password not to work, got %d", status)
+	}
+	if status, _ := login(AuthUser{Email: "alice@example.com", Password: "hunter2"}); status != http.StatusOK {
+		t.Fatalf("expected alice's account to be untouched, got %d", status)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/users", "", userRequest{AuthUser: AuthUser{Email: "bob@example.com", Password: "pw"}, profileFields: profileFields{Handle: &alice.Handle}}, nil)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a taken handle to still be a 409, got %d", resp.StatusCode)
+	}
+}
+
+func TestCredentialChangesNeedLogin(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	profileBot := personalToken{}
+	doJSON(t, "POST", server.URL+"/api/tokens", alice.TokenJWT, personalTokenRequest{Name: "profile", Scopes: []string{"profile:write"}}, &profileBot)
+
+	resp := doJSON(t, "PATCH", server.URL+"/api/users", profileBot.Token, map[string]string{"bio": "from a bot"}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected profile:write to cover the bio, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "PATCH", server.URL+"/api/users", profileBot.Token, map[string]string{"email": "mallory@example.com"}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a personal access token not to change the email, got %d", resp.StatusCode)
+	}
+	takeover := userRequest{AuthUser: AuthUser{Email: "mallory@example.com", Password: "owned"}, CurrentPassword: "hunter2"}
+	resp = doJSON(t, "PUT", server.URL+"/api/users", profileBot.Token, takeover, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a personal access token not to change the email and password, got %d", resp.StatusCode)
+	}
+
+	change := userRequest{AuthUser: AuthUser{Email: "alice@example.org", Password: "new password"}}
+	resp = doJSON(t, "PUT", server.URL+"/api/users", alice.TokenJWT, change, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a new password to need the current one, got %d", resp.StatusCode)
+	}
+	change.CurrentPassword = "hunter2"
+	resp = doJSON(t, "PUT", server.URL+"/api/users", alice.TokenJWT, change, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 changing the email and password, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/login", "", AuthUser{Email: "alice@example.org", Password: "new password"}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the new email and password to log in, got %d", resp.StatusCode)
+	}
+}
+
+func TestReadOnlyTokenCantWrite(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bob := signup(t, server, "bob@example.com", "password")
+	posted := chirp{}
+	doJSON(t, "POST", server.URL+"/api/chirps", bob.TokenJWT, chirp{Body: "hello"}, &posted)
+	reader := personalToken{}
+	doJSON(t, "POST", server.URL+"/api/tokens", alice.TokenJWT, personalTokenRequest{Name: "reader", Scopes: []string{"chirps:read"}}, &reader)
+	app := oauthClient{}
+	doJSON(t, "POST", server.URL+"/api/oauth/clients", alice.TokenJWT, oauthClientRequest{Name: "app", RedirectURIs: []string{"https://app.example/cb"}}, &app)
+
+	for _, tc := range []struct {
+		method string
+		path   string
+		body   any
+	}{
+		{"POST", "/api/chirps/" + posted.Id.String() + "/rechirp", nil},
+		{"POST", "/api/chirps/" + posted.Id.String() + "/like", nil},
+		{"DELETE", "/api/chirps/" + posted.Id.String() + "/like", nil},
+		{"POST", "/api/users/" + bob.ID.String() + "/follow", nil},
+		{"POST", "/api/users/" + bob.ID.String() + "/block", nil},
+		{"POST", "/api/users/" + bob.ID.String() + "/mute", nil},
+		{"DELETE", "/api/sessions/" + uuid.NewString(), nil},
+		{"POST", "/api/sessions/logout-all", nil},
+		{"DELETE", "/api/tokens/" + reader.ID.String(), nil},
+		{"POST", "/api/oauth/clients", oauthClientRequest{Name: "other", RedirectURIs: []string{"https://other.example/cb"}}},
+		{"DELETE", "/api/oauth/clients/" + app.ID.String(), nil},
+	} {
+		resp := doJSON(t, tc.method, server.URL+tc.path, reader.Token, tc.body, nil)
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s %s: expected 403 for a read only token, got %d", tc.method, tc.path, resp.StatusCode)
+		}
+	}
+}
+
+func TestAccountListsNeedLogin(t *testing.T) {
+	_, server := newTestServer(t)
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	bot := personalToken{}
+	doJSON(t, "POST", server.URL+"/api/tokens", alice.TokenJWT, personalTokenRequest{Name: "bot", Scopes: auth.AllScopes}, &bot)
+
+	for _, path := range []string{"/api/tokens", "/api/passkeys", "/api/oauth/clients", "/api/sessions"} {
+		resp := doJSON(t, "GET", server.URL+path, bot.Token, nil, nil)
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("GET %s: expected 403 for a personal access token, got %d", path, resp.StatusCode)
+		}
+		resp = doJSON(t, "GET", server.URL+path, alice.TokenJWT, nil, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: expected 200 for a login token, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func TestPasswordChecksUseLockout(t *testing.T) {
+	cfg, server := newTestServer(t)
+	cfg.loginLimits = loginLimits{AccountFailures: 3, IPFailures: 100, Lockout: time.Hour, MaxLockout: time.Hour, Window: time.Hour}
+	alice := signup(t, server, "alice@example.com", "hunter2")
+	doJSON(t, "POST", server.URL+"/api/users/2fa/totp", alice.TokenJWT, nil, nil)
+
+	//guesses through the password change and 2FA endpoints count like failed logins
+	doJSON(t, "POST", server.URL+"/api/users/password", alice.TokenJWT, passwordChange{CurrentPassword: "guess1", NewPassword: "x"}, nil)
+	doJSON(t, "DELETE", server.URL+"/api/users/2fa/totp", alice.TokenJWT, totpDisableRequest{Password: "guess2"}, nil)
+	doJSON(t, "PUT", server.URL+"/api/users", alice.TokenJWT, userRequest{AuthUser: AuthUser{Email: "alice@example.com", Password: "x"}, CurrentPassword: "guess3"}, nil)
+
+	resp := doJSON(t, "POST", server.URL+"/api/users/password", alice.TokenJWT, passwordChange{CurrentPassword: "hunter2", NewPassword: "better"}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the right password to be refused while locked out, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "DELETE", server.URL+"/api/users/2fa/totp", alice.TokenJWT, totpDisableRequest{Password: "hunter2"}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected turning off 2FA to be refused while locked out, got %d", resp.StatusCode)
+	}
+	resp = doJSON(t, "POST", server.URL+"/api/login", "", AuthUser{Email: "alice@example.com", Password: "hunter2"}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected logging in to be locked out too, got %d", resp.StatusCode)
+	}
+}
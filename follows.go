@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+type followEdge struct {
+	UserId     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+func (cfg *apiConfig) usersFollowHandler(w http.ResponseWriter, r *http.Request) {
+	//follows a user, following them again is a no-op
+	//a block either way between the two of you is a 403, since blocking dropped those follows
+	cfg.setRelation(w, r, "follow", func(ctx context.Context, followerID, followeeID uuid.UUID) error {
+		for _, pair := range []database.IsBlockedParams{
+			{BlockerID: followeeID, BlockedID: followerID},
+			{BlockerID: followerID, BlockedID: followeeID},
+		} {
+			blocked, err := cfg.db.IsBlocked(ctx, pair)
+			if err != nil {
+				return err
+			}
+			if blocked {
+				return errBlocked
+			}
+		}
+		return cfg.db.FollowUser(ctx, database.FollowUserParams{
+			FollowerID: followerID,
+			FolloweeID: followeeID,
+			CreatedAt:  time.Now(),
+		})
+	})
+}
+
+func (cfg *apiConfig) usersUnfollowHandler(w http.ResponseWriter, r *http.Request) {
+	//unfollows a user, unfollowing someone you don't follow is a no-op
+	cfg.setRelation(w, r, "unfollow", func(ctx context.Context, followerID, followeeID uuid.UUID) error {
+		return cfg.db.UnfollowUser(ctx, database.UnfollowUserParams{
+			FollowerID: followerID,
+			FolloweeID: followeeID,
+		})
+	})
+}
+
+// setRelation does the auth and user lookup shared by following, blocking and muting
+// and their undos, then hands off to change with the caller and the user in the path
+func (cfg *apiConfig) setRelation(w http.ResponseWriter, r *http.Request, action string, change func(ctx context.Context, callerID, userID uuid.UUID) error) {
+	userID := r.PathValue("userID")
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing user ID: %v", err), http.StatusBadRequest)
+		return
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return
+	}
+	validatedUserID, scopes, err := cfg.authorize(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return
+	}
+	if !requireScope(w, scopes, auth.ScopeChirpsWrite) {
+		return
+	}
+	if userUUID == validatedUserID {
+		errHandler(w, fmt.Errorf("you can't %s yourself", action), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	_, err = cfg.db.GetUserById(ctx, userUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("user not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	err = change(ctx, validatedUserID, userUUID)
+	if errors.Is(err, errBlocked) {
+		errHandler(w, err, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error trying to %s user: %v", action, err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) usersFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	//the users following a user, most recent follow first
+	cfg.listFollows(w, r, func(ctx context.Context, userID uuid.UUID, page pageRequest) ([]followEdge, error) {
+		follows, err := cfg.db.ListFollowers(ctx, database.ListFollowersParams{
+			FolloweeID:      userID,
+			BeforeCreatedAt: page.Cursor.CreatedAt,
+			BeforeUserID:    page.Cursor.ID,
+			Limit:           fetchLimit(page.Limit),
+		})
+		edges := make([]followEdge, 0, len(follows))
+		for _, follow := range follows {
+			edges = append(edges, followEdge{UserId: follow.FollowerID, FollowedAt: follow.CreatedAt})
+		}
+		return edges, err
+	})
+}
+
+func (cfg *apiConfig) usersFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	//the users a user follows, most recent follow first
+	cfg.listFollows(w, r, func(ctx context.Context, userID uuid.UUID, page pageRequest) ([]followEdge, error) {
+		follows, err := cfg.db.ListFollowing(ctx, database.ListFollowingParams{
+			FollowerID:      userID,
+			BeforeCreatedAt: page.Cursor.CreatedAt,
+			BeforeUserID:    page.Cursor.ID,
+			Limit:           fetchLimit(page.Limit),
+		})
+		edges := make([]followEdge, 0, len(follows))
+		for _, follow := range follows {
+			edges = append(edges, followEdge{UserId: follow.FolloweeID, FollowedAt: follow.CreatedAt})
+		}
+		return edges, err
+	})
+}
+
+// listFollows pages through one side of a user's follows with the query picked by list
+func (cfg *apiConfig) listFollows(w http.ResponseWriter, r *http.Request, list func(ctx context.Context, userID uuid.UUID, page pageRequest) ([]followEdge, error)) {
+	userID := r.PathValue("userID")
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing user ID: %v", err), http.StatusBadRequest)
+		return
+	}
+	page, err := parseNewestFirstPage(r.URL.Query())
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing page: %v", err), http.StatusBadRequest)
+		return
+	}
+	edges, err := list(context.Background(), userUUID, page)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting follows: %v", err))
+		return
+	}
+	if len(edges) > page.Limit {
+		edges = edges[:page.Limit]
+		last := edges[len(edges)-1]
+		setNextLink(w, r, pageCursor{CreatedAt: last.FollowedAt, ID: last.UserId}.encode())
+	}
+
+	jsonResp, err := json.Marshal(edges)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing follows: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
+
+func (cfg *apiConfig) timelineHandler(w http.ResponseWriter, r *http.Request) {
+	//the caller's home timeline, chirps from everyone they follow, newest first
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return
+	}
+	validatedUserID, scopes, err := cfg.authorize(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return
+	}
+	if !requireScope(w, scopes, auth.ScopeChirpsRead) {
+		return
+	}
+	page, err := parseNewestFirstPage(r.URL.Query())
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing page: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	chirps, err := cfg.db.ListTimeline(ctx, database.ListTimelineParams{
+		BeforeCreatedAt: page.Cursor.CreatedAt,
+		BeforeID:        page.Cursor.ID,
+		Limit:           fetchLimit(page.Limit),
+		FollowerID:      validatedUserID,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting timeline: %v", err))
+		return
+	}
+	if len(chirps) > page.Limit {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		setNextLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode())
+	}
+	chirpsResp, err := cfg.listingViews(ctx, uuid.NullUUID{UUID: validatedUserID, Valid: true}, chirps)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting timeline: %v", err))
+		return
+	}
+	if err := cfg.embedAuthors(ctx, r, chirpsResp); err != nil {
+		errHandler(w, fmt.Errorf("error getting timeline: %v", err))
+		return
+	}
+
+	jsonResp, err := json.Marshal(chirpsResp)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing chirps: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
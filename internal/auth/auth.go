@@ -2,13 +2,13 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -26,37 +26,13 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
+// MakeJWT signs a token with a single shared secret, see KeySet for anything more
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	userIDStr := userID.String()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
-		Subject:   userIDStr,
-	})
-	tokenString, err := token.SignedString([]byte(tokenSecret))
-	if err != nil {
-		return "", fmt.Errorf("error signing token: %w", err)
-	}
-	return tokenString, nil
+	return NewKeySet(NewHMACKey("", tokenSecret)).MakeJWT(userID, expiresIn)
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("error parsing token: %w", err)
-	}
-	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
-		userID, err := uuid.Parse(claims.Subject)
-		if err != nil {
-			return uuid.Nil, fmt.Errorf("error parsing user ID: %w", err)
-		}
-		return userID, nil
-	}
-	return uuid.Nil, fmt.Errorf("invalid token")
-
+	return NewKeySet(NewHMACKey("", tokenSecret)).ValidateJWT(tokenString)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -73,6 +49,12 @@ func GetBearerToken(headers http.Header) (string, error) {
 }
 
 func MakeRefreshToken() (string, error) {
+	return MakeSecretToken()
+}
+
+// MakeSecretToken is 32 random bytes, hex encoded, for tokens that get handed
+// to a user and looked up again later
+func MakeSecretToken() (string, error) {
 	token := make([]byte, 32)
 	_, err := rand.Read(token)
 	if err != nil {
@@ -81,6 +63,13 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(token), nil
 }
 
+// HashToken is what gets stored for a single-use secret token, so someone
+// reading the table can't use the tokens in it
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	key := headers.Get("Authorization")
 	if key == "" {
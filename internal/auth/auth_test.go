@@ -1,9 +1,17 @@
 package auth
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -23,6 +31,45 @@ func TestHashPassword(t *testing.T) {
 	}
 }
 
+func TestHashToken(t *testing.T) {
+	token, err := MakeSecretToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if HashToken(token) != HashToken(token) {
+		t.Fatalf("expected hashing to be deterministic")
+	}
+	if HashToken(token) == token {
+		t.Fatalf("expected the hash to differ from the token")
+	}
+}
+
+func TestCheckPKCE(t *testing.T) {
+	//the example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Fatalf("expected challenge %s, got %s", challenge, got)
+	}
+	if !ValidPKCEChallenge(challenge) || ValidPKCEChallenge("short") {
+		t.Fatalf("expected only a 43 character base64url challenge to be valid")
+	}
+	tests := []struct {
+		verifier string
+		want     bool
+	}{
+		{verifier: verifier, want: true},
+		{verifier: verifier[:42] + "Y", want: false},
+		{verifier: "too-short", want: false},
+		{verifier: challenge, want: false},
+	}
+	for _, tt := range tests {
+		if got := CheckPKCE(tt.verifier, challenge); got != tt.want {
+			t.Fatalf("expected CheckPKCE(%q) to be %v", tt.verifier, tt.want)
+		}
+	}
+}
+
 func TestJWTCreateValidate(t *testing.T) {
 	userID := uuid.New()
 	tokenSecret := userID.String()
@@ -68,3 +115,165 @@ func TestJWTCreateValidateWrongSecret(t *testing.T) {
 		t.Fatalf("expected error for wrong secret")
 	}
 }
+
+func TestKeySetRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate rsa key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate ed25519 key: %v", err)
+	}
+	oldKey, newKey := NewRSAKey("2024", rsaKey), NewEd25519Key("2025", edKey)
+	userID := uuid.New()
+
+	oldToken, err := NewKeySet(oldKey).MakeJWT(userID, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to make token: %v", err)
+	}
+	rotated := NewKeySet(newKey, oldKey)
+	if got, err := rotated.ValidateJWT(oldToken); err != nil || got != userID {
+		t.Fatalf("expected a token from the retired key to stay valid, got %v (err %v)", got, err)
+	}
+	newToken, err := rotated.MakeJWT(userID, time.Minute)
+	if err != nil {
+		t.Fatalf("unable to make token: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	if err != nil || parsed.Header["kid"] != "2025" || parsed.Method.Alg() != "EdDSA" {
+		t.Fatalf("expected the new key to sign, got %v (err %v)", parsed.Header, err)
+	}
+	if _, err := NewKeySet(newKey).ValidateJWT(oldToken); err == nil {
+		t.Fatalf("expected a token from a dropped key to be rejected")
+	}
+}
+
+func TestKeySetRejectsAlgorithmSwap(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate rsa key: %v", err)
+	}
+	keys := NewKeySet(NewRSAKey("rsa", rsaKey))
+	//an HS256 token claiming the rsa key's kid, signed with its public key
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: uuid.New().String()})
+	forged.Header["kid"] = "rsa"
+	tokenString, err := forged.SignedString(x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey))
+	if err != nil {
+		t.Fatalf("unable to sign token: %v", err)
+	}
+	if _, err := keys.ValidateJWT(tokenString); err == nil {
+		t.Fatalf("expected a token with the wrong algorithm to be rejected")
+	}
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %v", err)
+	}
+	privateDER, _ := x509.MarshalPKCS8PrivateKey(private)
+	publicDER, _ := x509.MarshalPKIXPublicKey(public)
+	signer, err := ParseKeyPEM("current", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}))
+	if err != nil {
+		t.Fatalf("unable to parse private key: %v", err)
+	}
+	checker, err := ParseKeyPEM("current", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	if err != nil {
+		t.Fatalf("unable to parse public key: %v", err)
+	}
+	token, err := NewKeySet(signer).MakeJWT(uuid.New(), time.Minute)
+	if err != nil {
+		t.Fatalf("unable to make token: %v", err)
+	}
+	if _, err := NewKeySet(checker).ValidateJWT(token); err != nil {
+		t.Fatalf("expected the public key to check the token: %v", err)
+	}
+	if _, err := NewKeySet(checker).MakeJWT(uuid.New(), time.Minute); err == nil {
+		t.Fatalf("expected a public key not to sign")
+	}
+	if _, err := ParseKeyPEM("junk", []byte("not a key")); err == nil {
+		t.Fatalf("expected an error for a file with no PEM block")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unable to generate rsa key: %v", err)
+	}
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate ed25519 key: %v", err)
+	}
+	jwks := NewKeySet(NewEd25519Key("ed", private), NewRSAKey("rsa", rsaKey), NewHMACKey("", "secret")).JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected the shared secret to be left out, got %+v", jwks.Keys)
+	}
+	ed, rs := jwks.Keys[0], jwks.Keys[1]
+	if ed.Kid != "ed" || ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.X != base64.RawURLEncoding.EncodeToString(public) {
+		t.Fatalf("unexpected ed25519 jwk %+v", ed)
+	}
+	if rs.Kid != "rsa" || rs.Kty != "RSA" || rs.Alg != "RS256" || rs.E != "AQAB" || rs.N != base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()) {
+		t.Fatalf("unexpected rsa jwk %+v", rs)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	//the SHA1 vectors from RFC 6238 appendix B, cut down to 6 digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+	}
+	for _, tt := range tests {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil || got != tt.code {
+			t.Fatalf("expected code %s at %d, got %s (err %v)", tt.code, tt.unix, got, err)
+		}
+	}
+
+	now := time.Unix(1111111111, 0)
+	step, ok := CheckTOTP(secret, "050471", now.Add(25*time.Second))
+	if !ok || step != TOTPStep(now) {
+		t.Fatalf("expected a code from the step before to be accepted")
+	}
+	if _, ok := CheckTOTP(secret, "050471", now.Add(2*time.Minute)); ok {
+		t.Fatalf("expected a stale code to be rejected")
+	}
+	if _, ok := CheckTOTP(secret, "50471", now); ok {
+		t.Fatalf("expected a short code to be rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	secret, err := MakeTOTPSecret()
+	if err != nil {
+		t.Fatalf("unable to make secret: %v", err)
+	}
+	uri := TOTPProvisioningURI(secret, "Chirpy", "alice@example.com")
+	want := "otpauth://totp/Chirpy:alice@example.com?algorithm=SHA1&digits=6&issuer=Chirpy&period=30&secret=" + secret
+	if uri != want {
+		t.Fatalf("expected %s, got %s", want, uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	code, err := MakeRecoveryCode()
+	if err != nil {
+		t.Fatalf("unable to make recovery code: %v", err)
+	}
+	if len(code) != 19 || strings.Count(code, "-") != 3 {
+		t.Fatalf("expected a code like xxxx-xxxx-xxxx-xxxx, got %s", code)
+	}
+	typed := " " + strings.ToUpper(strings.ReplaceAll(code, "-", "")) + " "
+	if NormalizeRecoveryCode(typed) != code {
+		t.Fatalf("expected %q to normalize to %s", typed, code)
+	}
+}
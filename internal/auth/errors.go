@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenError is why an access token was turned away, Code is stable enough for
+// clients to act on, like refreshing when it's token_expired
+type TokenError struct {
+	Code    string
+	Message string
+}
+
+func (e *TokenError) Error() string {
+	return e.Message
+}
+
+var (
+	ErrTokenExpired     = &TokenError{Code: "token_expired", Message: "token has expired"}
+	ErrTokenNotYetValid = &TokenError{Code: "token_not_yet_valid", Message: "token isn't valid yet"}
+	ErrTokenSignature   = &TokenError{Code: "bad_signature", Message: "token signature is invalid"}
+	ErrTokenAudience    = &TokenError{Code: "wrong_audience", Message: "token is for a different audience"}
+	ErrTokenIssuer      = &TokenError{Code: "wrong_issuer", Message: "token has the wrong issuer"}
+	ErrTokenMalformed   = &TokenError{Code: "malformed_token", Message: "token is malformed"}
+	ErrTokenUnknown     = &TokenError{Code: "unknown_token", Message: "token doesn't exist, was revoked or has expired"}
+)
+
+// tokenError turns what the jwt library returned into one of the errors above,
+// the signature is checked before any claims so a forged token never reads as expired
+func tokenError(err error, claims *jwt.RegisteredClaims) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return ErrTokenSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrTokenNotYetValid
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrTokenAudience
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing) && len(claims.Audience) == 0:
+		//a token with no audience at all was meant for somebody else
+		return ErrTokenAudience
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrTokenIssuer
+	default:
+		return ErrTokenMalformed
+	}
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestValidateJWTClaims(t *testing.T) {
+	userID := uuid.New()
+	now := time.Now()
+	valid := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Audience:  jwt.ClaimStrings{"chirpy"},
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		}
+	}
+	tests := []struct {
+		name    string
+		method  jwt.SigningMethod
+		secret  any
+		kid     string
+		claims  func(c *jwt.RegisteredClaims)
+		leeway  time.Duration
+		wantErr error
+	}{
+		{name: "valid"},
+		{
+			name:    "expired",
+			claims:  func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) },
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name:   "expired within leeway",
+			claims: func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second)) },
+			leeway: 30 * time.Second,
+		},
+		{
+			name:    "issued in the future",
+			claims:  func(c *jwt.RegisteredClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(5 * time.Minute)) },
+			leeway:  30 * time.Second,
+			wantErr: ErrTokenNotYetValid,
+		},
+		{
+			name:   "not before within leeway",
+			claims: func(c *jwt.RegisteredClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(10 * time.Second)) },
+			leeway: 30 * time.Second,
+		},
+		{
+			name:    "wrong audience",
+			claims:  func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"someone-else"} },
+			wantErr: ErrTokenAudience,
+		},
+		{
+			name:    "missing audience",
+			claims:  func(c *jwt.RegisteredClaims) { c.Audience = nil },
+			wantErr: ErrTokenAudience,
+		},
+		{
+			name:    "wrong issuer",
+			claims:  func(c *jwt.RegisteredClaims) { c.Issuer = "not-chirpy" },
+			wantErr: ErrTokenIssuer,
+		},
+		{
+			name:    "missing expiry",
+			claims:  func(c *jwt.RegisteredClaims) { c.ExpiresAt = nil },
+			wantErr: ErrTokenMalformed,
+		},
+		{
+			name:    "subject isn't a user",
+			claims:  func(c *jwt.RegisteredClaims) { c.Subject = "admin" },
+			wantErr: ErrTokenMalformed,
+		},
+		{
+			name:    "wrong secret",
+			secret:  []byte("wrong"),
+			wantErr: ErrTokenSignature,
+		},
+		{
+			name:    "expired and wrong secret",
+			secret:  []byte("wrong"),
+			claims:  func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) },
+			wantErr: ErrTokenSignature,
+		},
+		{
+			name:    "algorithm not pinned",
+			method:  jwt.SigningMethodHS512,
+			wantErr: ErrTokenSignature,
+		},
+		{
+			name:    "unsigned",
+			method:  jwt.SigningMethodNone,
+			secret:  jwt.UnsafeAllowNoneSignatureType,
+			wantErr: ErrTokenSignature,
+		},
+		{
+			name:    "unknown kid",
+			kid:     "other",
+			wantErr: ErrTokenSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := NewKeySet(NewHMACKey("", "secret"))
+			keys.Leeway = tt.leeway
+			claims := valid()
+			if tt.claims != nil {
+				tt.claims(&claims)
+			}
+			method, secret := tt.method, tt.secret
+			if method == nil {
+				method = jwt.SigningMethodHS256
+			}
+			if secret == nil {
+				secret = []byte("secret")
+			}
+			token := jwt.NewWithClaims(method, claims)
+			if tt.kid != "" {
+				token.Header["kid"] = tt.kid
+			}
+			tokenString, err := token.SignedString(secret)
+			if err != nil {
+				t.Fatalf("unable to sign token: %v", err)
+			}
+
+			got, err := keys.ValidateJWT(tokenString)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && got != userID {
+				t.Fatalf("expected user %v, got %v", userID, got)
+			}
+		})
+	}
+}
+
+func TestValidateJWTErrorCodes(t *testing.T) {
+	keys := NewKeySet(NewHMACKey("", "secret"))
+	expired, err := keys.MakeJWT(uuid.New(), -time.Minute)
+	if err != nil {
+		t.Fatalf("unable to make token: %v", err)
+	}
+	tests := []struct {
+		token string
+		code  string
+	}{
+		{token: "not.a.token", code: "malformed_token"},
+		{token: "", code: "malformed_token"},
+		{token: expired, code: "token_expired"},
+	}
+	for _, tt := range tests {
+		_, err := keys.ValidateJWT(tt.token)
+		var tokenErr *TokenError
+		if !errors.As(err, &tokenErr) || tokenErr.Code != tt.code {
+			t.Fatalf("expected code %s for %q, got %v", tt.code, tt.token, err)
+		}
+	}
+}
+
+func TestKeySetAudience(t *testing.T) {
+	api := NewKeySet(NewHMACKey("", "secret"))
+	other := NewKeySet(NewHMACKey("", "secret"))
+	other.Audience = "chirpy-admin"
+	token, err := other.MakeJWT(uuid.New(), time.Minute)
+	if err != nil {
+		t.Fatalf("unable to make token: %v", err)
+	}
+	if _, err := api.ValidateJWT(token); !errors.Is(err, ErrTokenAudience) {
+		t.Fatalf("expected a token for another audience to be rejected, got %v", err)
+	}
+	if _, err := other.ValidateJWT(token); err != nil {
+		t.Fatalf("expected the token to validate for its own audience: %v", err)
+	}
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	keys := NewKeySet(NewHMACKey("", "secret"))
+	userID := uuid.New()
+	for _, scopes := range [][]string{AllScopes, {ScopeChirpsRead}, nil} {
+		token, err := keys.MakeJWT(userID, time.Minute, scopes...)
+		if err != nil {
+			t.Fatalf("unable to make token: %v", err)
+		}
+		gotUser, gotScopes, err := keys.ValidateAccessToken(token)
+		if err != nil || gotUser != userID {
+			t.Fatalf("unable to validate token: %v", err)
+		}
+		if len(gotScopes) != len(scopes) || len(scopes) > 0 && !slices.Equal(gotScopes, scopes) {
+			t.Fatalf("expected scopes %v, got %v", scopes, gotScopes)
+		}
+	}
+}
+
+func TestClientAccessToken(t *testing.T) {
+	keys := NewKeySet(NewHMACKey("", "secret"))
+	userID, clientID := uuid.New(), uuid.New()
+	token, err := keys.MakeClientJWT(userID, clientID.String(), time.Minute, ScopeChirpsRead)
+	if err != nil {
+		t.Fatalf("unable to make token: %v", err)
+	}
+	claims, err := keys.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("unable to parse token: %v", err)
+	}
+	if claims.Subject != userID.String() || claims.ClientID != clientID.String() || claims.Scope != ScopeChirpsRead {
+		t.Fatalf("expected the token to name the user, client and scope, got %+v", claims)
+	}
+	plain, _ := keys.MakeJWT(userID, time.Minute)
+	if claims, _ := keys.ParseAccessToken(plain); claims.ClientID != "" {
+		t.Fatalf("expected a login token to have no client, got %q", claims.ClientID)
+	}
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// SigningKey is one key a KeySet signs or checks tokens with, its ID goes in
+// the kid header of every token it signs
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// NewHMACKey is a shared secret key, it can't be published in a JWKS
+func NewHMACKey(id, secret string) SigningKey {
+	return SigningKey{ID: id, Method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)}
+}
+
+func NewRSAKey(id string, key *rsa.PrivateKey) SigningKey {
+	return SigningKey{ID: id, Method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey}
+}
+
+func NewEd25519Key(id string, key ed25519.PrivateKey) SigningKey {
+	return SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, signKey: key, verifyKey: key.Public()}
+}
+
+// ParseKeyPEM reads an RSA or Ed25519 key, a private key can sign and a public key
+// can only check tokens, which is all a retired key has left to do
+func ParseKeyPEM(id string, data []byte) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("key %q: no PEM block found", id)
+	}
+	var parsed any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("key %q: %w", id, err)
+	}
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return NewRSAKey(id, key), nil
+	case ed25519.PrivateKey:
+		return NewEd25519Key(id, key), nil
+	case *rsa.PublicKey:
+		return SigningKey{ID: id, Method: jwt.SigningMethodRS256, verifyKey: key}, nil
+	case ed25519.PublicKey:
+		return SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, verifyKey: key}, nil
+	default:
+		return SigningKey{}, fmt.Errorf("key %q: unsupported key type %T", id, parsed)
+	}
+}
+
+// LoadKeyDir reads every .pem file in dir, named after the key's ID
+func LoadKeyDir(dir string) ([]SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing keys: %w", err)
+	}
+	keys := make([]SigningKey, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading key: %w", err)
+		}
+		key, err := ParseKeyPEM(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// KeySet signs new tokens with its current key and accepts tokens from any key in it.
+// To rotate, make the new key current and keep the old one in the set until the
+// last token it signed has expired.
+type KeySet struct {
+	current SigningKey
+	keys    map[string]SigningKey
+	// Issuer and Audience are set on every token and checked on every token
+	Issuer   string
+	Audience string
+	// Leeway is how far apart the clocks of the signer and the checker may be
+	Leeway time.Duration
+}
+
+func NewKeySet(current SigningKey, retired ...SigningKey) *KeySet {
+	keys := map[string]SigningKey{current.ID: current}
+	for _, key := range retired {
+		if _, ok := keys[key.ID]; !ok {
+			keys[key.ID] = key
+		}
+	}
+	return &KeySet{current: current, keys: keys, Issuer: "chirpy", Audience: "chirpy"}
+}
+
+// AccessClaims are what an access token says, Scope is space separated and
+// ClientID is set when the token was issued to an OAuth client
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// MakeJWT signs an access token for a user that carries the given scopes
+func (ks *KeySet) MakeJWT(userID uuid.UUID, expiresIn time.Duration, scopes ...string) (string, error) {
+	return ks.MakeClientJWT(userID, "", expiresIn, scopes...)
+}
+
+// MakeClientJWT is MakeJWT for a token an OAuth client acts on the user's behalf with
+func (ks *KeySet) MakeClientJWT(userID uuid.UUID, clientID string, expiresIn time.Duration, scopes ...string) (string, error) {
+	if ks.current.signKey == nil {
+		return "", fmt.Errorf("key %q can't sign tokens", ks.current.ID)
+	}
+	token := jwt.NewWithClaims(ks.current.Method, AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    ks.Issuer,
+			Audience:  jwt.ClaimStrings{ks.Audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+		Scope:    JoinScopes(scopes),
+		ClientID: clientID,
+	})
+	if ks.current.ID != "" {
+		token.Header["kid"] = ks.current.ID
+	}
+	tokenString, err := token.SignedString(ks.current.signKey)
+	if err != nil {
+		return "", fmt.Errorf("error signing token: %w", err)
+	}
+	return tokenString, nil
+}
+
+// ValidateJWT checks the signature, issuer, audience and lifetime of a token and
+// returns its user. Anything wrong comes back as one of the ErrToken errors.
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	userID, _, err := ks.ValidateAccessToken(tokenString)
+	return userID, err
+}
+
+// ValidateAccessToken is ValidateJWT that also returns the token's scopes
+func (ks *KeySet) ValidateAccessToken(tokenString string) (uuid.UUID, []string, error) {
+	claims, err := ks.ParseAccessToken(tokenString)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, nil, ErrTokenMalformed
+	}
+	return userID, SplitScopes(claims.Scope), nil
+}
+
+// ParseAccessToken checks a token the same way as ValidateJWT and returns all of its claims
+func (ks *KeySet) ParseAccessToken(tokenString string) (*AccessClaims, error) {
+	methods := make([]string, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		methods = append(methods, key.Method.Alg())
+	}
+	keyFunc := func(token *jwt.Token) (interface{}, error) {
+		//tokens without a kid are looked up as the key with no ID
+		kid, _ := token.Header["kid"].(string)
+		key, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		//a token can't pick how its own signature gets checked
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("key %q doesn't sign with %s", kid, token.Method.Alg())
+		}
+		return key.verifyKey, nil
+	}
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, keyFunc,
+		jwt.WithValidMethods(methods),
+		jwt.WithIssuer(ks.Issuer),
+		jwt.WithAudience(ks.Audience),
+		jwt.WithLeeway(ks.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, tokenError(err, &claims.RegisteredClaims)
+	}
+	return claims, nil
+}
+
+// JWK is the public half of a key, as published at /.well-known/jwks.json
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys in the set, shared secrets are left out
+func (ks *KeySet) JWKS() JWKS {
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	jwks := JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		key := ks.keys[id]
+		jwk := JWK{Kid: id, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// a PKCE code verifier is 43 to 128 unreserved characters (RFC 7636 section 4.1),
+// and an S256 challenge is the base64url sha256 of one, which is always 43 long
+var (
+	codeVerifierPattern  = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+	codeChallengePattern = regexp.MustCompile(`^[A-Za-z0-9\-_]{43}$`)
+)
+
+// PKCEChallenge is the S256 code challenge for a verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ValidPKCEChallenge reports whether challenge could have come from PKCEChallenge
+func ValidPKCEChallenge(challenge string) bool {
+	return codeChallengePattern.MatchString(challenge)
+}
+
+// CheckPKCE reports whether verifier is the one challenge was made from.
+// Only S256 is supported, a plain challenge gives nothing away to check.
+func CheckPKCE(verifier, challenge string) bool {
+	if !codeVerifierPattern.MatchString(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
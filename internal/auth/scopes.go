@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// scopes limit what a token can do, tokens from logging in get all of them
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+var AllScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// PersonalTokenPrefix starts every personal access token, so they can't be
+// mistaken for a JWT and are easy to spot when they leak
+const PersonalTokenPrefix = "chirpy_pat_"
+
+func ValidScope(scope string) bool {
+	return slices.Contains(AllScopes, scope)
+}
+
+func HasScope(scopes []string, scope string) bool {
+	return slices.Contains(scopes, scope)
+}
+
+// JoinScopes and SplitScopes convert to and from the space separated form
+// used in the scope claim and the database
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func SplitScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
@@ -0,0 +1,111 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(&buf)
+	err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "hello", Body: "the body"})
+	if err != nil {
+		t.Fatalf("unable to send: %v", err)
+	}
+	for _, want := range []string{"To: a@example.com", "Subject: hello", "the body"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("expected %q in %q", want, buf.String())
+		}
+	}
+}
+
+// fakeSMTP accepts one connection, speaks just enough SMTP for net/smtp
+// and hands back the recipients and message data it saw
+func fakeSMTP(t *testing.T) (string, <-chan []string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	got := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		var seen []string
+		reply("220 localhost fake smtp")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			switch verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); verb {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL":
+				reply("250 ok")
+			case "RCPT":
+				seen = append(seen, line)
+				reply("250 ok")
+			case "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					dataLine, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				seen = append(seen, data.String())
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				got <- seen
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), got
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, got := fakeSMTP(t)
+	m := NewSMTPMailer(addr, "chirpy@example.com", nil)
+	err := m.Send(context.Background(), Message{
+		To:      "a@example.com",
+		Subject: "reset\r\nBcc: sneaky@example.com",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Fatalf("unable to send: %v", err)
+	}
+	seen := <-got
+	if len(seen) != 2 || !strings.Contains(seen[0], "<a@example.com>") {
+		t.Fatalf("expected one recipient then the data, got %q", seen)
+	}
+	data := seen[1]
+	if !strings.Contains(data, "Subject: reset  Bcc: sneaky@example.com\r\n") {
+		t.Fatalf("expected the subject kept on one line, got %q", data)
+	}
+	if !strings.Contains(data, "line one\r\nline two") {
+		t.Fatalf("expected the body with crlf line endings, got %q", data)
+	}
+}
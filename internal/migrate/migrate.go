@@ -0,0 +1,36 @@
+// Package migrate applies the goose migrations in sql/schema (postgres)
+// and sql/sqlite/schema (sqlite) from an embedded filesystem.
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// NewProvider returns a goose provider for the migrations in fsys.
+// Every run takes a session lock first so two chirpy instances
+// starting at the same time can't both migrate the same database.
+func NewProvider(db *sql.DB, dialect goose.Dialect, fsys fs.FS) (*goose.Provider, error) {
+	var locker lock.SessionLocker
+	var err error
+	switch dialect {
+	case goose.DialectPostgres:
+		locker, err = lock.NewPostgresSessionLocker()
+		if err != nil {
+			return nil, fmt.Errorf("error creating postgres lock: %w", err)
+		}
+	case goose.DialectSQLite3:
+		locker = NewSQLiteLocker()
+	default:
+		return nil, fmt.Errorf("unsupported migration dialect %q", dialect)
+	}
+	provider, err := goose.NewProvider(dialect, db, fsys, goose.WithSessionLocker(locker))
+	if err != nil {
+		return nil, fmt.Errorf("error loading migrations: %w", err)
+	}
+	return provider, nil
+}
@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
+)
+
+func openSQLite(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_time_format=sqlite")
+	if err != nil {
+		t.Fatalf("unable to open sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSQLiteUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t, filepath.Join(t.TempDir(), "chirpy.db"))
+	provider, err := NewProvider(db, goose.DialectSQLite3, os.DirFS("../../sql/sqlite/schema"))
+	if err != nil {
+		t.Fatalf("unable to create provider: %v", err)
+	}
+	results, err := provider.Up(ctx)
+	if err != nil {
+		t.Fatalf("unable to migrate up: %v", err)
+	}
+	if len(results) != len(provider.ListSources()) {
+		t.Fatalf("expected every migration to run, got %d", len(results))
+	}
+	if _, err := provider.Down(ctx); err != nil {
+		t.Fatalf("unable to migrate down: %v", err)
+	}
+	statuses, err := provider.Status(ctx)
+	if err != nil {
+		t.Fatalf("unable to get status: %v", err)
+	}
+	if statuses[len(statuses)-1].State != goose.StatePending {
+		t.Fatalf("expected the last migration to be pending after down")
+	}
+}
+
+func TestSQLiteConcurrentUp(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "chirpy.db")
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		provider, err := NewProvider(openSQLite(t, path), goose.DialectSQLite3, os.DirFS("../../sql/sqlite/schema"))
+		if err != nil {
+			t.Fatalf("unable to create provider: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = provider.Up(ctx)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("expected concurrent migrations to wait on the lock, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	createSQLiteLockTable = `CREATE TABLE IF NOT EXISTS chirpy_migration_lock (
+  id INTEGER PRIMARY KEY CHECK (id = 1),
+  locked_at TIMESTAMP NOT NULL
+)`
+	takeSQLiteLock    = `INSERT INTO chirpy_migration_lock (id, locked_at) VALUES (1, ?) ON CONFLICT (id) DO NOTHING`
+	clearStaleLock    = `DELETE FROM chirpy_migration_lock WHERE id = 1 AND locked_at < ?`
+	releaseSQLiteLock = `DELETE FROM chirpy_migration_lock WHERE id = 1`
+)
+
+// SQLiteLocker is a goose session locker for sqlite, which has no
+// advisory locks. It claims a single row in chirpy_migration_lock and
+// retries until the row is free. A lock older than staleAfter is
+// assumed to belong to a process that died mid migration and is
+// cleared.
+type SQLiteLocker struct {
+	retryEvery time.Duration
+	timeout    time.Duration
+	staleAfter time.Duration
+}
+
+func NewSQLiteLocker() *SQLiteLocker {
+	return &SQLiteLocker{
+		retryEvery: 500 * time.Millisecond,
+		timeout:    5 * time.Minute,
+		staleAfter: 15 * time.Minute,
+	}
+}
+
+func (l *SQLiteLocker) SessionLock(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, createSQLiteLockTable); err != nil {
+		return fmt.Errorf("error creating lock table: %w", err)
+	}
+	deadline := time.Now().Add(l.timeout)
+	for {
+		timeNow := time.Now().UTC()
+		if _, err := conn.ExecContext(ctx, clearStaleLock, timeNow.Add(-l.staleAfter)); err != nil {
+			return fmt.Errorf("error clearing stale lock: %w", err)
+		}
+		result, err := conn.ExecContext(ctx, takeSQLiteLock, timeNow)
+		if err != nil {
+			return fmt.Errorf("error taking migration lock: %w", err)
+		}
+		if claimed, _ := result.RowsAffected(); claimed == 1 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the migration lock")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.retryEvery):
+		}
+	}
+}
+
+func (l *SQLiteLocker) SessionUnlock(ctx context.Context, conn *sql.Conn) error {
+	if _, err := conn.ExecContext(ctx, releaseSQLiteLock); err != nil {
+		return fmt.Errorf("error releasing migration lock: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,1774 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// Memory is a Store that keeps everything in maps guarded by a mutex.
+// It mirrors the postgres behaviour closely enough for the handlers:
+// missing rows come back as sql.ErrNoRows, emails and handles are unique and
+// deleting a user cascades to everything that references them.
+type Memory struct {
+	mu             sync.Mutex
+	users          map[uuid.UUID]database.User
+	chirps         map[uuid.UUID]database.Chirp
+	revisions      map[uuid.UUID][]database.ChirpRevision
+	likes          map[likeKey]database.Like
+	follows        map[followKey]database.Follow
+	blocks         map[userPair]database.Block
+	mutes          map[userPair]database.Mute
+	verifications  map[string]database.EmailVerification
+	resets         map[string]database.PasswordReset
+	totp           map[uuid.UUID]database.UserTotp
+	recoveryCodes  map[string]database.TotpRecoveryCode
+	challenges     map[string]database.LoginChallenge
+	throttles      map[string]database.LoginThrottle
+	resetThrottles map[string]database.PasswordResetThrottle
+	passkeys       map[uuid.UUID]database.WebauthnCredential
+	ceremonies     map[string]database.WebauthnChallenge
+	oauthClients   map[uuid.UUID]database.OauthClient
+	oauthCodes     map[string]database.OauthAuthorizationCode
+	refreshTokens  map[string]database.RefreshToken
+	personalTokens map[uuid.UUID]database.PersonalAccessToken
+}
+
+// likeKey is the (user_id, chirp_id) primary key of a like
+type likeKey struct {
+	userID  uuid.UUID
+	chirpID uuid.UUID
+}
+
+// followKey is the (follower_id, followee_id) primary key of a follow
+type followKey struct {
+	followerID uuid.UUID
+	followeeID uuid.UUID
+}
+
+// userPair is the primary key of a block or mute, from the user
+// doing the blocking or muting to the user on the receiving end
+type userPair struct {
+	from uuid.UUID
+	to   uuid.UUID
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:          map[uuid.UUID]database.User{},
+		chirps:         map[uuid.UUID]database.Chirp{},
+		revisions:      map[uuid.UUID][]database.ChirpRevision{},
+		likes:          map[likeKey]database.Like{},
+		follows:        map[followKey]database.Follow{},
+		blocks:         map[userPair]database.Block{},
+		mutes:          map[userPair]database.Mute{},
+		verifications:  map[string]database.EmailVerification{},
+		resets:         map[string]database.PasswordReset{},
+		totp:           map[uuid.UUID]database.UserTotp{},
+		recoveryCodes:  map[string]database.TotpRecoveryCode{},
+		challenges:     map[string]database.LoginChallenge{},
+		throttles:      map[string]database.LoginThrottle{},
+		resetThrottles: map[string]database.PasswordResetThrottle{},
+		passkeys:       map[uuid.UUID]database.WebauthnCredential{},
+		ceremonies:     map[string]database.WebauthnChallenge{},
+		oauthClients:   map[uuid.UUID]database.OauthClient{},
+		oauthCodes:     map[string]database.OauthAuthorizationCode{},
+		refreshTokens:  map[string]database.RefreshToken{},
+		personalTokens: map[uuid.UUID]database.PersonalAccessToken{},
+	}
+}
+
+// keysetBefore reports whether (aCreatedAt, aID) sorts before (bCreatedAt, bID),
+// the order every keyset page here is walked in
+func keysetBefore(aCreatedAt time.Time, aID uuid.UUID, bCreatedAt time.Time, bID uuid.UUID) bool {
+	if aCreatedAt.Equal(bCreatedAt) {
+		return aID.String() < bID.String()
+	}
+	return aCreatedAt.Before(bCreatedAt)
+}
+
+// chirpBefore reports whether a sorts before b in (created_at, id) order
+func chirpBefore(a, b database.Chirp) bool {
+	return keysetBefore(a.CreatedAt, a.ID, b.CreatedAt, b.ID)
+}
+
+// pageChirps is the keyset scan behind the ListChirps* queries. It keeps
+// the chirps matching keep that sort after (or, when desc, before) the
+// cursor chirp, ordered by (created_at, id) and capped at limit.
+func (m *Memory) pageChirps(keep func(database.Chirp) bool, cursor database.Chirp, desc bool, limit int32) []database.Chirp {
+	var chirps []database.Chirp
+	for _, chirp := range m.chirps {
+		if !keep(chirp) {
+			continue
+		}
+		if (!desc && chirpBefore(cursor, chirp)) || (desc && chirpBefore(chirp, cursor)) {
+			chirps = append(chirps, chirp)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		if desc {
+			return chirpBefore(chirps[j], chirps[i])
+		}
+		return chirpBefore(chirps[i], chirps[j])
+	})
+	if limit >= 0 && len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+	}
+	return chirps
+}
+
+func anyChirp(chirp database.Chirp) bool {
+	return !chirp.DeletedAt.Valid
+}
+
+func chirpsBy(userID uuid.UUID) func(database.Chirp) bool {
+	return func(chirp database.Chirp) bool {
+		return !chirp.DeletedAt.Valid && chirp.UserID == userID
+	}
+}
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.chirps[arg.ID]; ok {
+		return database.Chirp{}, errors.New("duplicate key value violates unique constraint \"chirps_pkey\"")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Chirp{}, errors.New("insert or update on table \"chirps\" violates foreign key constraint \"chirps_user_id_fkey\"")
+	}
+	if _, ok := m.chirps[arg.InReplyTo.UUID]; arg.InReplyTo.Valid && !ok {
+		return database.Chirp{}, errors.New("insert or update on table \"chirps\" violates foreign key constraint \"chirps_in_reply_to_fkey\"")
+	}
+	if _, ok := m.chirps[arg.RechirpOf.UUID]; arg.RechirpOf.Valid && !ok {
+		return database.Chirp{}, errors.New("insert or update on table \"chirps\" violates foreign key constraint \"chirps_rechirp_of_fkey\"")
+	}
+	if _, ok := m.chirps[arg.QuoteOf.UUID]; arg.QuoteOf.Valid && !ok {
+		return database.Chirp{}, errors.New("insert or update on table \"chirps\" violates foreign key constraint \"chirps_quote_of_fkey\"")
+	}
+	for _, existing := range m.chirps {
+		if arg.RechirpOf.Valid && existing.RechirpOf == arg.RechirpOf && existing.UserID == arg.UserID {
+			return database.Chirp{}, errors.New("duplicate key value violates unique constraint \"chirps_rechirp_of_user_idx\"")
+		}
+	}
+	chirp := database.Chirp{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		InReplyTo: arg.InReplyTo,
+		RechirpOf: arg.RechirpOf,
+		QuoteOf:   arg.QuoteOf,
+	}
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteChirp(id)
+	return nil
+}
+
+func (m *Memory) deleteChirp(id uuid.UUID) {
+	delete(m.chirps, id)
+	delete(m.revisions, id)
+	for key := range m.likes {
+		if key.chirpID == id {
+			delete(m.likes, key)
+		}
+	}
+	for childID, child := range m.chirps {
+		//rechirps go with the original, same as ON DELETE CASCADE
+		if child.RechirpOf.Valid && child.RechirpOf.UUID == id {
+			m.deleteChirp(childID)
+			continue
+		}
+		//replies and quotes outlive their parent, same as ON DELETE SET NULL
+		if child.InReplyTo.Valid && child.InReplyTo.UUID == id {
+			child.InReplyTo = uuid.NullUUID{}
+		}
+		if child.QuoteOf.Valid && child.QuoteOf.UUID == id {
+			child.QuoteOf = uuid.NullUUID{}
+		}
+		m.chirps[childID] = child
+	}
+}
+
+func (m *Memory) TombstoneChirp(ctx context.Context, arg database.TombstoneChirpParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[arg.ID]
+	if !ok || !m.hasChildren(arg.ID) {
+		return 0, nil
+	}
+	chirp.Body = ""
+	chirp.DeletedAt = arg.DeletedAt
+	chirp.UpdatedAt = arg.DeletedAt.Time
+	m.chirps[chirp.ID] = chirp
+	return 1, nil
+}
+
+func (m *Memory) hasChildren(id uuid.UUID) bool {
+	for _, child := range m.chirps {
+		if (child.InReplyTo.Valid && child.InReplyTo.UUID == id) || (child.QuoteOf.Valid && child.QuoteOf.UUID == id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) CountReplies(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountRepliesRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []database.CountRepliesRow
+	for id, count := range m.countChildren(chirpIds, func(child database.Chirp) uuid.NullUUID { return child.InReplyTo }) {
+		rows = append(rows, database.CountRepliesRow{
+			InReplyTo:  uuid.NullUUID{UUID: id, Valid: true},
+			ReplyCount: count,
+		})
+	}
+	return rows, nil
+}
+
+func (m *Memory) CountRechirps(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountRechirpsRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []database.CountRechirpsRow
+	for id, count := range m.countChildren(chirpIds, func(child database.Chirp) uuid.NullUUID { return child.RechirpOf }) {
+		rows = append(rows, database.CountRechirpsRow{
+			RechirpOf:    uuid.NullUUID{UUID: id, Valid: true},
+			RechirpCount: count,
+		})
+	}
+	return rows, nil
+}
+
+func (m *Memory) CountQuotes(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountQuotesRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []database.CountQuotesRow
+	for id, count := range m.countChildren(chirpIds, func(child database.Chirp) uuid.NullUUID { return child.QuoteOf }) {
+		rows = append(rows, database.CountQuotesRow{
+			QuoteOf:    uuid.NullUUID{UUID: id, Valid: true},
+			QuoteCount: count,
+		})
+	}
+	return rows, nil
+}
+
+// countChildren counts the live chirps pointing at each of chirpIds
+// through the reference picked out by parent
+func (m *Memory) countChildren(chirpIds []uuid.UUID, parent func(database.Chirp) uuid.NullUUID) map[uuid.UUID]int64 {
+	wanted := map[uuid.UUID]bool{}
+	for _, id := range chirpIds {
+		wanted[id] = true
+	}
+	counts := map[uuid.UUID]int64{}
+	for _, child := range m.chirps {
+		if ref := parent(child); ref.Valid && wanted[ref.UUID] && !child.DeletedAt.Valid {
+			counts[ref.UUID]++
+		}
+	}
+	return counts
+}
+
+func (m *Memory) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ancestors []database.Chirp
+	current, ok := m.chirps[id]
+	for ok && current.InReplyTo.Valid {
+		current, ok = m.chirps[current.InReplyTo.UUID]
+		if ok {
+			ancestors = append([]database.Chirp{current}, ancestors...)
+		}
+	}
+	return ancestors, nil
+}
+
+func (m *Memory) GetChirpDescendants(ctx context.Context, arg database.GetChirpDescendantsParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var descendants []database.Chirp
+	level := []uuid.UUID{arg.ID}
+	for len(level) > 0 {
+		parents := map[uuid.UUID]bool{}
+		for _, id := range level {
+			parents[id] = true
+		}
+		var replies []database.Chirp
+		for _, reply := range m.chirps {
+			if reply.InReplyTo.Valid && parents[reply.InReplyTo.UUID] {
+				replies = append(replies, reply)
+			}
+		}
+		sort.Slice(replies, func(i, j int) bool {
+			return chirpBefore(replies[i], replies[j])
+		})
+		level = nil
+		for _, reply := range replies {
+			descendants = append(descendants, reply)
+			level = append(level, reply.ID)
+		}
+	}
+	if len(descendants) > int(arg.Limit) {
+		descendants = descendants[:arg.Limit]
+	}
+	return descendants, nil
+}
+
+func (m *Memory) EditChirp(ctx context.Context, arg database.EditChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[arg.ID]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	m.revisions[chirp.ID] = append(m.revisions[chirp.ID], database.ChirpRevision{
+		ID:         arg.RevisionID,
+		ChirpID:    chirp.ID,
+		Body:       chirp.Body,
+		CreatedAt:  chirp.UpdatedAt,
+		ReplacedAt: arg.UpdatedAt,
+	})
+	chirp.Body = arg.Body
+	chirp.UpdatedAt = arg.UpdatedAt
+	m.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) GetChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	revisions := append([]database.ChirpRevision(nil), m.revisions[chirpID]...)
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].ReplacedAt.Before(revisions[j].ReplacedAt)
+	})
+	return revisions, nil
+}
+
+func (m *Memory) GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chirp, ok := m.chirps[id]
+	if !ok {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return chirp, nil
+}
+
+func (m *Memory) GetChirpsByIds(ctx context.Context, chirpIds []uuid.UUID) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var chirps []database.Chirp
+	for _, id := range chirpIds {
+		if chirp, ok := m.chirps[id]; ok {
+			chirps = append(chirps, chirp)
+		}
+	}
+	return chirps, nil
+}
+
+func (m *Memory) GetRechirp(ctx context.Context, arg database.GetRechirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, chirp := range m.chirps {
+		if chirp.UserID == arg.UserID && arg.RechirpOf.Valid && chirp.RechirpOf == arg.RechirpOf {
+			return chirp, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cursor := database.Chirp{CreatedAt: arg.AfterCreatedAt, ID: arg.AfterID}
+	return m.pageChirps(anyChirp, cursor, false, arg.Limit), nil
+}
+
+func (m *Memory) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cursor := database.Chirp{CreatedAt: arg.BeforeCreatedAt, ID: arg.BeforeID}
+	return m.pageChirps(anyChirp, cursor, true, arg.Limit), nil
+}
+
+func (m *Memory) ListChirpsByUserAsc(ctx context.Context, arg database.ListChirpsByUserAscParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cursor := database.Chirp{CreatedAt: arg.AfterCreatedAt, ID: arg.AfterID}
+	return m.pageChirps(chirpsBy(arg.UserID), cursor, false, arg.Limit), nil
+}
+
+func (m *Memory) ListChirpsByUserDesc(ctx context.Context, arg database.ListChirpsByUserDescParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cursor := database.Chirp{CreatedAt: arg.BeforeCreatedAt, ID: arg.BeforeID}
+	return m.pageChirps(chirpsBy(arg.UserID), cursor, true, arg.Limit), nil
+}
+
+func (m *Memory) ResetChirps(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chirps = map[uuid.UUID]database.Chirp{}
+	m.revisions = map[uuid.UUID][]database.ChirpRevision{}
+	m.likes = map[likeKey]database.Like{}
+	return nil
+}
+
+// SearchChirps scores chirps by how often the query phrases appear in
+// them relative to their length. Every phrase has to appear at least once.
+func (m *Memory) SearchChirps(ctx context.Context, arg database.SearchChirpsParams) ([]database.SearchChirpsRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	phrases := searchPhrases(arg.Query)
+	if len(phrases) == 0 {
+		return nil, nil
+	}
+	var rows []database.SearchChirpsRow
+	for _, chirp := range m.chirps {
+		if chirp.DeletedAt.Valid || (arg.UserID.Valid && chirp.UserID != arg.UserID.UUID) {
+			continue
+		}
+		if chirp.CreatedAt.Before(arg.Since) || !chirp.CreatedAt.Before(arg.Until) {
+			continue
+		}
+		words := searchWords(chirp.Body)
+		hits := 0
+		for _, phrase := range phrases {
+			count := phraseCount(words, phrase)
+			if count == 0 {
+				hits = 0
+				break
+			}
+			hits += count
+		}
+		if hits == 0 {
+			continue
+		}
+		rank := float64(hits) / float64(len(words))
+		if rank > arg.BeforeRank || (rank == arg.BeforeRank && chirp.ID.String() >= arg.BeforeID.String()) {
+			continue
+		}
+		rows = append(rows, database.SearchChirpsRow{Chirp: chirp, Rank: rank})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Rank == rows[j].Rank {
+			return rows[i].Chirp.ID.String() > rows[j].Chirp.ID.String()
+		}
+		return rows[i].Rank > rows[j].Rank
+	})
+	if arg.Limit >= 0 && len(rows) > int(arg.Limit) {
+		rows = rows[:arg.Limit]
+	}
+	return rows, nil
+}
+
+func (m *Memory) LikeChirp(ctx context.Context, arg database.LikeChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return errors.New("insert or update on table \"likes\" violates foreign key constraint \"likes_user_id_fkey\"")
+	}
+	if _, ok := m.chirps[arg.ChirpID]; !ok {
+		return errors.New("insert or update on table \"likes\" violates foreign key constraint \"likes_chirp_id_fkey\"")
+	}
+	key := likeKey{userID: arg.UserID, chirpID: arg.ChirpID}
+	if _, ok := m.likes[key]; !ok {
+		m.likes[key] = database.Like{UserID: arg.UserID, ChirpID: arg.ChirpID, CreatedAt: arg.CreatedAt}
+	}
+	return nil
+}
+
+func (m *Memory) UnlikeChirp(ctx context.Context, arg database.UnlikeChirpParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.likes, likeKey{userID: arg.UserID, chirpID: arg.ChirpID})
+	return nil
+}
+
+func (m *Memory) CountLikes(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountLikesRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wanted := map[uuid.UUID]bool{}
+	for _, id := range chirpIds {
+		wanted[id] = true
+	}
+	counts := map[uuid.UUID]int64{}
+	for key := range m.likes {
+		if wanted[key.chirpID] {
+			counts[key.chirpID]++
+		}
+	}
+	var rows []database.CountLikesRow
+	for id, count := range counts {
+		rows = append(rows, database.CountLikesRow{ChirpID: id, LikeCount: count})
+	}
+	return rows, nil
+}
+
+func (m *Memory) GetLikedChirpIds(ctx context.Context, arg database.GetLikedChirpIdsParams) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var liked []uuid.UUID
+	for _, id := range arg.ChirpIds {
+		if _, ok := m.likes[likeKey{userID: arg.UserID, chirpID: id}]; ok {
+			liked = append(liked, id)
+		}
+	}
+	return liked, nil
+}
+
+func (m *Memory) ListChirpLikes(ctx context.Context, arg database.ListChirpLikesParams) ([]database.Like, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var likes []database.Like
+	for _, like := range m.likes {
+		if like.ChirpID == arg.ChirpID && keysetBefore(like.CreatedAt, like.UserID, arg.BeforeCreatedAt, arg.BeforeUserID) {
+			likes = append(likes, like)
+		}
+	}
+	sort.Slice(likes, func(i, j int) bool {
+		return keysetBefore(likes[j].CreatedAt, likes[j].UserID, likes[i].CreatedAt, likes[i].UserID)
+	})
+	if arg.Limit >= 0 && len(likes) > int(arg.Limit) {
+		likes = likes[:arg.Limit]
+	}
+	return likes, nil
+}
+
+func (m *Memory) ListUserLikes(ctx context.Context, arg database.ListUserLikesParams) ([]database.ListUserLikesRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rows []database.ListUserLikesRow
+	for _, like := range m.likes {
+		chirp, ok := m.chirps[like.ChirpID]
+		if !ok || chirp.DeletedAt.Valid || like.UserID != arg.UserID {
+			continue
+		}
+		if keysetBefore(like.CreatedAt, like.ChirpID, arg.BeforeCreatedAt, arg.BeforeChirpID) {
+			rows = append(rows, database.ListUserLikesRow{Chirp: chirp, LikedAt: like.CreatedAt})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return keysetBefore(rows[j].LikedAt, rows[j].Chirp.ID, rows[i].LikedAt, rows[i].Chirp.ID)
+	})
+	if arg.Limit >= 0 && len(rows) > int(arg.Limit) {
+		rows = rows[:arg.Limit]
+	}
+	return rows, nil
+}
+
+func (m *Memory) FollowUser(ctx context.Context, arg database.FollowUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if arg.FollowerID == arg.FolloweeID {
+		return errors.New("new row for relation \"follows\" violates check constraint \"follows_check\"")
+	}
+	_, followerOK := m.users[arg.FollowerID]
+	_, followeeOK := m.users[arg.FolloweeID]
+	if !followerOK || !followeeOK {
+		return errors.New("insert or update on table \"follows\" violates foreign key constraint \"follows_followee_id_fkey\"")
+	}
+	key := followKey{followerID: arg.FollowerID, followeeID: arg.FolloweeID}
+	if _, ok := m.follows[key]; !ok {
+		m.follows[key] = database.Follow{FollowerID: arg.FollowerID, FolloweeID: arg.FolloweeID, CreatedAt: arg.CreatedAt}
+	}
+	return nil
+}
+
+func (m *Memory) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.follows, followKey{followerID: arg.FollowerID, followeeID: arg.FolloweeID})
+	return nil
+}
+
+// pageFollows is the keyset scan behind ListFollowers and ListFollowing.
+// other picks the side of the follow being listed, and the page is
+// ordered by (created_at, other) newest first
+func (m *Memory) pageFollows(keep func(database.Follow) bool, other func(database.Follow) uuid.UUID, beforeCreatedAt time.Time, beforeID uuid.UUID, limit int32) []database.Follow {
+	var follows []database.Follow
+	for _, follow := range m.follows {
+		if keep(follow) && keysetBefore(follow.CreatedAt, other(follow), beforeCreatedAt, beforeID) {
+			follows = append(follows, follow)
+		}
+	}
+	sort.Slice(follows, func(i, j int) bool {
+		return keysetBefore(follows[j].CreatedAt, other(follows[j]), follows[i].CreatedAt, other(follows[i]))
+	})
+	if limit >= 0 && len(follows) > int(limit) {
+		follows = follows[:limit]
+	}
+	return follows
+}
+
+func (m *Memory) ListFollowers(ctx context.Context, arg database.ListFollowersParams) ([]database.Follow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pageFollows(
+		func(follow database.Follow) bool { return follow.FolloweeID == arg.FolloweeID },
+		func(follow database.Follow) uuid.UUID { return follow.FollowerID },
+		arg.BeforeCreatedAt, arg.BeforeUserID, arg.Limit,
+	), nil
+}
+
+func (m *Memory) ListFollowing(ctx context.Context, arg database.ListFollowingParams) ([]database.Follow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pageFollows(
+		func(follow database.Follow) bool { return follow.FollowerID == arg.FollowerID },
+		func(follow database.Follow) uuid.UUID { return follow.FolloweeID },
+		arg.BeforeCreatedAt, arg.BeforeUserID, arg.Limit,
+	), nil
+}
+
+func (m *Memory) ListTimeline(ctx context.Context, arg database.ListTimelineParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	followed := map[uuid.UUID]bool{}
+	for key := range m.follows {
+		if key.followerID == arg.FollowerID {
+			followed[key.followeeID] = true
+		}
+	}
+	keep := func(chirp database.Chirp) bool {
+		return !chirp.DeletedAt.Valid && followed[chirp.UserID]
+	}
+	return m.pageChirps(keep, database.Chirp{CreatedAt: arg.BeforeCreatedAt, ID: arg.BeforeID}, true, arg.Limit), nil
+}
+
+// checkUserPair applies the foreign key and check constraints shared by blocks and mutes
+func (m *Memory) checkUserPair(table string, pair userPair) error {
+	if pair.from == pair.to {
+		return fmt.Errorf("new row for relation \"%s\" violates check constraint \"%s_check\"", table, table)
+	}
+	_, fromOK := m.users[pair.from]
+	_, toOK := m.users[pair.to]
+	if !fromOK || !toOK {
+		return fmt.Errorf("insert or update on table \"%s\" violates foreign key constraint \"%s_user_id_fkey\"", table, table)
+	}
+	return nil
+}
+
+// pageUserPairs sorts (created_at, to) pairs newest first and keeps the ones
+// before the cursor, the keyset scan behind ListBlocks and ListMutes
+func pageUserPairs[T any](rows []T, key func(T) (time.Time, uuid.UUID), beforeCreatedAt time.Time, beforeID uuid.UUID, limit int32) []T {
+	var page []T
+	for _, row := range rows {
+		createdAt, id := key(row)
+		if keysetBefore(createdAt, id, beforeCreatedAt, beforeID) {
+			page = append(page, row)
+		}
+	}
+	sort.Slice(page, func(i, j int) bool {
+		iCreatedAt, iID := key(page[i])
+		jCreatedAt, jID := key(page[j])
+		return keysetBefore(jCreatedAt, jID, iCreatedAt, iID)
+	})
+	if limit >= 0 && len(page) > int(limit) {
+		page = page[:limit]
+	}
+	return page
+}
+
+func (m *Memory) BlockUser(ctx context.Context, arg database.BlockUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pair := userPair{from: arg.BlockerID, to: arg.BlockedID}
+	if err := m.checkUserPair("blocks", pair); err != nil {
+		return err
+	}
+	if _, ok := m.blocks[pair]; !ok {
+		m.blocks[pair] = database.Block{BlockerID: arg.BlockerID, BlockedID: arg.BlockedID, CreatedAt: arg.CreatedAt}
+	}
+	return nil
+}
+
+func (m *Memory) UnblockUser(ctx context.Context, arg database.UnblockUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blocks, userPair{from: arg.BlockerID, to: arg.BlockedID})
+	return nil
+}
+
+func (m *Memory) IsBlocked(ctx context.Context, arg database.IsBlockedParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.blocks[userPair{from: arg.BlockerID, to: arg.BlockedID}]
+	return ok, nil
+}
+
+func (m *Memory) ListBlocks(ctx context.Context, arg database.ListBlocksParams) ([]database.Block, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var blocks []database.Block
+	for pair, block := range m.blocks {
+		if pair.from == arg.BlockerID {
+			blocks = append(blocks, block)
+		}
+	}
+	key := func(block database.Block) (time.Time, uuid.UUID) { return block.CreatedAt, block.BlockedID }
+	return pageUserPairs(blocks, key, arg.BeforeCreatedAt, arg.BeforeUserID, arg.Limit), nil
+}
+
+func (m *Memory) GetBlockedBetween(ctx context.Context, arg database.GetBlockedBetweenParams) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []uuid.UUID
+	seen := map[uuid.UUID]bool{}
+	for _, id := range arg.UserIds {
+		_, blocked := m.blocks[userPair{from: arg.UserID, to: id}]
+		_, blockedBy := m.blocks[userPair{from: id, to: arg.UserID}]
+		if (blocked || blockedBy) && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) MuteUser(ctx context.Context, arg database.MuteUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pair := userPair{from: arg.MuterID, to: arg.MutedID}
+	if err := m.checkUserPair("mutes", pair); err != nil {
+		return err
+	}
+	if _, ok := m.mutes[pair]; !ok {
+		m.mutes[pair] = database.Mute{MuterID: arg.MuterID, MutedID: arg.MutedID, CreatedAt: arg.CreatedAt}
+	}
+	return nil
+}
+
+func (m *Memory) UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.mutes, userPair{from: arg.MuterID, to: arg.MutedID})
+	return nil
+}
+
+func (m *Memory) ListMutes(ctx context.Context, arg database.ListMutesParams) ([]database.Mute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var mutes []database.Mute
+	for pair, mute := range m.mutes {
+		if pair.from == arg.MuterID {
+			mutes = append(mutes, mute)
+		}
+	}
+	key := func(mute database.Mute) (time.Time, uuid.UUID) { return mute.CreatedAt, mute.MutedID }
+	return pageUserPairs(mutes, key, arg.BeforeCreatedAt, arg.BeforeUserID, arg.Limit), nil
+}
+
+func (m *Memory) GetMutedAmong(ctx context.Context, arg database.GetMutedAmongParams) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ids []uuid.UUID
+	seen := map[uuid.UUID]bool{}
+	for _, id := range arg.UserIds {
+		if _, ok := m.mutes[userPair{from: arg.MuterID, to: id}]; ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Email == arg.Email {
+			return database.CreateUserRow{}, errors.New("duplicate key value violates unique constraint \"users_email_key\"")
+		}
+		if strings.EqualFold(user.Handle, arg.Handle) {
+			return database.CreateUserRow{}, errors.New("duplicate key value violates unique constraint \"users_handle_key\"")
+		}
+	}
+	timeNow := time.Now()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      timeNow,
+		UpdatedAt:      timeNow,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Handle:         arg.Handle,
+		DisplayName:    arg.DisplayName,
+		Bio:            arg.Bio,
+	}
+	m.users[user.ID] = user
+	return database.CreateUserRow{
+		ID:              user.ID,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		Email:           user.Email,
+		IsChirpyRed:     user.IsChirpyRed,
+		Handle:          user.Handle,
+		DisplayName:     user.DisplayName,
+		Bio:             user.Bio,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+	}, nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *Memory) GetUserByHandle(ctx context.Context, handle string) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if strings.EqualFold(user.Handle, handle) {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUsersByIds(ctx context.Context, userIds []uuid.UUID) ([]database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var users []database.User
+	seen := map[uuid.UUID]bool{}
+	for _, id := range userIds {
+		if user, ok := m.users[id]; ok && !seen[id] {
+			seen[id] = true
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.UpdateUserRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.UpdateUserRow{}, sql.ErrNoRows
+	}
+	for _, other := range m.users {
+		if other.ID != arg.ID && other.Email == arg.Email {
+			return database.UpdateUserRow{}, errors.New("duplicate key value violates unique constraint \"users_email_key\"")
+		}
+	}
+	user.UpdatedAt = time.Now()
+	if user.Email != arg.Email {
+		user.EmailVerifiedAt = sql.NullTime{}
+	}
+	user.Email = arg.Email
+	user.HashedPassword = arg.HashedPassword
+	m.users[user.ID] = user
+	return database.UpdateUserRow{
+		ID:              user.ID,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		Email:           user.Email,
+		IsChirpyRed:     user.IsChirpyRed,
+		Handle:          user.Handle,
+		DisplayName:     user.DisplayName,
+		Bio:             user.Bio,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+	}, nil
+}
+
+func (m *Memory) UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.UpdateUserProfileRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok {
+		return database.UpdateUserProfileRow{}, sql.ErrNoRows
+	}
+	for _, other := range m.users {
+		if other.ID != arg.ID && strings.EqualFold(other.Handle, arg.Handle) {
+			return database.UpdateUserProfileRow{}, errors.New("duplicate key value violates unique constraint \"users_handle_key\"")
+		}
+	}
+	user.UpdatedAt = time.Now()
+	user.Handle = arg.Handle
+	user.DisplayName = arg.DisplayName
+	user.Bio = arg.Bio
+	m.users[user.ID] = user
+	return database.UpdateUserProfileRow{
+		ID:              user.ID,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		Email:           user.Email,
+		IsChirpyRed:     user.IsChirpyRed,
+		Handle:          user.Handle,
+		DisplayName:     user.DisplayName,
+		Bio:             user.Bio,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+	}, nil
+}
+
+func (m *Memory) MarkEmailVerified(ctx context.Context, arg database.MarkEmailVerifiedParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[arg.ID]
+	if !ok || user.Email != arg.Email {
+		return 0, nil
+	}
+	user.EmailVerifiedAt = sql.NullTime{Time: arg.VerifiedAt, Valid: true}
+	m.users[arg.ID] = user
+	return 1, nil
+}
+
+func (m *Memory) UpdateUserToRed(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil
+	}
+	user.UpdatedAt = time.Now()
+	user.IsChirpyRed = true
+	m.users[id] = user
+	return nil
+}
+
+func (m *Memory) ResetUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	//users cascade to everything that references them, same as the schema
+	m.users = map[uuid.UUID]database.User{}
+	m.chirps = map[uuid.UUID]database.Chirp{}
+	m.revisions = map[uuid.UUID][]database.ChirpRevision{}
+	m.likes = map[likeKey]database.Like{}
+	m.follows = map[followKey]database.Follow{}
+	m.blocks = map[userPair]database.Block{}
+	m.mutes = map[userPair]database.Mute{}
+	m.verifications = map[string]database.EmailVerification{}
+	m.resets = map[string]database.PasswordReset{}
+	m.totp = map[uuid.UUID]database.UserTotp{}
+	m.recoveryCodes = map[string]database.TotpRecoveryCode{}
+	m.challenges = map[string]database.LoginChallenge{}
+	m.passkeys = map[uuid.UUID]database.WebauthnCredential{}
+	m.ceremonies = map[string]database.WebauthnChallenge{}
+	m.oauthClients = map[uuid.UUID]database.OauthClient{}
+	m.oauthCodes = map[string]database.OauthAuthorizationCode{}
+	m.refreshTokens = map[string]database.RefreshToken{}
+	m.personalTokens = map[uuid.UUID]database.PersonalAccessToken{}
+	return nil
+}
+
+func (m *Memory) CreateEmailVerification(ctx context.Context, arg database.CreateEmailVerificationParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.verifications[arg.TokenHash]; ok {
+		return errors.New("duplicate key value violates unique constraint \"email_verifications_pkey\"")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return errors.New("insert or update on table \"email_verifications\" violates foreign key constraint \"email_verifications_user_id_fkey\"")
+	}
+	m.verifications[arg.TokenHash] = database.EmailVerification{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		Email:     arg.Email,
+		CreatedAt: arg.CreatedAt,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (m *Memory) ConsumeEmailVerification(ctx context.Context, arg database.ConsumeEmailVerificationParams) (database.ConsumeEmailVerificationRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	verification, ok := m.verifications[arg.TokenHash]
+	if !ok || !verification.ExpiresAt.After(arg.Now) {
+		return database.ConsumeEmailVerificationRow{}, sql.ErrNoRows
+	}
+	delete(m.verifications, arg.TokenHash)
+	return database.ConsumeEmailVerificationRow{
+		UserID: verification.UserID,
+		Email:  verification.Email,
+	}, nil
+}
+
+func (m *Memory) GetLatestEmailVerification(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var latest time.Time
+	found := false
+	for _, verification := range m.verifications {
+		if verification.UserID == userID && (!found || verification.CreatedAt.After(latest)) {
+			latest = verification.CreatedAt
+			found = true
+		}
+	}
+	if !found {
+		return time.Time{}, sql.ErrNoRows
+	}
+	return latest, nil
+}
+
+func (m *Memory) DeleteUserEmailVerifications(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for tokenHash, verification := range m.verifications {
+		if verification.UserID == userID {
+			delete(m.verifications, tokenHash)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CreatePasswordReset(ctx context.Context, arg database.CreatePasswordResetParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.resets[arg.TokenHash]; ok {
+		return errors.New("duplicate key value violates unique constraint \"password_resets_pkey\"")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return errors.New("insert or update on table \"password_resets\" violates foreign key constraint \"password_resets_user_id_fkey\"")
+	}
+	m.resets[arg.TokenHash] = database.PasswordReset{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		CreatedAt: arg.CreatedAt,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (m *Memory) ConsumePasswordReset(ctx context.Context, arg database.ConsumePasswordResetParams) (uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reset, ok := m.resets[arg.TokenHash]
+	if !ok || reset.UsedAt.Valid || !reset.ExpiresAt.After(arg.Now) {
+		return uuid.Nil, sql.ErrNoRows
+	}
+	reset.UsedAt = sql.NullTime{Time: arg.Now, Valid: true}
+	m.resets[arg.TokenHash] = reset
+	return reset.UserID, nil
+}
+
+func (m *Memory) DeleteUserPasswordResets(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for tokenHash, reset := range m.resets {
+		if reset.UserID == userID {
+			delete(m.resets, tokenHash)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) StartTOTPEnrollment(ctx context.Context, arg database.StartTOTPEnrollmentParams) (database.UserTotp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.UserTotp{}, errors.New("insert or update on table \"user_totp\" violates foreign key constraint \"user_totp_user_id_fkey\"")
+	}
+	if existing, ok := m.totp[arg.UserID]; ok && existing.ConfirmedAt.Valid {
+		return database.UserTotp{}, sql.ErrNoRows
+	}
+	totp := database.UserTotp{
+		UserID:    arg.UserID,
+		Secret:    arg.Secret,
+		CreatedAt: arg.CreatedAt,
+	}
+	m.totp[arg.UserID] = totp
+	return totp, nil
+}
+
+func (m *Memory) GetUserTOTP(ctx context.Context, userID uuid.UUID) (database.UserTotp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	totp, ok := m.totp[userID]
+	if !ok {
+		return database.UserTotp{}, sql.ErrNoRows
+	}
+	return totp, nil
+}
+
+func (m *Memory) ConfirmUserTOTP(ctx context.Context, arg database.ConfirmUserTOTPParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	totp, ok := m.totp[arg.UserID]
+	if !ok || totp.ConfirmedAt.Valid {
+		return 0, nil
+	}
+	totp.ConfirmedAt = arg.ConfirmedAt
+	totp.LastUsedStep = arg.LastUsedStep
+	m.totp[arg.UserID] = totp
+	return 1, nil
+}
+
+func (m *Memory) UseTOTPStep(ctx context.Context, arg database.UseTOTPStepParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	totp, ok := m.totp[arg.UserID]
+	if !ok || !totp.ConfirmedAt.Valid || totp.LastUsedStep >= arg.LastUsedStep {
+		return 0, nil
+	}
+	totp.LastUsedStep = arg.LastUsedStep
+	m.totp[arg.UserID] = totp
+	return 1, nil
+}
+
+func (m *Memory) DeleteUserTOTP(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.totp, userID)
+	return nil
+}
+
+func (m *Memory) CreateRecoveryCode(ctx context.Context, arg database.CreateRecoveryCodeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.recoveryCodes[arg.CodeHash]; ok {
+		return errors.New("duplicate key value violates unique constraint \"totp_recovery_codes_pkey\"")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return errors.New("insert or update on table \"totp_recovery_codes\" violates foreign key constraint \"totp_recovery_codes_user_id_fkey\"")
+	}
+	m.recoveryCodes[arg.CodeHash] = database.TotpRecoveryCode{
+		CodeHash:  arg.CodeHash,
+		UserID:    arg.UserID,
+		CreatedAt: arg.CreatedAt,
+	}
+	return nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.recoveryCodes[arg.CodeHash]
+	if !ok || code.UserID != arg.UserID || code.UsedAt.Valid {
+		return 0, nil
+	}
+	code.UsedAt = arg.UsedAt
+	m.recoveryCodes[arg.CodeHash] = code
+	return 1, nil
+}
+
+func (m *Memory) DeleteUserRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for codeHash, code := range m.recoveryCodes {
+		if code.UserID == userID {
+			delete(m.recoveryCodes, codeHash)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CreateLoginChallenge(ctx context.Context, arg database.CreateLoginChallengeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.challenges[arg.TokenHash]; ok {
+		return errors.New("duplicate key value violates unique constraint \"login_challenges_pkey\"")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return errors.New("insert or update on table \"login_challenges\" violates foreign key constraint \"login_challenges_user_id_fkey\"")
+	}
+	m.challenges[arg.TokenHash] = database.LoginChallenge{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		CreatedAt: arg.CreatedAt,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (m *Memory) GetLoginChallenge(ctx context.Context, arg database.GetLoginChallengeParams) (database.LoginChallenge, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	challenge, ok := m.challenges[arg.TokenHash]
+	if !ok || challenge.UsedAt.Valid || !challenge.ExpiresAt.After(arg.Now) {
+		return database.LoginChallenge{}, sql.ErrNoRows
+	}
+	return challenge, nil
+}
+
+func (m *Memory) FailLoginChallenge(ctx context.Context, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	challenge, ok := m.challenges[tokenHash]
+	if !ok {
+		return nil
+	}
+	challenge.FailedAttempts++
+	m.challenges[tokenHash] = challenge
+	return nil
+}
+
+func (m *Memory) UseLoginChallenge(ctx context.Context, arg database.UseLoginChallengeParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	challenge, ok := m.challenges[arg.TokenHash]
+	if !ok || challenge.UsedAt.Valid {
+		return 0, nil
+	}
+	challenge.UsedAt = sql.NullTime{Time: arg.Now, Valid: true}
+	m.challenges[arg.TokenHash] = challenge
+	return 1, nil
+}
+
+func (m *Memory) GetLoginThrottle(ctx context.Context, key string) (database.LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	throttle, ok := m.throttles[key]
+	if !ok {
+		return database.LoginThrottle{}, sql.ErrNoRows
+	}
+	return throttle, nil
+}
+
+func (m *Memory) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	throttle, ok := m.throttles[arg.Key]
+	if !ok || throttle.LastFailedAt.Before(arg.WindowStart) {
+		throttle.Key = arg.Key
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailedAt = arg.Now
+	m.throttles[arg.Key] = throttle
+	return throttle, nil
+}
+
+func (m *Memory) LockLoginThrottle(ctx context.Context, arg database.LockLoginThrottleParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	throttle, ok := m.throttles[arg.Key]
+	if !ok {
+		return nil
+	}
+	throttle.LockedUntil = arg.LockedUntil
+	m.throttles[arg.Key] = throttle
+	return nil
+}
+
+func (m *Memory) DeleteLoginThrottle(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.throttles[key]; !ok {
+		return 0, nil
+	}
+	delete(m.throttles, key)
+	return 1, nil
+}
+
+func (m *Memory) GetPasswordResetThrottle(ctx context.Context, key string) (database.PasswordResetThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	throttle, ok := m.resetThrottles[key]
+	if !ok {
+		return database.PasswordResetThrottle{}, sql.ErrNoRows
+	}
+	return throttle, nil
+}
+
+func (m *Memory) CountPasswordResetRequest(ctx context.Context, arg database.CountPasswordResetRequestParams) (database.PasswordResetThrottle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	throttle, ok := m.resetThrottles[arg.Key]
+	switch {
+	case !ok || !throttle.WindowStartedAt.After(arg.WindowStart):
+		throttle = database.PasswordResetThrottle{Key: arg.Key, WindowStartedAt: arg.Now}
+	case throttle.Requests >= arg.MaxRequests:
+		return database.PasswordResetThrottle{}, sql.ErrNoRows
+	}
+	throttle.Requests++
+	m.resetThrottles[arg.Key] = throttle
+	return throttle, nil
+}
+
+func (m *Memory) DeletePasswordResetThrottle(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.resetThrottles[key]; !ok {
+		return 0, nil
+	}
+	delete(m.resetThrottles, key)
+	return 1, nil
+}
+
+func (m *Memory) CreateWebAuthnCredential(ctx context.Context, arg database.CreateWebAuthnCredentialParams) (database.WebauthnCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.passkeys[arg.ID]; ok {
+		return database.WebauthnCredential{}, errors.New("duplicate key value violates unique constraint \"webauthn_credentials_pkey\"")
+	}
+	for _, passkey := range m.passkeys {
+		if passkey.CredentialID == arg.CredentialID {
+			return database.WebauthnCredential{}, errors.New("duplicate key value violates unique constraint \"webauthn_credentials_credential_id_key\"")
+		}
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.WebauthnCredential{}, errors.New("insert or update on table \"webauthn_credentials\" violates foreign key constraint \"webauthn_credentials_user_id_fkey\"")
+	}
+	passkey := database.WebauthnCredential{
+		ID:           arg.ID,
+		UserID:       arg.UserID,
+		CredentialID: arg.CredentialID,
+		PublicKey:    slices.Clone(arg.PublicKey),
+		Name:         arg.Name,
+		SignCount:    arg.SignCount,
+		Transports:   arg.Transports,
+		CreatedAt:    arg.CreatedAt,
+	}
+	m.passkeys[passkey.ID] = passkey
+	return passkey, nil
+}
+
+func (m *Memory) GetWebAuthnCredential(ctx context.Context, credentialID string) (database.WebauthnCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, passkey := range m.passkeys {
+		if passkey.CredentialID == credentialID {
+			return passkey, nil
+		}
+	}
+	return database.WebauthnCredential{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListWebAuthnCredentials(ctx context.Context, userID uuid.UUID) ([]database.WebauthnCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var passkeys []database.WebauthnCredential
+	for _, passkey := range m.passkeys {
+		if passkey.UserID == userID {
+			passkeys = append(passkeys, passkey)
+		}
+	}
+	sort.Slice(passkeys, func(i, j int) bool {
+		return passkeys[i].CreatedAt.After(passkeys[j].CreatedAt)
+	})
+	return passkeys, nil
+}
+
+func (m *Memory) UseWebAuthnCredential(ctx context.Context, arg database.UseWebAuthnCredentialParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	passkey, ok := m.passkeys[arg.ID]
+	if !ok {
+		return nil
+	}
+	passkey.SignCount = arg.SignCount
+	passkey.LastUsedAt = arg.LastUsedAt
+	m.passkeys[arg.ID] = passkey
+	return nil
+}
+
+func (m *Memory) DeleteWebAuthnCredential(ctx context.Context, arg database.DeleteWebAuthnCredentialParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	passkey, ok := m.passkeys[arg.ID]
+	if !ok || passkey.UserID != arg.UserID {
+		return 0, nil
+	}
+	delete(m.passkeys, arg.ID)
+	return 1, nil
+}
+
+func (m *Memory) CreateWebAuthnChallenge(ctx context.Context, arg database.CreateWebAuthnChallengeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.ceremonies[arg.Challenge]; ok {
+		return errors.New("duplicate key value violates unique constraint \"webauthn_challenges_pkey\"")
+	}
+	if _, ok := m.users[arg.UserID.UUID]; arg.UserID.Valid && !ok {
+		return errors.New("insert or update on table \"webauthn_challenges\" violates foreign key constraint \"webauthn_challenges_user_id_fkey\"")
+	}
+	m.ceremonies[arg.Challenge] = database.WebauthnChallenge{
+		Challenge: arg.Challenge,
+		UserID:    arg.UserID,
+		Kind:      arg.Kind,
+		CreatedAt: arg.CreatedAt,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (m *Memory) UseWebAuthnChallenge(ctx context.Context, arg database.UseWebAuthnChallengeParams) (uuid.NullUUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ceremony, ok := m.ceremonies[arg.Challenge]
+	if !ok || ceremony.Kind != arg.Kind || ceremony.UsedAt.Valid || !ceremony.ExpiresAt.After(arg.Now) {
+		return uuid.NullUUID{}, sql.ErrNoRows
+	}
+	ceremony.UsedAt = sql.NullTime{Time: arg.Now, Valid: true}
+	m.ceremonies[arg.Challenge] = ceremony
+	return ceremony.UserID, nil
+}
+
+func (m *Memory) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.oauthClients[arg.ID]; ok {
+		return database.OauthClient{}, errors.New("duplicate key value violates unique constraint \"oauth_clients_pkey\"")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.OauthClient{}, errors.New("insert or update on table \"oauth_clients\" violates foreign key constraint \"oauth_clients_user_id_fkey\"")
+	}
+	client := database.OauthClient{
+		ID:           arg.ID,
+		UserID:       arg.UserID,
+		Name:         arg.Name,
+		SecretHash:   arg.SecretHash,
+		RedirectUris: arg.RedirectUris,
+		CreatedAt:    arg.CreatedAt,
+	}
+	m.oauthClients[client.ID] = client
+	return client, nil
+}
+
+func (m *Memory) GetOAuthClient(ctx context.Context, id uuid.UUID) (database.OauthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.oauthClients[id]
+	if !ok {
+		return database.OauthClient{}, sql.ErrNoRows
+	}
+	return client, nil
+}
+
+func (m *Memory) ListOAuthClients(ctx context.Context, userID uuid.UUID) ([]database.OauthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var clients []database.OauthClient
+	for _, client := range m.oauthClients {
+		if client.UserID == userID {
+			clients = append(clients, client)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.After(clients[j].CreatedAt)
+	})
+	return clients, nil
+}
+
+func (m *Memory) DeleteOAuthClient(ctx context.Context, arg database.DeleteOAuthClientParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.oauthClients[arg.ID]
+	if !ok || client.UserID != arg.UserID {
+		return 0, nil
+	}
+	delete(m.oauthClients, arg.ID)
+	//codes and refresh tokens cascade with the client, same as the schema
+	for codeHash, code := range m.oauthCodes {
+		if code.ClientID == arg.ID {
+			delete(m.oauthCodes, codeHash)
+		}
+	}
+	for tokenHash, refToken := range m.refreshTokens {
+		if refToken.ClientID.Valid && refToken.ClientID.UUID == arg.ID {
+			delete(m.refreshTokens, tokenHash)
+		}
+	}
+	return 1, nil
+}
+
+func (m *Memory) CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.oauthCodes[arg.CodeHash]; ok {
+		return errors.New("duplicate key value violates unique constraint \"oauth_authorization_codes_pkey\"")
+	}
+	if _, ok := m.oauthClients[arg.ClientID]; !ok {
+		return errors.New("insert or update on table \"oauth_authorization_codes\" violates foreign key constraint \"oauth_authorization_codes_client_id_fkey\"")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return errors.New("insert or update on table \"oauth_authorization_codes\" violates foreign key constraint \"oauth_authorization_codes_user_id_fkey\"")
+	}
+	m.oauthCodes[arg.CodeHash] = database.OauthAuthorizationCode{
+		CodeHash:      arg.CodeHash,
+		ClientID:      arg.ClientID,
+		UserID:        arg.UserID,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        arg.Scopes,
+		CodeChallenge: arg.CodeChallenge,
+		FamilyID:      arg.FamilyID,
+		CreatedAt:     arg.CreatedAt,
+		ExpiresAt:     arg.ExpiresAt,
+	}
+	return nil
+}
+
+func (m *Memory) UseOAuthAuthorizationCode(ctx context.Context, arg database.UseOAuthAuthorizationCodeParams) (database.OauthAuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.oauthCodes[arg.CodeHash]
+	if !ok || code.UsedAt.Valid || !code.ExpiresAt.After(arg.Now) {
+		return database.OauthAuthorizationCode{}, sql.ErrNoRows
+	}
+	code.UsedAt = sql.NullTime{Time: arg.Now, Valid: true}
+	m.oauthCodes[arg.CodeHash] = code
+	return code, nil
+}
+
+func (m *Memory) GetOAuthAuthorizationCode(ctx context.Context, codeHash string) (database.OauthAuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.oauthCodes[codeHash]
+	if !ok {
+		return database.OauthAuthorizationCode{}, sql.ErrNoRows
+	}
+	return code, nil
+}
+
+func (m *Memory) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.personalTokens[arg.ID]; ok {
+		return database.PersonalAccessToken{}, errors.New("duplicate key value violates unique constraint \"personal_access_tokens_pkey\"")
+	}
+	for _, pat := range m.personalTokens {
+		if pat.TokenHash == arg.TokenHash {
+			return database.PersonalAccessToken{}, errors.New("duplicate key value violates unique constraint \"personal_access_tokens_token_hash_key\"")
+		}
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.PersonalAccessToken{}, errors.New("insert or update on table \"personal_access_tokens\" violates foreign key constraint \"personal_access_tokens_user_id_fkey\"")
+	}
+	pat := database.PersonalAccessToken{
+		ID:        arg.ID,
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    arg.Scopes,
+		CreatedAt: arg.CreatedAt,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	m.personalTokens[pat.ID] = pat
+	return pat, nil
+}
+
+func (m *Memory) UsePersonalAccessToken(ctx context.Context, arg database.UsePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, pat := range m.personalTokens {
+		if pat.TokenHash != arg.TokenHash {
+			continue
+		}
+		if pat.RevokedAt.Valid || pat.ExpiresAt.Valid && !pat.ExpiresAt.Time.After(arg.Now) {
+			break
+		}
+		pat.LastUsedAt = sql.NullTime{Time: arg.Now, Valid: true}
+		m.personalTokens[id] = pat
+		return pat, nil
+	}
+	return database.PersonalAccessToken{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pats []database.PersonalAccessToken
+	for _, pat := range m.personalTokens {
+		if pat.UserID == userID && !pat.RevokedAt.Valid {
+			pats = append(pats, pat)
+		}
+	}
+	sort.Slice(pats, func(i, j int) bool {
+		return pats[i].CreatedAt.After(pats[j].CreatedAt)
+	})
+	return pats, nil
+}
+
+func (m *Memory) RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pat, ok := m.personalTokens[arg.ID]
+	if !ok || pat.UserID != arg.UserID || pat.RevokedAt.Valid {
+		return 0, nil
+	}
+	pat.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	m.personalTokens[arg.ID] = pat
+	return 1, nil
+}
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.refreshTokens[arg.TokenHash]; ok {
+		return database.RefreshToken{}, errors.New("duplicate key value violates unique constraint \"refresh_tokens_pkey\"")
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.RefreshToken{}, errors.New("insert or update on table \"refresh_tokens\" violates foreign key constraint \"refresh_tokens_user_id_fkey\"")
+	}
+	if _, ok := m.oauthClients[arg.ClientID.UUID]; arg.ClientID.Valid && !ok {
+		return database.RefreshToken{}, errors.New("insert or update on table \"refresh_tokens\" violates foreign key constraint \"refresh_tokens_client_id_fkey\"")
+	}
+	refToken := database.RefreshToken{
+		TokenHash:  arg.TokenHash,
+		CreatedAt:  arg.CreatedAt,
+		UpdatedAt:  arg.UpdatedAt,
+		UserID:     arg.UserID,
+		ExpiresAt:  arg.ExpiresAt,
+		RevokedAt:  arg.RevokedAt,
+		FamilyID:   arg.FamilyID,
+		UserAgent:  arg.UserAgent,
+		Ip:         arg.Ip,
+		LastUsedAt: arg.LastUsedAt,
+		ClientID:   arg.ClientID,
+		Scopes:     arg.Scopes,
+	}
+	m.refreshTokens[refToken.TokenHash] = refToken
+	return refToken, nil
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, tokenHash string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	refToken, ok := m.refreshTokens[tokenHash]
+	if !ok || !refToken.ExpiresAt.After(time.Now()) || refToken.RevokedAt.Valid {
+		return "", sql.ErrNoRows
+	}
+	return refToken.TokenHash, nil
+}
+
+func (m *Memory) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	refToken, ok := m.refreshTokens[tokenHash]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return refToken, nil
+}
+
+func (m *Memory) GetUserFromRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	refToken, ok := m.refreshTokens[tokenHash]
+	if !ok {
+		return uuid.Nil, sql.ErrNoRows
+	}
+	return refToken.UserID, nil
+}
+
+func (m *Memory) RotateRefreshToken(ctx context.Context, arg database.RotateRefreshTokenParams) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	refToken, ok := m.refreshTokens[arg.TokenHash]
+	if !ok || refToken.ClientID != arg.ClientID || refToken.RevokedAt.Valid || !refToken.ExpiresAt.After(arg.Now) {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	refToken.RotatedAt = sql.NullTime{Time: arg.Now, Valid: true}
+	refToken.RevokedAt = refToken.RotatedAt
+	refToken.UpdatedAt = arg.Now
+	refToken.LastUsedAt = arg.Now
+	m.refreshTokens[arg.TokenHash] = refToken
+	return refToken, nil
+}
+
+func (m *Memory) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	refToken, ok := m.refreshTokens[tokenHash]
+	if !ok {
+		return nil
+	}
+	timeNow := time.Now()
+	refToken.RevokedAt = sql.NullTime{Time: timeNow, Valid: true}
+	refToken.UpdatedAt = timeNow
+	m.refreshTokens[tokenHash] = refToken
+	return nil
+}
+
+func (m *Memory) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	timeNow := time.Now()
+	for tokenHash, refToken := range m.refreshTokens {
+		if refToken.FamilyID != familyID || refToken.RevokedAt.Valid {
+			continue
+		}
+		refToken.RevokedAt = sql.NullTime{Time: timeNow, Valid: true}
+		refToken.UpdatedAt = timeNow
+		m.refreshTokens[tokenHash] = refToken
+	}
+	return nil
+}
+
+func (m *Memory) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	timeNow := time.Now()
+	for tokenHash, refToken := range m.refreshTokens {
+		if refToken.UserID != userID || refToken.RevokedAt.Valid {
+			continue
+		}
+		refToken.RevokedAt = sql.NullTime{Time: timeNow, Valid: true}
+		refToken.UpdatedAt = timeNow
+		m.refreshTokens[tokenHash] = refToken
+	}
+	return nil
+}
+
+func (m *Memory) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	timeNow := time.Now()
+	var sessions []database.RefreshToken
+	for _, refToken := range m.refreshTokens {
+		if refToken.UserID == userID && !refToken.RevokedAt.Valid && refToken.ExpiresAt.After(timeNow) {
+			sessions = append(sessions, refToken)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (m *Memory) RevokeUserSession(ctx context.Context, arg database.RevokeUserSessionParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	timeNow := time.Now()
+	var revoked int64
+	for tokenHash, refToken := range m.refreshTokens {
+		if refToken.UserID != arg.UserID || refToken.FamilyID != arg.FamilyID || refToken.RevokedAt.Valid {
+			continue
+		}
+		refToken.RevokedAt = sql.NullTime{Time: timeNow, Valid: true}
+		refToken.UpdatedAt = timeNow
+		m.refreshTokens[tokenHash] = refToken
+		revoked++
+	}
+	return revoked, nil
+}
+
+func (m *Memory) ResetTokens(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refreshTokens = map[string]database.RefreshToken{}
+	return nil
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+)
+
+// searchWords lowercases text and splits it into words, dropping punctuation
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchPhrases splits a search query into its "quoted phrases" and bare
+// words. Every entry must match for a chirp to be a hit, a bare word being
+// a phrase of one word. Postgres gets the raw query and handles the full
+// websearch_to_tsquery syntax, this is the subset the other backends share.
+func searchPhrases(query string) [][]string {
+	var phrases [][]string
+	for idx, part := range strings.Split(query, `"`) {
+		words := searchWords(part)
+		if len(words) == 0 {
+			continue
+		}
+		//odd parts sit between a pair of quotes
+		if idx%2 == 1 {
+			phrases = append(phrases, words)
+			continue
+		}
+		for _, word := range words {
+			phrases = append(phrases, []string{word})
+		}
+	}
+	return phrases
+}
+
+// ftsQuery turns the phrases into an fts5 MATCH expression
+// the words only hold letters and digits so quoting them is safe
+func ftsQuery(phrases [][]string) string {
+	quoted := make([]string, 0, len(phrases))
+	for _, phrase := range phrases {
+		quoted = append(quoted, `"`+strings.Join(phrase, " ")+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// phraseCount counts how often phrase appears in words
+func phraseCount(words, phrase []string) int {
+	count := 0
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		matched := true
+		for j := range phrase {
+			if words[i+j] != phrase[j] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			count++
+		}
+	}
+	return count
+}
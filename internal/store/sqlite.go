@@ -0,0 +1,1869 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/database"
+	_ "modernc.org/sqlite"
+)
+
+// SQLite is a Store backed by a single sqlite file. The queries mirror
+// sql/queries/*.sql and the schema lives in sql/sqlite/schema. uuids are
+// stored as TEXT and every timestamp is written in UTC so that the
+// stored values compare correctly as strings.
+type SQLite struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLite)(nil)
+
+// OpenSQLite opens (or creates) the sqlite database at path
+// foreign keys are switched on for every connection so the
+// ON DELETE CASCADE clauses behave like they do in postgres
+func OpenSQLite(path string) (*SQLite, error) {
+	dsn := sqliteDSN(path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening sqlite: %w", err)
+	}
+	return NewSQLite(db), nil
+}
+
+func NewSQLite(db *sql.DB) *SQLite {
+	return &SQLite{db: db}
+}
+
+// DB returns the underlying connection pool
+func (s *SQLite) DB() *sql.DB {
+	return s.db
+}
+
+func sqliteDSN(path string) string {
+	params := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+	if strings.Contains(path, "?") {
+		return "file:" + path + "&" + params
+	}
+	return "file:" + path + "?" + params
+}
+
+func sqliteNow() time.Time {
+	return time.Now().UTC()
+}
+
+const sqliteChirpColumns = `id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, rechirp_of, quote_of`
+
+func scanChirp(row interface{ Scan(...any) error }) (database.Chirp, error) {
+	var i database.Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+		&i.RechirpOf,
+		&i.QuoteOf,
+	)
+	return i, err
+}
+
+func scanChirps(rows *sql.Rows, err error) ([]database.Chirp, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.Chirp
+	for rows.Next() {
+		i, err := scanChirp(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteCreateChirp = `INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, rechirp_of, quote_of)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING ` + sqliteChirpColumns
+
+func (s *SQLite) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	row := s.db.QueryRowContext(ctx, sqliteCreateChirp,
+		arg.ID,
+		arg.CreatedAt.UTC(),
+		arg.UpdatedAt.UTC(),
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+		arg.RechirpOf,
+		arg.QuoteOf,
+	)
+	return scanChirp(row)
+}
+
+const sqliteDeleteChirp = `DELETE FROM chirps
+WHERE id = ?`
+
+func (s *SQLite) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, sqliteDeleteChirp, id)
+	return err
+}
+
+const (
+	sqliteSaveChirpRevision = `INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+SELECT ?, id, body, updated_at, ?
+FROM chirps
+WHERE id = ?`
+	sqliteUpdateChirpBody = `UPDATE chirps
+SET body = ?,
+    updated_at = ?
+WHERE id = ?
+RETURNING ` + sqliteChirpColumns
+)
+
+// EditChirp copies the current body into chirp_revisions and replaces it
+// sqlite can't write from a cte like the postgres query does, so the two
+// statements share a transaction instead
+func (s *SQLite) EditChirp(ctx context.Context, arg database.EditChirpParams) (database.Chirp, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+	updatedAt := arg.UpdatedAt.UTC()
+	if _, err := tx.ExecContext(ctx, sqliteSaveChirpRevision, arg.RevisionID, updatedAt, arg.ID); err != nil {
+		return database.Chirp{}, err
+	}
+	chirp, err := scanChirp(tx.QueryRowContext(ctx, sqliteUpdateChirpBody, arg.Body, updatedAt, arg.ID))
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return chirp, tx.Commit()
+}
+
+const sqliteGetChirpRevisions = `SELECT id, chirp_id, body, created_at, replaced_at FROM chirp_revisions
+WHERE chirp_id = ?
+ORDER BY replaced_at ASC`
+
+func (s *SQLite) GetChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteGetChirpRevisions, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.ChirpRevision
+	for rows.Next() {
+		var i database.ChirpRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChirpID,
+			&i.Body,
+			&i.CreatedAt,
+			&i.ReplacedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteTombstoneChirp = `UPDATE chirps
+SET body = '',
+    deleted_at = ?,
+    updated_at = ?
+WHERE id = ?
+  AND EXISTS (
+    SELECT 1 FROM chirps AS children
+    WHERE children.in_reply_to = ? OR children.quote_of = ?
+  )`
+
+func (s *SQLite) TombstoneChirp(ctx context.Context, arg database.TombstoneChirpParams) (int64, error) {
+	deletedAt := arg.DeletedAt.Time.UTC()
+	result, err := s.db.ExecContext(ctx, sqliteTombstoneChirp, deletedAt, deletedAt, arg.ID, arg.ID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// the count queries build their IN list by hand since sqlite has no arrays
+
+func (s *SQLite) CountReplies(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountRepliesRow, error) {
+	var items []database.CountRepliesRow
+	err := s.countChildren(ctx, `SELECT in_reply_to, count(*) AS reply_count
+FROM chirps
+WHERE in_reply_to IN (%s)
+  AND deleted_at IS NULL
+GROUP BY in_reply_to`, chirpIds, func(rows *sql.Rows) error {
+		var i database.CountRepliesRow
+		if err := rows.Scan(&i.InReplyTo, &i.ReplyCount); err != nil {
+			return err
+		}
+		items = append(items, i)
+		return nil
+	})
+	return items, err
+}
+
+func (s *SQLite) CountRechirps(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountRechirpsRow, error) {
+	var items []database.CountRechirpsRow
+	err := s.countChildren(ctx, `SELECT rechirp_of, count(*) AS rechirp_count
+FROM chirps
+WHERE rechirp_of IN (%s)
+GROUP BY rechirp_of`, chirpIds, func(rows *sql.Rows) error {
+		var i database.CountRechirpsRow
+		if err := rows.Scan(&i.RechirpOf, &i.RechirpCount); err != nil {
+			return err
+		}
+		items = append(items, i)
+		return nil
+	})
+	return items, err
+}
+
+func (s *SQLite) CountQuotes(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountQuotesRow, error) {
+	var items []database.CountQuotesRow
+	err := s.countChildren(ctx, `SELECT quote_of, count(*) AS quote_count
+FROM chirps
+WHERE quote_of IN (%s)
+  AND deleted_at IS NULL
+GROUP BY quote_of`, chirpIds, func(rows *sql.Rows) error {
+		var i database.CountQuotesRow
+		if err := rows.Scan(&i.QuoteOf, &i.QuoteCount); err != nil {
+			return err
+		}
+		items = append(items, i)
+		return nil
+	})
+	return items, err
+}
+
+// countChildren runs query with its %s swapped for one placeholder per id
+// and hands each row to scan
+func (s *SQLite) countChildren(ctx context.Context, query string, chirpIds []uuid.UUID, scan func(*sql.Rows) error) error {
+	if len(chirpIds) == 0 {
+		return nil
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(query, sqlitePlaceholders(len(chirpIds))), sqliteArgs(chirpIds)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+func sqliteArgs(ids []uuid.UUID) []any {
+	args := make([]any, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return args
+}
+
+func sqlitePlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+const sqliteGetChirpAncestors = `WITH RECURSIVE ancestors AS (
+    SELECT chirps.in_reply_to AS id, 1 AS depth
+    FROM chirps
+    WHERE chirps.id = ?
+    UNION ALL
+    SELECT chirps.in_reply_to, ancestors.depth + 1
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.id
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of
+FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC`
+
+func (s *SQLite) GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.Chirp, error) {
+	return scanChirps(s.db.QueryContext(ctx, sqliteGetChirpAncestors, id))
+}
+
+const sqliteGetChirpDescendants = `WITH RECURSIVE descendants AS (
+    SELECT chirps.id, 1 AS depth
+    FROM chirps
+    WHERE chirps.in_reply_to = ?
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.in_reply_to = descendants.id
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of
+FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+ORDER BY descendants.depth, chirps.created_at, chirps.id
+LIMIT ?`
+
+func (s *SQLite) GetChirpDescendants(ctx context.Context, arg database.GetChirpDescendantsParams) ([]database.Chirp, error) {
+	return scanChirps(s.db.QueryContext(ctx, sqliteGetChirpDescendants, arg.ID, arg.Limit))
+}
+
+const sqliteGetChirpById = `SELECT ` + sqliteChirpColumns + ` FROM chirps
+WHERE id = ?`
+
+func (s *SQLite) GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	row := s.db.QueryRowContext(ctx, sqliteGetChirpById, id)
+	return scanChirp(row)
+}
+
+func (s *SQLite) GetChirpsByIds(ctx context.Context, chirpIds []uuid.UUID) ([]database.Chirp, error) {
+	if len(chirpIds) == 0 {
+		return nil, nil
+	}
+	query := `SELECT ` + sqliteChirpColumns + ` FROM chirps
+WHERE id IN (` + sqlitePlaceholders(len(chirpIds)) + `)`
+	return scanChirps(s.db.QueryContext(ctx, query, sqliteArgs(chirpIds)...))
+}
+
+const sqliteGetRechirp = `SELECT ` + sqliteChirpColumns + ` FROM chirps
+WHERE user_id = ?
+  AND rechirp_of = ?`
+
+func (s *SQLite) GetRechirp(ctx context.Context, arg database.GetRechirpParams) (database.Chirp, error) {
+	row := s.db.QueryRowContext(ctx, sqliteGetRechirp, arg.UserID, arg.RechirpOf)
+	return scanChirp(row)
+}
+
+const sqliteListChirpsAsc = `SELECT ` + sqliteChirpColumns + ` FROM chirps
+WHERE deleted_at IS NULL
+  AND (created_at, id) > (?, ?)
+ORDER BY created_at ASC, id ASC
+LIMIT ?`
+
+func (s *SQLite) ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	return scanChirps(s.db.QueryContext(ctx, sqliteListChirpsAsc, arg.AfterCreatedAt.UTC(), arg.AfterID, arg.Limit))
+}
+
+const sqliteListChirpsDesc = `SELECT ` + sqliteChirpColumns + ` FROM chirps
+WHERE deleted_at IS NULL
+  AND (created_at, id) < (?, ?)
+ORDER BY created_at DESC, id DESC
+LIMIT ?`
+
+func (s *SQLite) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	return scanChirps(s.db.QueryContext(ctx, sqliteListChirpsDesc, arg.BeforeCreatedAt.UTC(), arg.BeforeID, arg.Limit))
+}
+
+const sqliteListChirpsByUserAsc = `SELECT ` + sqliteChirpColumns + ` FROM chirps
+WHERE user_id = ?
+  AND deleted_at IS NULL
+  AND (created_at, id) > (?, ?)
+ORDER BY created_at ASC, id ASC
+LIMIT ?`
+
+func (s *SQLite) ListChirpsByUserAsc(ctx context.Context, arg database.ListChirpsByUserAscParams) ([]database.Chirp, error) {
+	return scanChirps(s.db.QueryContext(ctx, sqliteListChirpsByUserAsc, arg.UserID, arg.AfterCreatedAt.UTC(), arg.AfterID, arg.Limit))
+}
+
+const sqliteListChirpsByUserDesc = `SELECT ` + sqliteChirpColumns + ` FROM chirps
+WHERE user_id = ?
+  AND deleted_at IS NULL
+  AND (created_at, id) < (?, ?)
+ORDER BY created_at DESC, id DESC
+LIMIT ?`
+
+func (s *SQLite) ListChirpsByUserDesc(ctx context.Context, arg database.ListChirpsByUserDescParams) ([]database.Chirp, error) {
+	return scanChirps(s.db.QueryContext(ctx, sqliteListChirpsByUserDesc, arg.UserID, arg.BeforeCreatedAt.UTC(), arg.BeforeID, arg.Limit))
+}
+
+const sqliteResetChirps = `DELETE FROM chirps`
+
+func (s *SQLite) ResetChirps(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, sqliteResetChirps)
+	return err
+}
+
+// bm25 is lower for better matches, so it's negated to sort like ts_rank
+const sqliteSearchChirps = `SELECT ` + sqliteChirpColumns + `, rank
+FROM (
+    SELECT chirps.*, -bm25(chirps_fts) AS rank
+    FROM chirps_fts
+    JOIN chirps ON chirps.id = chirps_fts.chirp_id
+    WHERE chirps_fts MATCH ?
+      AND chirps.deleted_at IS NULL
+      AND (? IS NULL OR chirps.user_id = ?)
+      AND chirps.created_at >= ?
+      AND chirps.created_at < ?
+)
+WHERE (rank, id) < (?, ?)
+ORDER BY rank DESC, id DESC
+LIMIT ?`
+
+func (s *SQLite) SearchChirps(ctx context.Context, arg database.SearchChirpsParams) ([]database.SearchChirpsRow, error) {
+	phrases := searchPhrases(arg.Query)
+	if len(phrases) == 0 {
+		return nil, nil
+	}
+	rows, err := s.db.QueryContext(ctx, sqliteSearchChirps,
+		ftsQuery(phrases),
+		arg.UserID,
+		arg.UserID,
+		arg.Since.UTC(),
+		arg.Until.UTC(),
+		arg.BeforeRank,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.SearchChirpsRow
+	for rows.Next() {
+		var i database.SearchChirpsRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.InReplyTo,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.RechirpOf,
+			&i.Chirp.QuoteOf,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteLikeChirp = `INSERT INTO likes (user_id, chirp_id, created_at)
+VALUES (?, ?, ?)
+ON CONFLICT (user_id, chirp_id) DO NOTHING`
+
+func (s *SQLite) LikeChirp(ctx context.Context, arg database.LikeChirpParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteLikeChirp, arg.UserID, arg.ChirpID, arg.CreatedAt.UTC())
+	return err
+}
+
+const sqliteUnlikeChirp = `DELETE FROM likes
+WHERE user_id = ? AND chirp_id = ?`
+
+func (s *SQLite) UnlikeChirp(ctx context.Context, arg database.UnlikeChirpParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteUnlikeChirp, arg.UserID, arg.ChirpID)
+	return err
+}
+
+func (s *SQLite) CountLikes(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountLikesRow, error) {
+	var items []database.CountLikesRow
+	err := s.countChildren(ctx, `SELECT chirp_id, count(*) AS like_count
+FROM likes
+WHERE chirp_id IN (%s)
+GROUP BY chirp_id`, chirpIds, func(rows *sql.Rows) error {
+		var i database.CountLikesRow
+		if err := rows.Scan(&i.ChirpID, &i.LikeCount); err != nil {
+			return err
+		}
+		items = append(items, i)
+		return nil
+	})
+	return items, err
+}
+
+func (s *SQLite) GetLikedChirpIds(ctx context.Context, arg database.GetLikedChirpIdsParams) ([]uuid.UUID, error) {
+	if len(arg.ChirpIds) == 0 {
+		return nil, nil
+	}
+	query := `SELECT chirp_id FROM likes
+WHERE user_id = ?
+  AND chirp_id IN (` + sqlitePlaceholders(len(arg.ChirpIds)) + `)`
+	return scanIDs(s.db.QueryContext(ctx, query, append([]any{arg.UserID}, sqliteArgs(arg.ChirpIds)...)...))
+}
+
+func scanIDs(rows *sql.Rows, err error) ([]uuid.UUID, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteListChirpLikes = `SELECT user_id, chirp_id, created_at FROM likes
+WHERE chirp_id = ?
+  AND (created_at, user_id) < (?, ?)
+ORDER BY created_at DESC, user_id DESC
+LIMIT ?`
+
+func (s *SQLite) ListChirpLikes(ctx context.Context, arg database.ListChirpLikesParams) ([]database.Like, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteListChirpLikes,
+		arg.ChirpID,
+		arg.BeforeCreatedAt.UTC(),
+		arg.BeforeUserID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.Like
+	for rows.Next() {
+		var i database.Like
+		if err := rows.Scan(&i.UserID, &i.ChirpID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteListUserLikes = `SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of, likes.created_at AS liked_at
+FROM likes
+JOIN chirps ON chirps.id = likes.chirp_id
+WHERE likes.user_id = ?
+  AND chirps.deleted_at IS NULL
+  AND (likes.created_at, likes.chirp_id) < (?, ?)
+ORDER BY likes.created_at DESC, likes.chirp_id DESC
+LIMIT ?`
+
+func (s *SQLite) ListUserLikes(ctx context.Context, arg database.ListUserLikesParams) ([]database.ListUserLikesRow, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteListUserLikes,
+		arg.UserID,
+		arg.BeforeCreatedAt.UTC(),
+		arg.BeforeChirpID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.ListUserLikesRow
+	for rows.Next() {
+		var i database.ListUserLikesRow
+		if err := rows.Scan(
+			&i.Chirp.ID,
+			&i.Chirp.CreatedAt,
+			&i.Chirp.UpdatedAt,
+			&i.Chirp.Body,
+			&i.Chirp.UserID,
+			&i.Chirp.InReplyTo,
+			&i.Chirp.DeletedAt,
+			&i.Chirp.RechirpOf,
+			&i.Chirp.QuoteOf,
+			&i.LikedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteFollowUser = `INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (?, ?, ?)
+ON CONFLICT (follower_id, followee_id) DO NOTHING`
+
+func (s *SQLite) FollowUser(ctx context.Context, arg database.FollowUserParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteFollowUser, arg.FollowerID, arg.FolloweeID, arg.CreatedAt.UTC())
+	return err
+}
+
+const sqliteUnfollowUser = `DELETE FROM follows
+WHERE follower_id = ? AND followee_id = ?`
+
+func (s *SQLite) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteUnfollowUser, arg.FollowerID, arg.FolloweeID)
+	return err
+}
+
+func scanFollows(rows *sql.Rows, err error) ([]database.Follow, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.Follow
+	for rows.Next() {
+		var i database.Follow
+		if err := rows.Scan(&i.FollowerID, &i.FolloweeID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteListFollowers = `SELECT follower_id, followee_id, created_at FROM follows
+WHERE followee_id = ?
+  AND (created_at, follower_id) < (?, ?)
+ORDER BY created_at DESC, follower_id DESC
+LIMIT ?`
+
+func (s *SQLite) ListFollowers(ctx context.Context, arg database.ListFollowersParams) ([]database.Follow, error) {
+	return scanFollows(s.db.QueryContext(ctx, sqliteListFollowers,
+		arg.FolloweeID,
+		arg.BeforeCreatedAt.UTC(),
+		arg.BeforeUserID,
+		arg.Limit,
+	))
+}
+
+const sqliteListFollowing = `SELECT follower_id, followee_id, created_at FROM follows
+WHERE follower_id = ?
+  AND (created_at, followee_id) < (?, ?)
+ORDER BY created_at DESC, followee_id DESC
+LIMIT ?`
+
+func (s *SQLite) ListFollowing(ctx context.Context, arg database.ListFollowingParams) ([]database.Follow, error) {
+	return scanFollows(s.db.QueryContext(ctx, sqliteListFollowing,
+		arg.FollowerID,
+		arg.BeforeCreatedAt.UTC(),
+		arg.BeforeUserID,
+		arg.Limit,
+	))
+}
+
+// sqlite has no lateral joins, the planner walks follows by its primary key
+// and each followee's chirps off chirps_user_id_created_at_id_idx instead
+const sqliteListTimeline = `SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at, chirps.rechirp_of, chirps.quote_of
+FROM follows
+JOIN chirps ON chirps.user_id = follows.followee_id
+WHERE follows.follower_id = ?
+  AND chirps.deleted_at IS NULL
+  AND (chirps.created_at, chirps.id) < (?, ?)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT ?`
+
+func (s *SQLite) ListTimeline(ctx context.Context, arg database.ListTimelineParams) ([]database.Chirp, error) {
+	return scanChirps(s.db.QueryContext(ctx, sqliteListTimeline,
+		arg.FollowerID,
+		arg.BeforeCreatedAt.UTC(),
+		arg.BeforeID,
+		arg.Limit,
+	))
+}
+
+const sqliteBlockUser = `INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES (?, ?, ?)
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING`
+
+func (s *SQLite) BlockUser(ctx context.Context, arg database.BlockUserParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteBlockUser, arg.BlockerID, arg.BlockedID, arg.CreatedAt.UTC())
+	return err
+}
+
+const sqliteUnblockUser = `DELETE FROM blocks
+WHERE blocker_id = ? AND blocked_id = ?`
+
+func (s *SQLite) UnblockUser(ctx context.Context, arg database.UnblockUserParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteUnblockUser, arg.BlockerID, arg.BlockedID)
+	return err
+}
+
+const sqliteIsBlocked = `SELECT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE blocker_id = ? AND blocked_id = ?
+)`
+
+func (s *SQLite) IsBlocked(ctx context.Context, arg database.IsBlockedParams) (bool, error) {
+	row := s.db.QueryRowContext(ctx, sqliteIsBlocked, arg.BlockerID, arg.BlockedID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const sqliteListBlocks = `SELECT blocker_id, blocked_id, created_at FROM blocks
+WHERE blocker_id = ?
+  AND (created_at, blocked_id) < (?, ?)
+ORDER BY created_at DESC, blocked_id DESC
+LIMIT ?`
+
+func (s *SQLite) ListBlocks(ctx context.Context, arg database.ListBlocksParams) ([]database.Block, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteListBlocks,
+		arg.BlockerID,
+		arg.BeforeCreatedAt.UTC(),
+		arg.BeforeUserID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.Block
+	for rows.Next() {
+		var i database.Block
+		if err := rows.Scan(&i.BlockerID, &i.BlockedID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *SQLite) GetBlockedBetween(ctx context.Context, arg database.GetBlockedBetweenParams) ([]uuid.UUID, error) {
+	if len(arg.UserIds) == 0 {
+		return nil, nil
+	}
+	placeholders := sqlitePlaceholders(len(arg.UserIds))
+	query := `SELECT blocked_id AS user_id FROM blocks
+WHERE blocker_id = ?
+  AND blocked_id IN (` + placeholders + `)
+UNION
+SELECT blocker_id AS user_id FROM blocks
+WHERE blocked_id = ?
+  AND blocker_id IN (` + placeholders + `)`
+	args := append([]any{arg.UserID}, sqliteArgs(arg.UserIds)...)
+	args = append(args, arg.UserID)
+	args = append(args, sqliteArgs(arg.UserIds)...)
+	return scanIDs(s.db.QueryContext(ctx, query, args...))
+}
+
+const sqliteMuteUser = `INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES (?, ?, ?)
+ON CONFLICT (muter_id, muted_id) DO NOTHING`
+
+func (s *SQLite) MuteUser(ctx context.Context, arg database.MuteUserParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteMuteUser, arg.MuterID, arg.MutedID, arg.CreatedAt.UTC())
+	return err
+}
+
+const sqliteUnmuteUser = `DELETE FROM mutes
+WHERE muter_id = ? AND muted_id = ?`
+
+func (s *SQLite) UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteUnmuteUser, arg.MuterID, arg.MutedID)
+	return err
+}
+
+const sqliteListMutes = `SELECT muter_id, muted_id, created_at FROM mutes
+WHERE muter_id = ?
+  AND (created_at, muted_id) < (?, ?)
+ORDER BY created_at DESC, muted_id DESC
+LIMIT ?`
+
+func (s *SQLite) ListMutes(ctx context.Context, arg database.ListMutesParams) ([]database.Mute, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteListMutes,
+		arg.MuterID,
+		arg.BeforeCreatedAt.UTC(),
+		arg.BeforeUserID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.Mute
+	for rows.Next() {
+		var i database.Mute
+		if err := rows.Scan(&i.MuterID, &i.MutedID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *SQLite) GetMutedAmong(ctx context.Context, arg database.GetMutedAmongParams) ([]uuid.UUID, error) {
+	if len(arg.UserIds) == 0 {
+		return nil, nil
+	}
+	query := `SELECT muted_id FROM mutes
+WHERE muter_id = ?
+  AND muted_id IN (` + sqlitePlaceholders(len(arg.UserIds)) + `)`
+	return scanIDs(s.db.QueryContext(ctx, query, append([]any{arg.MuterID}, sqliteArgs(arg.UserIds)...)...))
+}
+
+const sqliteCreateUser = `INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle, display_name, bio)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, email_verified_at`
+
+func (s *SQLite) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error) {
+	timeNow := sqliteNow()
+	row := s.db.QueryRowContext(ctx, sqliteCreateUser,
+		uuid.New(),
+		timeNow,
+		timeNow,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+	)
+	var i database.CreateUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const sqliteUpdateUser = `UPDATE users
+SET updated_at = ?,
+    email_verified_at = CASE WHEN email = ? THEN email_verified_at END,
+    email = ?,
+    hashed_password = ?
+WHERE id = ?
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, email_verified_at`
+
+func (s *SQLite) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.UpdateUserRow, error) {
+	row := s.db.QueryRowContext(ctx, sqliteUpdateUser, sqliteNow(), arg.Email, arg.Email, arg.HashedPassword, arg.ID)
+	var i database.UpdateUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const sqliteUpdateUserProfile = `UPDATE users
+SET updated_at = ?,
+    handle = ?,
+    display_name = ?,
+    bio = ?
+WHERE id = ?
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, email_verified_at`
+
+func (s *SQLite) UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.UpdateUserProfileRow, error) {
+	row := s.db.QueryRowContext(ctx, sqliteUpdateUserProfile, sqliteNow(), arg.Handle, arg.DisplayName, arg.Bio, arg.ID)
+	var i database.UpdateUserProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const sqliteUserColumns = `id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, email_verified_at`
+
+func scanUser(row interface{ Scan(...any) error }) (database.User, error) {
+	var i database.User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+func scanUsers(rows *sql.Rows, err error) ([]database.User, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.User
+	for rows.Next() {
+		i, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteGetUserByEmail = `SELECT ` + sqliteUserColumns + `
+FROM users
+WHERE email = ?`
+
+func (s *SQLite) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	row := s.db.QueryRowContext(ctx, sqliteGetUserByEmail, email)
+	return scanUser(row)
+}
+
+const sqliteGetUserById = `SELECT ` + sqliteUserColumns + `
+FROM users
+WHERE id = ?`
+
+func (s *SQLite) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	row := s.db.QueryRowContext(ctx, sqliteGetUserById, id)
+	return scanUser(row)
+}
+
+const sqliteGetUserByHandle = `SELECT ` + sqliteUserColumns + `
+FROM users
+WHERE lower(handle) = lower(?)`
+
+func (s *SQLite) GetUserByHandle(ctx context.Context, handle string) (database.User, error) {
+	row := s.db.QueryRowContext(ctx, sqliteGetUserByHandle, handle)
+	return scanUser(row)
+}
+
+func (s *SQLite) GetUsersByIds(ctx context.Context, userIds []uuid.UUID) ([]database.User, error) {
+	if len(userIds) == 0 {
+		return nil, nil
+	}
+	query := `SELECT ` + sqliteUserColumns + `
+FROM users
+WHERE id IN (` + sqlitePlaceholders(len(userIds)) + `)`
+	return scanUsers(s.db.QueryContext(ctx, query, sqliteArgs(userIds)...))
+}
+
+const sqliteMarkEmailVerified = `UPDATE users
+SET email_verified_at = ?
+WHERE id = ?
+  AND email = ?`
+
+func (s *SQLite) MarkEmailVerified(ctx context.Context, arg database.MarkEmailVerifiedParams) (int64, error) {
+	result, err := s.db.ExecContext(ctx, sqliteMarkEmailVerified, arg.VerifiedAt.UTC(), arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqliteUpdateUserToRed = `UPDATE users
+SET updated_at = ?,
+    is_chirpy_red = true
+WHERE id = ?`
+
+func (s *SQLite) UpdateUserToRed(ctx context.Context, id uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, sqliteUpdateUserToRed, sqliteNow(), id)
+	return err
+}
+
+const sqliteResetUsers = `DELETE FROM users`
+
+func (s *SQLite) ResetUsers(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, sqliteResetUsers)
+	return err
+}
+
+const sqliteCreateEmailVerification = `INSERT INTO email_verifications (token_hash, user_id, email, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?)`
+
+func (s *SQLite) CreateEmailVerification(ctx context.Context, arg database.CreateEmailVerificationParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteCreateEmailVerification,
+		arg.TokenHash,
+		arg.UserID,
+		arg.Email,
+		arg.CreatedAt.UTC(),
+		arg.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+const sqliteConsumeEmailVerification = `DELETE FROM email_verifications
+WHERE token_hash = ?
+  AND expires_at > ?
+RETURNING user_id, email`
+
+func (s *SQLite) ConsumeEmailVerification(ctx context.Context, arg database.ConsumeEmailVerificationParams) (database.ConsumeEmailVerificationRow, error) {
+	row := s.db.QueryRowContext(ctx, sqliteConsumeEmailVerification, arg.TokenHash, arg.Now.UTC())
+	var i database.ConsumeEmailVerificationRow
+	err := row.Scan(&i.UserID, &i.Email)
+	return i, err
+}
+
+const sqliteGetLatestEmailVerification = `SELECT created_at FROM email_verifications
+WHERE user_id = ?
+ORDER BY created_at DESC
+LIMIT 1`
+
+func (s *SQLite) GetLatestEmailVerification(ctx context.Context, userID uuid.UUID) (time.Time, error) {
+	row := s.db.QueryRowContext(ctx, sqliteGetLatestEmailVerification, userID)
+	var created_at time.Time
+	err := row.Scan(&created_at)
+	return created_at, err
+}
+
+const sqliteDeleteUserEmailVerifications = `DELETE FROM email_verifications
+WHERE user_id = ?`
+
+func (s *SQLite) DeleteUserEmailVerifications(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, sqliteDeleteUserEmailVerifications, userID)
+	return err
+}
+
+const sqliteCreatePasswordReset = `INSERT INTO password_resets (token_hash, user_id, created_at, expires_at)
+VALUES (?, ?, ?, ?)`
+
+func (s *SQLite) CreatePasswordReset(ctx context.Context, arg database.CreatePasswordResetParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteCreatePasswordReset, arg.TokenHash, arg.UserID, arg.CreatedAt.UTC(), arg.ExpiresAt.UTC())
+	return err
+}
+
+const sqliteConsumePasswordReset = `UPDATE password_resets
+SET used_at = ?
+WHERE token_hash = ?
+  AND used_at IS NULL
+  AND expires_at > ?
+RETURNING user_id`
+
+func (s *SQLite) ConsumePasswordReset(ctx context.Context, arg database.ConsumePasswordResetParams) (uuid.UUID, error) {
+	timeNow := arg.Now.UTC()
+	row := s.db.QueryRowContext(ctx, sqliteConsumePasswordReset, timeNow, arg.TokenHash, timeNow)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const sqliteDeleteUserPasswordResets = `DELETE FROM password_resets
+WHERE user_id = ?`
+
+func (s *SQLite) DeleteUserPasswordResets(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, sqliteDeleteUserPasswordResets, userID)
+	return err
+}
+
+const sqliteUserTOTPColumns = `user_id, secret, created_at, confirmed_at, last_used_step`
+
+func scanUserTOTP(row interface{ Scan(...any) error }) (database.UserTotp, error) {
+	var i database.UserTotp
+	err := row.Scan(
+		&i.UserID,
+		&i.Secret,
+		&i.CreatedAt,
+		&i.ConfirmedAt,
+		&i.LastUsedStep,
+	)
+	return i, err
+}
+
+const sqliteStartTOTPEnrollment = `INSERT INTO user_totp (user_id, secret, created_at)
+VALUES (?, ?, ?)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = excluded.secret, created_at = excluded.created_at
+WHERE user_totp.confirmed_at IS NULL
+RETURNING ` + sqliteUserTOTPColumns
+
+func (s *SQLite) StartTOTPEnrollment(ctx context.Context, arg database.StartTOTPEnrollmentParams) (database.UserTotp, error) {
+	row := s.db.QueryRowContext(ctx, sqliteStartTOTPEnrollment, arg.UserID, arg.Secret, arg.CreatedAt.UTC())
+	return scanUserTOTP(row)
+}
+
+const sqliteGetUserTOTP = `SELECT ` + sqliteUserTOTPColumns + ` FROM user_totp
+WHERE user_id = ?`
+
+func (s *SQLite) GetUserTOTP(ctx context.Context, userID uuid.UUID) (database.UserTotp, error) {
+	return scanUserTOTP(s.db.QueryRowContext(ctx, sqliteGetUserTOTP, userID))
+}
+
+const sqliteConfirmUserTOTP = `UPDATE user_totp
+SET confirmed_at = ?, last_used_step = ?
+WHERE user_id = ? AND confirmed_at IS NULL`
+
+func (s *SQLite) ConfirmUserTOTP(ctx context.Context, arg database.ConfirmUserTOTPParams) (int64, error) {
+	confirmedAt := arg.ConfirmedAt
+	if confirmedAt.Valid {
+		confirmedAt.Time = confirmedAt.Time.UTC()
+	}
+	result, err := s.db.ExecContext(ctx, sqliteConfirmUserTOTP, confirmedAt, arg.LastUsedStep, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqliteUseTOTPStep = `UPDATE user_totp
+SET last_used_step = ?
+WHERE user_id = ? AND confirmed_at IS NOT NULL AND last_used_step < ?`
+
+func (s *SQLite) UseTOTPStep(ctx context.Context, arg database.UseTOTPStepParams) (int64, error) {
+	result, err := s.db.ExecContext(ctx, sqliteUseTOTPStep, arg.LastUsedStep, arg.UserID, arg.LastUsedStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqliteDeleteUserTOTP = `DELETE FROM user_totp
+WHERE user_id = ?`
+
+func (s *SQLite) DeleteUserTOTP(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, sqliteDeleteUserTOTP, userID)
+	return err
+}
+
+const sqliteCreateRecoveryCode = `INSERT INTO totp_recovery_codes (code_hash, user_id, created_at)
+VALUES (?, ?, ?)`
+
+func (s *SQLite) CreateRecoveryCode(ctx context.Context, arg database.CreateRecoveryCodeParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteCreateRecoveryCode, arg.CodeHash, arg.UserID, arg.CreatedAt.UTC())
+	return err
+}
+
+const sqliteUseRecoveryCode = `UPDATE totp_recovery_codes
+SET used_at = ?
+WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+
+func (s *SQLite) UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error) {
+	usedAt := arg.UsedAt
+	if usedAt.Valid {
+		usedAt.Time = usedAt.Time.UTC()
+	}
+	result, err := s.db.ExecContext(ctx, sqliteUseRecoveryCode, usedAt, arg.UserID, arg.CodeHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqliteDeleteUserRecoveryCodes = `DELETE FROM totp_recovery_codes
+WHERE user_id = ?`
+
+func (s *SQLite) DeleteUserRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, sqliteDeleteUserRecoveryCodes, userID)
+	return err
+}
+
+const sqliteCreateLoginChallenge = `INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at)
+VALUES (?, ?, ?, ?)`
+
+func (s *SQLite) CreateLoginChallenge(ctx context.Context, arg database.CreateLoginChallengeParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteCreateLoginChallenge, arg.TokenHash, arg.UserID, arg.CreatedAt.UTC(), arg.ExpiresAt.UTC())
+	return err
+}
+
+const sqliteGetLoginChallenge = `SELECT token_hash, user_id, created_at, expires_at, failed_attempts, used_at FROM login_challenges
+WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?`
+
+func (s *SQLite) GetLoginChallenge(ctx context.Context, arg database.GetLoginChallengeParams) (database.LoginChallenge, error) {
+	row := s.db.QueryRowContext(ctx, sqliteGetLoginChallenge, arg.TokenHash, arg.Now.UTC())
+	var i database.LoginChallenge
+	err := row.Scan(
+		&i.TokenHash,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.FailedAttempts,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const sqliteFailLoginChallenge = `UPDATE login_challenges
+SET failed_attempts = failed_attempts + 1
+WHERE token_hash = ?`
+
+func (s *SQLite) FailLoginChallenge(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, sqliteFailLoginChallenge, tokenHash)
+	return err
+}
+
+const sqliteUseLoginChallenge = `UPDATE login_challenges
+SET used_at = ?
+WHERE token_hash = ? AND used_at IS NULL`
+
+func (s *SQLite) UseLoginChallenge(ctx context.Context, arg database.UseLoginChallengeParams) (int64, error) {
+	result, err := s.db.ExecContext(ctx, sqliteUseLoginChallenge, arg.Now.UTC(), arg.TokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqliteLoginThrottleColumns = `key, failures, last_failed_at, locked_until`
+
+func scanLoginThrottle(row interface{ Scan(...any) error }) (database.LoginThrottle, error) {
+	var i database.LoginThrottle
+	err := row.Scan(
+		&i.Key,
+		&i.Failures,
+		&i.LastFailedAt,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const sqliteGetLoginThrottle = `SELECT ` + sqliteLoginThrottleColumns + ` FROM login_throttles
+WHERE key = ?`
+
+func (s *SQLite) GetLoginThrottle(ctx context.Context, key string) (database.LoginThrottle, error) {
+	return scanLoginThrottle(s.db.QueryRowContext(ctx, sqliteGetLoginThrottle, key))
+}
+
+const sqliteRecordLoginFailure = `INSERT INTO login_throttles (key, failures, last_failed_at)
+VALUES (?, 1, ?)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failed_at < ? THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failed_at = excluded.last_failed_at
+RETURNING ` + sqliteLoginThrottleColumns
+
+func (s *SQLite) RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginThrottle, error) {
+	return scanLoginThrottle(s.db.QueryRowContext(ctx, sqliteRecordLoginFailure, arg.Key, arg.Now.UTC(), arg.WindowStart.UTC()))
+}
+
+const sqliteLockLoginThrottle = `UPDATE login_throttles
+SET locked_until = ?
+WHERE key = ?`
+
+func (s *SQLite) LockLoginThrottle(ctx context.Context, arg database.LockLoginThrottleParams) error {
+	lockedUntil := arg.LockedUntil
+	if lockedUntil.Valid {
+		lockedUntil.Time = lockedUntil.Time.UTC()
+	}
+	_, err := s.db.ExecContext(ctx, sqliteLockLoginThrottle, lockedUntil, arg.Key)
+	return err
+}
+
+const sqliteDeleteLoginThrottle = `DELETE FROM login_throttles
+WHERE key = ?`
+
+func (s *SQLite) DeleteLoginThrottle(ctx context.Context, key string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, sqliteDeleteLoginThrottle, key)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqlitePasswordResetThrottleColumns = `key, requests, window_started_at`
+
+func scanPasswordResetThrottle(row interface{ Scan(...any) error }) (database.PasswordResetThrottle, error) {
+	var i database.PasswordResetThrottle
+	err := row.Scan(
+		&i.Key,
+		&i.Requests,
+		&i.WindowStartedAt,
+	)
+	return i, err
+}
+
+const sqliteGetPasswordResetThrottle = `SELECT ` + sqlitePasswordResetThrottleColumns + ` FROM password_reset_throttles
+WHERE key = ?`
+
+func (s *SQLite) GetPasswordResetThrottle(ctx context.Context, key string) (database.PasswordResetThrottle, error) {
+	return scanPasswordResetThrottle(s.db.QueryRowContext(ctx, sqliteGetPasswordResetThrottle, key))
+}
+
+const sqliteCountPasswordResetRequest = `INSERT INTO password_reset_throttles (key, requests, window_started_at)
+VALUES (?, 1, ?)
+ON CONFLICT (key) DO UPDATE
+SET requests = CASE
+        WHEN password_reset_throttles.window_started_at <= ? THEN 1
+        ELSE password_reset_throttles.requests + 1
+    END,
+    window_started_at = CASE
+        WHEN password_reset_throttles.window_started_at <= ? THEN excluded.window_started_at
+        ELSE password_reset_throttles.window_started_at
+    END
+WHERE password_reset_throttles.window_started_at <= ?
+   OR password_reset_throttles.requests < ?
+RETURNING ` + sqlitePasswordResetThrottleColumns
+
+func (s *SQLite) CountPasswordResetRequest(ctx context.Context, arg database.CountPasswordResetRequestParams) (database.PasswordResetThrottle, error) {
+	return scanPasswordResetThrottle(s.db.QueryRowContext(ctx, sqliteCountPasswordResetRequest,
+		arg.Key, arg.Now.UTC(), arg.WindowStart.UTC(), arg.WindowStart.UTC(), arg.WindowStart.UTC(), arg.MaxRequests))
+}
+
+const sqliteDeletePasswordResetThrottle = `DELETE FROM password_reset_throttles
+WHERE key = ?`
+
+func (s *SQLite) DeletePasswordResetThrottle(ctx context.Context, key string) (int64, error) {
+	result, err := s.db.ExecContext(ctx, sqliteDeletePasswordResetThrottle, key)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqliteWebAuthnCredentialColumns = `id, user_id, credential_id, public_key, name, sign_count, transports, created_at, last_used_at`
+
+func scanWebAuthnCredential(row interface{ Scan(...any) error }) (database.WebauthnCredential, error) {
+	var i database.WebauthnCredential
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CredentialID,
+		&i.PublicKey,
+		&i.Name,
+		&i.SignCount,
+		&i.Transports,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+	)
+	return i, err
+}
+
+const sqliteCreateWebAuthnCredential = `INSERT INTO webauthn_credentials (id, user_id, credential_id, public_key, name, sign_count, transports, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING ` + sqliteWebAuthnCredentialColumns
+
+func (s *SQLite) CreateWebAuthnCredential(ctx context.Context, arg database.CreateWebAuthnCredentialParams) (database.WebauthnCredential, error) {
+	row := s.db.QueryRowContext(ctx, sqliteCreateWebAuthnCredential,
+		arg.ID,
+		arg.UserID,
+		arg.CredentialID,
+		arg.PublicKey,
+		arg.Name,
+		arg.SignCount,
+		arg.Transports,
+		arg.CreatedAt.UTC(),
+	)
+	return scanWebAuthnCredential(row)
+}
+
+const sqliteGetWebAuthnCredential = `SELECT ` + sqliteWebAuthnCredentialColumns + ` FROM webauthn_credentials
+WHERE credential_id = ?`
+
+func (s *SQLite) GetWebAuthnCredential(ctx context.Context, credentialID string) (database.WebauthnCredential, error) {
+	return scanWebAuthnCredential(s.db.QueryRowContext(ctx, sqliteGetWebAuthnCredential, credentialID))
+}
+
+const sqliteListWebAuthnCredentials = `SELECT ` + sqliteWebAuthnCredentialColumns + ` FROM webauthn_credentials
+WHERE user_id = ?
+ORDER BY created_at DESC`
+
+func (s *SQLite) ListWebAuthnCredentials(ctx context.Context, userID uuid.UUID) ([]database.WebauthnCredential, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteListWebAuthnCredentials, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.WebauthnCredential
+	for rows.Next() {
+		i, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteUseWebAuthnCredential = `UPDATE webauthn_credentials
+SET sign_count = ?, last_used_at = ?
+WHERE id = ?`
+
+func (s *SQLite) UseWebAuthnCredential(ctx context.Context, arg database.UseWebAuthnCredentialParams) error {
+	lastUsedAt := arg.LastUsedAt
+	if lastUsedAt.Valid {
+		lastUsedAt.Time = lastUsedAt.Time.UTC()
+	}
+	_, err := s.db.ExecContext(ctx, sqliteUseWebAuthnCredential, arg.SignCount, lastUsedAt, arg.ID)
+	return err
+}
+
+const sqliteDeleteWebAuthnCredential = `DELETE FROM webauthn_credentials
+WHERE user_id = ? AND id = ?`
+
+func (s *SQLite) DeleteWebAuthnCredential(ctx context.Context, arg database.DeleteWebAuthnCredentialParams) (int64, error) {
+	result, err := s.db.ExecContext(ctx, sqliteDeleteWebAuthnCredential, arg.UserID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqliteCreateWebAuthnChallenge = `INSERT INTO webauthn_challenges (challenge, user_id, kind, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?)`
+
+func (s *SQLite) CreateWebAuthnChallenge(ctx context.Context, arg database.CreateWebAuthnChallengeParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteCreateWebAuthnChallenge, arg.Challenge, arg.UserID, arg.Kind, arg.CreatedAt.UTC(), arg.ExpiresAt.UTC())
+	return err
+}
+
+const sqliteUseWebAuthnChallenge = `UPDATE webauthn_challenges
+SET used_at = ?
+WHERE challenge = ? AND kind = ?
+    AND used_at IS NULL AND expires_at > ?
+RETURNING user_id`
+
+func (s *SQLite) UseWebAuthnChallenge(ctx context.Context, arg database.UseWebAuthnChallengeParams) (uuid.NullUUID, error) {
+	now := arg.Now.UTC()
+	var userID uuid.NullUUID
+	err := s.db.QueryRowContext(ctx, sqliteUseWebAuthnChallenge, now, arg.Challenge, arg.Kind, now).Scan(&userID)
+	return userID, err
+}
+
+const sqliteOAuthClientColumns = `id, user_id, name, secret_hash, redirect_uris, created_at`
+
+func scanOAuthClient(row interface{ Scan(...any) error }) (database.OauthClient, error) {
+	var i database.OauthClient
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.SecretHash,
+		&i.RedirectUris,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const sqliteCreateOAuthClient = `INSERT INTO oauth_clients (id, user_id, name, secret_hash, redirect_uris, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING ` + sqliteOAuthClientColumns
+
+func (s *SQLite) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	row := s.db.QueryRowContext(ctx, sqliteCreateOAuthClient,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.SecretHash,
+		arg.RedirectUris,
+		arg.CreatedAt.UTC(),
+	)
+	return scanOAuthClient(row)
+}
+
+const sqliteGetOAuthClient = `SELECT ` + sqliteOAuthClientColumns + ` FROM oauth_clients
+WHERE id = ?`
+
+func (s *SQLite) GetOAuthClient(ctx context.Context, id uuid.UUID) (database.OauthClient, error) {
+	return scanOAuthClient(s.db.QueryRowContext(ctx, sqliteGetOAuthClient, id))
+}
+
+const sqliteListOAuthClients = `SELECT ` + sqliteOAuthClientColumns + ` FROM oauth_clients
+WHERE user_id = ?
+ORDER BY created_at DESC`
+
+func (s *SQLite) ListOAuthClients(ctx context.Context, userID uuid.UUID) ([]database.OauthClient, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteListOAuthClients, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.OauthClient
+	for rows.Next() {
+		i, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteDeleteOAuthClient = `DELETE FROM oauth_clients
+WHERE user_id = ? AND id = ?`
+
+func (s *SQLite) DeleteOAuthClient(ctx context.Context, arg database.DeleteOAuthClientParams) (int64, error) {
+	result, err := s.db.ExecContext(ctx, sqliteDeleteOAuthClient, arg.UserID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqliteOAuthAuthorizationCodeColumns = `code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, family_id, created_at, expires_at, used_at`
+
+func scanOAuthAuthorizationCode(row interface{ Scan(...any) error }) (database.OauthAuthorizationCode, error) {
+	var i database.OauthAuthorizationCode
+	err := row.Scan(
+		&i.CodeHash,
+		&i.ClientID,
+		&i.UserID,
+		&i.RedirectUri,
+		&i.Scopes,
+		&i.CodeChallenge,
+		&i.FamilyID,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const sqliteCreateOAuthAuthorizationCode = `INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, family_id, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+func (s *SQLite) CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) error {
+	_, err := s.db.ExecContext(ctx, sqliteCreateOAuthAuthorizationCode,
+		arg.CodeHash,
+		arg.ClientID,
+		arg.UserID,
+		arg.RedirectUri,
+		arg.Scopes,
+		arg.CodeChallenge,
+		arg.FamilyID,
+		arg.CreatedAt.UTC(),
+		arg.ExpiresAt.UTC(),
+	)
+	return err
+}
+
+const sqliteUseOAuthAuthorizationCode = `UPDATE oauth_authorization_codes
+SET used_at = ?
+WHERE code_hash = ?
+  AND used_at IS NULL
+  AND expires_at > ?
+RETURNING ` + sqliteOAuthAuthorizationCodeColumns
+
+func (s *SQLite) UseOAuthAuthorizationCode(ctx context.Context, arg database.UseOAuthAuthorizationCodeParams) (database.OauthAuthorizationCode, error) {
+	timeNow := arg.Now.UTC()
+	return scanOAuthAuthorizationCode(s.db.QueryRowContext(ctx, sqliteUseOAuthAuthorizationCode, timeNow, arg.CodeHash, timeNow))
+}
+
+const sqliteGetOAuthAuthorizationCode = `SELECT ` + sqliteOAuthAuthorizationCodeColumns + ` FROM oauth_authorization_codes
+WHERE code_hash = ?`
+
+func (s *SQLite) GetOAuthAuthorizationCode(ctx context.Context, codeHash string) (database.OauthAuthorizationCode, error) {
+	return scanOAuthAuthorizationCode(s.db.QueryRowContext(ctx, sqliteGetOAuthAuthorizationCode, codeHash))
+}
+
+const sqlitePersonalAccessTokenColumns = `id, user_id, name, token_hash, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+func scanPersonalAccessToken(row interface{ Scan(...any) error }) (database.PersonalAccessToken, error) {
+	var i database.PersonalAccessToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.Scopes,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
+
+const sqliteCreatePersonalAccessToken = `INSERT INTO personal_access_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING ` + sqlitePersonalAccessTokenColumns
+
+func (s *SQLite) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	expiresAt := arg.ExpiresAt
+	if expiresAt.Valid {
+		expiresAt.Time = expiresAt.Time.UTC()
+	}
+	row := s.db.QueryRowContext(ctx, sqliteCreatePersonalAccessToken,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.TokenHash,
+		arg.Scopes,
+		arg.CreatedAt.UTC(),
+		expiresAt,
+	)
+	return scanPersonalAccessToken(row)
+}
+
+const sqliteUsePersonalAccessToken = `UPDATE personal_access_tokens
+SET last_used_at = ?
+WHERE token_hash = ?
+  AND revoked_at IS NULL
+  AND (expires_at IS NULL OR expires_at > ?)
+RETURNING ` + sqlitePersonalAccessTokenColumns
+
+func (s *SQLite) UsePersonalAccessToken(ctx context.Context, arg database.UsePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	timeNow := arg.Now.UTC()
+	return scanPersonalAccessToken(s.db.QueryRowContext(ctx, sqliteUsePersonalAccessToken, timeNow, arg.TokenHash, timeNow))
+}
+
+const sqliteListPersonalAccessTokens = `SELECT ` + sqlitePersonalAccessTokenColumns + ` FROM personal_access_tokens
+WHERE user_id = ? AND revoked_at IS NULL
+ORDER BY created_at DESC`
+
+func (s *SQLite) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteListPersonalAccessTokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.PersonalAccessToken
+	for rows.Next() {
+		i, err := scanPersonalAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteRevokePersonalAccessToken = `UPDATE personal_access_tokens
+SET revoked_at = ?
+WHERE user_id = ? AND id = ? AND revoked_at IS NULL`
+
+func (s *SQLite) RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error) {
+	result, err := s.db.ExecContext(ctx, sqliteRevokePersonalAccessToken, sqliteNow(), arg.UserID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqliteRefreshTokenColumns = `token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, rotated_at, user_agent, ip, last_used_at, client_id, scopes`
+
+func scanRefreshToken(row interface{ Scan(...any) error }) (database.RefreshToken, error) {
+	var i database.RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+		&i.ClientID,
+		&i.Scopes,
+	)
+	return i, err
+}
+
+const sqliteCreateRefreshToken = `INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, last_used_at, client_id, scopes)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING ` + sqliteRefreshTokenColumns
+
+func (s *SQLite) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	revokedAt := arg.RevokedAt
+	if revokedAt.Valid {
+		revokedAt.Time = revokedAt.Time.UTC()
+	}
+	row := s.db.QueryRowContext(ctx, sqliteCreateRefreshToken,
+		arg.TokenHash,
+		arg.CreatedAt.UTC(),
+		arg.UpdatedAt.UTC(),
+		arg.UserID,
+		arg.ExpiresAt.UTC(),
+		revokedAt,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.Ip,
+		arg.LastUsedAt.UTC(),
+		arg.ClientID,
+		arg.Scopes,
+	)
+	return scanRefreshToken(row)
+}
+
+const sqliteGetRefreshToken = `SELECT token_hash FROM refresh_tokens
+WHERE token_hash = ? AND expires_at > ? AND revoked_at IS NULL`
+
+func (s *SQLite) GetRefreshToken(ctx context.Context, tokenHash string) (string, error) {
+	row := s.db.QueryRowContext(ctx, sqliteGetRefreshToken, tokenHash, sqliteNow())
+	var token_hash string
+	err := row.Scan(&token_hash)
+	return token_hash, err
+}
+
+const sqliteGetRefreshTokenByHash = `SELECT ` + sqliteRefreshTokenColumns + ` FROM refresh_tokens
+WHERE token_hash = ?`
+
+func (s *SQLite) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	return scanRefreshToken(s.db.QueryRowContext(ctx, sqliteGetRefreshTokenByHash, tokenHash))
+}
+
+const sqliteGetUserFromRefreshToken = `SELECT user_id FROM refresh_tokens
+WHERE token_hash = ?`
+
+func (s *SQLite) GetUserFromRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	row := s.db.QueryRowContext(ctx, sqliteGetUserFromRefreshToken, tokenHash)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const sqliteRotateRefreshToken = `UPDATE refresh_tokens
+SET rotated_at = ?, revoked_at = ?, updated_at = ?, last_used_at = ?
+WHERE token_hash = ?
+  AND client_id IS ?
+  AND revoked_at IS NULL
+  AND expires_at > ?
+RETURNING ` + sqliteRefreshTokenColumns
+
+func (s *SQLite) RotateRefreshToken(ctx context.Context, arg database.RotateRefreshTokenParams) (database.RefreshToken, error) {
+	timeNow := arg.Now.UTC()
+	row := s.db.QueryRowContext(ctx, sqliteRotateRefreshToken, timeNow, timeNow, timeNow, timeNow, arg.TokenHash, arg.ClientID, timeNow)
+	return scanRefreshToken(row)
+}
+
+const sqliteRevokeRefreshToken = `UPDATE refresh_tokens
+SET revoked_at = ?, updated_at = ?
+WHERE token_hash = ?`
+
+func (s *SQLite) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	timeNow := sqliteNow()
+	_, err := s.db.ExecContext(ctx, sqliteRevokeRefreshToken, timeNow, timeNow, tokenHash)
+	return err
+}
+
+const sqliteRevokeRefreshTokenFamily = `UPDATE refresh_tokens
+SET revoked_at = ?, updated_at = ?
+WHERE family_id = ? AND revoked_at IS NULL`
+
+func (s *SQLite) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	timeNow := sqliteNow()
+	_, err := s.db.ExecContext(ctx, sqliteRevokeRefreshTokenFamily, timeNow, timeNow, familyID)
+	return err
+}
+
+const sqliteRevokeUserRefreshTokens = `UPDATE refresh_tokens
+SET revoked_at = ?, updated_at = ?
+WHERE user_id = ? AND revoked_at IS NULL`
+
+func (s *SQLite) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	timeNow := sqliteNow()
+	_, err := s.db.ExecContext(ctx, sqliteRevokeUserRefreshTokens, timeNow, timeNow, userID)
+	return err
+}
+
+const sqliteListUserSessions = `SELECT ` + sqliteRefreshTokenColumns + ` FROM refresh_tokens
+WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+ORDER BY last_used_at DESC`
+
+func (s *SQLite) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	rows, err := s.db.QueryContext(ctx, sqliteListUserSessions, userID, sqliteNow())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []database.RefreshToken
+	for rows.Next() {
+		i, err := scanRefreshToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sqliteRevokeUserSession = `UPDATE refresh_tokens
+SET revoked_at = ?, updated_at = ?
+WHERE user_id = ? AND family_id = ? AND revoked_at IS NULL`
+
+func (s *SQLite) RevokeUserSession(ctx context.Context, arg database.RevokeUserSessionParams) (int64, error) {
+	timeNow := sqliteNow()
+	result, err := s.db.ExecContext(ctx, sqliteRevokeUserSession, timeNow, timeNow, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const sqliteResetTokens = `DELETE FROM refresh_tokens`
+
+func (s *SQLite) ResetTokens(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, sqliteResetTokens)
+	return err
+}
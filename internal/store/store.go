@@ -0,0 +1,148 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// Store is the set of persistence operations the handlers depend on.
+// *database.Queries (the sqlc postgres code) satisfies it directly,
+// Memory is an in-process stand-in for running without a database.
+type Store interface {
+	// chirps
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	DeleteChirp(ctx context.Context, id uuid.UUID) error
+	TombstoneChirp(ctx context.Context, arg database.TombstoneChirpParams) (int64, error)
+	EditChirp(ctx context.Context, arg database.EditChirpParams) (database.Chirp, error)
+	GetChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error)
+	GetChirpById(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	GetChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.Chirp, error)
+	GetChirpDescendants(ctx context.Context, arg database.GetChirpDescendantsParams) ([]database.Chirp, error)
+	CountReplies(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountRepliesRow, error)
+	GetChirpsByIds(ctx context.Context, chirpIds []uuid.UUID) ([]database.Chirp, error)
+	GetRechirp(ctx context.Context, arg database.GetRechirpParams) (database.Chirp, error)
+	CountRechirps(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountRechirpsRow, error)
+	CountQuotes(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountQuotesRow, error)
+	ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error)
+	ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error)
+	ListChirpsByUserAsc(ctx context.Context, arg database.ListChirpsByUserAscParams) ([]database.Chirp, error)
+	ListChirpsByUserDesc(ctx context.Context, arg database.ListChirpsByUserDescParams) ([]database.Chirp, error)
+	ResetChirps(ctx context.Context) error
+	SearchChirps(ctx context.Context, arg database.SearchChirpsParams) ([]database.SearchChirpsRow, error)
+
+	// likes
+	LikeChirp(ctx context.Context, arg database.LikeChirpParams) error
+	UnlikeChirp(ctx context.Context, arg database.UnlikeChirpParams) error
+	CountLikes(ctx context.Context, chirpIds []uuid.UUID) ([]database.CountLikesRow, error)
+	GetLikedChirpIds(ctx context.Context, arg database.GetLikedChirpIdsParams) ([]uuid.UUID, error)
+	ListChirpLikes(ctx context.Context, arg database.ListChirpLikesParams) ([]database.Like, error)
+	ListUserLikes(ctx context.Context, arg database.ListUserLikesParams) ([]database.ListUserLikesRow, error)
+
+	// follows
+	FollowUser(ctx context.Context, arg database.FollowUserParams) error
+	UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error
+	ListFollowers(ctx context.Context, arg database.ListFollowersParams) ([]database.Follow, error)
+	ListFollowing(ctx context.Context, arg database.ListFollowingParams) ([]database.Follow, error)
+	ListTimeline(ctx context.Context, arg database.ListTimelineParams) ([]database.Chirp, error)
+
+	// blocks and mutes
+	BlockUser(ctx context.Context, arg database.BlockUserParams) error
+	UnblockUser(ctx context.Context, arg database.UnblockUserParams) error
+	IsBlocked(ctx context.Context, arg database.IsBlockedParams) (bool, error)
+	ListBlocks(ctx context.Context, arg database.ListBlocksParams) ([]database.Block, error)
+	GetBlockedBetween(ctx context.Context, arg database.GetBlockedBetweenParams) ([]uuid.UUID, error)
+	MuteUser(ctx context.Context, arg database.MuteUserParams) error
+	UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error
+	ListMutes(ctx context.Context, arg database.ListMutesParams) ([]database.Mute, error)
+	GetMutedAmong(ctx context.Context, arg database.GetMutedAmongParams) ([]uuid.UUID, error)
+
+	// users
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error)
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserById(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetUserByHandle(ctx context.Context, handle string) (database.User, error)
+	GetUsersByIds(ctx context.Context, userIds []uuid.UUID) ([]database.User, error)
+	UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.UpdateUserRow, error)
+	UpdateUserProfile(ctx context.Context, arg database.UpdateUserProfileParams) (database.UpdateUserProfileRow, error)
+	MarkEmailVerified(ctx context.Context, arg database.MarkEmailVerifiedParams) (int64, error)
+	UpdateUserToRed(ctx context.Context, id uuid.UUID) error
+	ResetUsers(ctx context.Context) error
+
+	// email verifications
+	CreateEmailVerification(ctx context.Context, arg database.CreateEmailVerificationParams) error
+	ConsumeEmailVerification(ctx context.Context, arg database.ConsumeEmailVerificationParams) (database.ConsumeEmailVerificationRow, error)
+	GetLatestEmailVerification(ctx context.Context, userID uuid.UUID) (time.Time, error)
+	DeleteUserEmailVerifications(ctx context.Context, userID uuid.UUID) error
+
+	// password resets
+	CreatePasswordReset(ctx context.Context, arg database.CreatePasswordResetParams) error
+	ConsumePasswordReset(ctx context.Context, arg database.ConsumePasswordResetParams) (uuid.UUID, error)
+	DeleteUserPasswordResets(ctx context.Context, userID uuid.UUID) error
+
+	// two factor auth
+	StartTOTPEnrollment(ctx context.Context, arg database.StartTOTPEnrollmentParams) (database.UserTotp, error)
+	GetUserTOTP(ctx context.Context, userID uuid.UUID) (database.UserTotp, error)
+	ConfirmUserTOTP(ctx context.Context, arg database.ConfirmUserTOTPParams) (int64, error)
+	UseTOTPStep(ctx context.Context, arg database.UseTOTPStepParams) (int64, error)
+	DeleteUserTOTP(ctx context.Context, userID uuid.UUID) error
+	CreateRecoveryCode(ctx context.Context, arg database.CreateRecoveryCodeParams) error
+	UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error)
+	DeleteUserRecoveryCodes(ctx context.Context, userID uuid.UUID) error
+	CreateLoginChallenge(ctx context.Context, arg database.CreateLoginChallengeParams) error
+	GetLoginChallenge(ctx context.Context, arg database.GetLoginChallengeParams) (database.LoginChallenge, error)
+	FailLoginChallenge(ctx context.Context, tokenHash string) error
+	UseLoginChallenge(ctx context.Context, arg database.UseLoginChallengeParams) (int64, error)
+
+	// login throttling
+	GetLoginThrottle(ctx context.Context, key string) (database.LoginThrottle, error)
+	RecordLoginFailure(ctx context.Context, arg database.RecordLoginFailureParams) (database.LoginThrottle, error)
+	LockLoginThrottle(ctx context.Context, arg database.LockLoginThrottleParams) error
+	DeleteLoginThrottle(ctx context.Context, key string) (int64, error)
+
+	// password reset throttling
+	GetPasswordResetThrottle(ctx context.Context, key string) (database.PasswordResetThrottle, error)
+	CountPasswordResetRequest(ctx context.Context, arg database.CountPasswordResetRequestParams) (database.PasswordResetThrottle, error)
+	DeletePasswordResetThrottle(ctx context.Context, key string) (int64, error)
+
+	// passkeys
+	CreateWebAuthnCredential(ctx context.Context, arg database.CreateWebAuthnCredentialParams) (database.WebauthnCredential, error)
+	GetWebAuthnCredential(ctx context.Context, credentialID string) (database.WebauthnCredential, error)
+	ListWebAuthnCredentials(ctx context.Context, userID uuid.UUID) ([]database.WebauthnCredential, error)
+	UseWebAuthnCredential(ctx context.Context, arg database.UseWebAuthnCredentialParams) error
+	DeleteWebAuthnCredential(ctx context.Context, arg database.DeleteWebAuthnCredentialParams) (int64, error)
+	CreateWebAuthnChallenge(ctx context.Context, arg database.CreateWebAuthnChallengeParams) error
+	UseWebAuthnChallenge(ctx context.Context, arg database.UseWebAuthnChallengeParams) (uuid.NullUUID, error)
+
+	// oauth clients and authorization codes
+	CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error)
+	GetOAuthClient(ctx context.Context, id uuid.UUID) (database.OauthClient, error)
+	ListOAuthClients(ctx context.Context, userID uuid.UUID) ([]database.OauthClient, error)
+	DeleteOAuthClient(ctx context.Context, arg database.DeleteOAuthClientParams) (int64, error)
+	CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) error
+	UseOAuthAuthorizationCode(ctx context.Context, arg database.UseOAuthAuthorizationCodeParams) (database.OauthAuthorizationCode, error)
+	GetOAuthAuthorizationCode(ctx context.Context, codeHash string) (database.OauthAuthorizationCode, error)
+
+	// personal access tokens
+	CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error)
+	UsePersonalAccessToken(ctx context.Context, arg database.UsePersonalAccessTokenParams) (database.PersonalAccessToken, error)
+	ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error)
+
+	// refresh tokens
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (string, error)
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (database.RefreshToken, error)
+	GetUserFromRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, error)
+	RotateRefreshToken(ctx context.Context, arg database.RotateRefreshTokenParams) (database.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error
+	ListUserSessions(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error)
+	RevokeUserSession(ctx context.Context, arg database.RevokeUserSessionParams) (int64, error)
+	ResetTokens(ctx context.Context) error
+}
+
+var _ Store = (*database.Queries)(nil)
@@ -0,0 +1,1350 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/database"
+	"github.com/joncaudill/chirpy/internal/migrate"
+	"github.com/pressly/goose/v3"
+)
+
+// newTestSQLite opens a throwaway sqlite file and migrates it up
+func newTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "chirpy.db"))
+	if err != nil {
+		t.Fatalf("unable to open sqlite: %v", err)
+	}
+	t.Cleanup(func() { s.DB().Close() })
+	provider, err := migrate.NewProvider(s.DB(), goose.DialectSQLite3, os.DirFS("../../sql/sqlite/schema"))
+	if err != nil {
+		t.Fatalf("unable to load sqlite schema: %v", err)
+	}
+	if _, err := provider.Up(context.Background()); err != nil {
+		t.Fatalf("unable to migrate sqlite: %v", err)
+	}
+	return s
+}
+
+func backends(t *testing.T) map[string]Store {
+	return map[string]Store{
+		"memory": NewMemory(),
+		"sqlite": newTestSQLite(t),
+	}
+}
+
+func TestStoreUsersAndChirps(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user, err := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			if err != nil {
+				t.Fatalf("unable to create user: %v", err)
+			}
+			if user.ID == uuid.Nil || user.IsChirpyRed {
+				t.Fatalf("unexpected new user: %+v", user)
+			}
+			if _, err := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a2"}); err == nil {
+				t.Fatalf("expected duplicate email to fail")
+			}
+			if _, err := s.GetUserByEmail(ctx, "nobody@example.com"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected sql.ErrNoRows for unknown email, got %v", err)
+			}
+			if err := s.UpdateUserToRed(ctx, user.ID); err != nil {
+				t.Fatalf("unable to upgrade user: %v", err)
+			}
+			got, err := s.GetUserByEmail(ctx, "a@example.com")
+			if err != nil || !got.IsChirpyRed || got.HashedPassword != "hash" {
+				t.Fatalf("unexpected user %+v (err %v)", got, err)
+			}
+
+			base := time.Now().Add(-time.Hour).Round(time.Microsecond)
+			var ids []uuid.UUID
+			for i := 0; i < 3; i++ {
+				created := base.Add(time.Duration(2-i) * time.Minute)
+				chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{
+					ID:        uuid.New(),
+					CreatedAt: created,
+					UpdatedAt: created,
+					Body:      "chirp",
+					UserID:    user.ID,
+				})
+				if err != nil {
+					t.Fatalf("unable to create chirp: %v", err)
+				}
+				ids = append(ids, chirp.ID)
+			}
+			chirps, err := s.ListChirpsByUserAsc(ctx, database.ListChirpsByUserAscParams{UserID: user.ID, Limit: 10})
+			if err != nil || len(chirps) != 3 {
+				t.Fatalf("expected 3 chirps, got %d (err %v)", len(chirps), err)
+			}
+			if chirps[0].ID != ids[2] || chirps[2].ID != ids[0] {
+				t.Fatalf("expected chirps ordered by created_at ascending")
+			}
+			if !chirps[0].CreatedAt.Equal(base) {
+				t.Fatalf("expected created_at %v to round trip, got %v", base, chirps[0].CreatedAt)
+			}
+			if err := s.DeleteChirp(ctx, ids[1]); err != nil {
+				t.Fatalf("unable to delete chirp: %v", err)
+			}
+			if _, err := s.GetChirpById(ctx, ids[1]); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected sql.ErrNoRows for deleted chirp, got %v", err)
+			}
+
+			//deleting users cascades to their chirps
+			if err := s.ResetUsers(ctx); err != nil {
+				t.Fatalf("unable to reset users: %v", err)
+			}
+			chirps, err = s.ListChirpsAsc(ctx, database.ListChirpsAscParams{Limit: 10})
+			if err != nil || len(chirps) != 0 {
+				t.Fatalf("expected chirps to be deleted with their user, got %d (err %v)", len(chirps), err)
+			}
+		})
+	}
+}
+
+func TestStoreUserProfiles(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			alice, err := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "Alice", DisplayName: "Alice A", Bio: "hi"})
+			if err != nil || alice.Handle != "Alice" || alice.DisplayName != "Alice A" || alice.Bio != "hi" {
+				t.Fatalf("unexpected new user %+v (err %v)", alice, err)
+			}
+			if _, err := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "ALICE"}); err == nil {
+				t.Fatalf("expected a handle differing only in case to fail")
+			}
+			bob, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "bob"})
+
+			got, err := s.GetUserByHandle(ctx, "aLiCe")
+			if err != nil || got.ID != alice.ID {
+				t.Fatalf("expected to find alice ignoring case, got %+v (err %v)", got, err)
+			}
+			if _, err := s.GetUserByHandle(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected sql.ErrNoRows for an unknown handle, got %v", err)
+			}
+
+			updated, err := s.UpdateUserProfile(ctx, database.UpdateUserProfileParams{ID: bob.ID, Handle: "bobby", DisplayName: "Bob", Bio: "new bio"})
+			if err != nil || updated.Handle != "bobby" || updated.Bio != "new bio" || updated.Email != "b@example.com" {
+				t.Fatalf("unexpected updated profile %+v (err %v)", updated, err)
+			}
+			if _, err := s.UpdateUserProfile(ctx, database.UpdateUserProfileParams{ID: bob.ID, Handle: "alice"}); err == nil {
+				t.Fatalf("expected taking alice's handle to fail")
+			}
+
+			users, err := s.GetUsersByIds(ctx, []uuid.UUID{alice.ID, bob.ID, uuid.New()})
+			if err != nil || len(users) != 2 {
+				t.Fatalf("expected both users, got %+v (err %v)", users, err)
+			}
+		})
+	}
+}
+
+func TestStoreListChirpsKeyset(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user, err := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			if err != nil {
+				t.Fatalf("unable to create user: %v", err)
+			}
+			//two chirps share a created_at so the id has to break the tie
+			created := time.Now().Round(time.Microsecond)
+			for _, offset := range []time.Duration{0, 0, time.Second, 2 * time.Second, 3 * time.Second} {
+				_, err := s.CreateChirp(ctx, database.CreateChirpParams{
+					ID:        uuid.New(),
+					CreatedAt: created.Add(offset),
+					UpdatedAt: created.Add(offset),
+					Body:      "chirp",
+					UserID:    user.ID,
+				})
+				if err != nil {
+					t.Fatalf("unable to create chirp: %v", err)
+				}
+			}
+
+			var asc []database.Chirp
+			after := database.Chirp{}
+			for {
+				page, err := s.ListChirpsAsc(ctx, database.ListChirpsAscParams{AfterCreatedAt: after.CreatedAt, AfterID: after.ID, Limit: 2})
+				if err != nil {
+					t.Fatalf("unable to list chirps: %v", err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				asc = append(asc, page...)
+				after = page[len(page)-1]
+			}
+			if len(asc) != 5 {
+				t.Fatalf("expected to page through 5 chirps, got %d", len(asc))
+			}
+
+			before := database.Chirp{CreatedAt: time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC), ID: uuid.Max}
+			var desc []database.Chirp
+			for {
+				page, err := s.ListChirpsByUserDesc(ctx, database.ListChirpsByUserDescParams{UserID: user.ID, BeforeCreatedAt: before.CreatedAt, BeforeID: before.ID, Limit: 2})
+				if err != nil {
+					t.Fatalf("unable to list chirps: %v", err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				desc = append(desc, page...)
+				before = page[len(page)-1]
+			}
+			if len(desc) != 5 {
+				t.Fatalf("expected to page through 5 chirps, got %d", len(desc))
+			}
+			for i := range asc {
+				if asc[i].ID != desc[len(desc)-1-i].ID {
+					t.Fatalf("expected desc pages to be the reverse of asc pages")
+				}
+			}
+		})
+	}
+}
+
+func TestStoreSearchChirps(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			alice, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			bob, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "b"})
+			created := time.Now().Add(-time.Hour).Round(time.Microsecond)
+			bodies := map[string]uuid.UUID{
+				"the quick brown fox":     alice.ID,
+				"a brown bear":            alice.ID,
+				"fox fox fox":             bob.ID,
+				"nothing to see here":     bob.ID,
+				"The brown, lazy old fox": bob.ID,
+			}
+			for body, userID := range bodies {
+				created = created.Add(time.Minute)
+				_, err := s.CreateChirp(ctx, database.CreateChirpParams{ID: uuid.New(), CreatedAt: created, UpdatedAt: created, Body: body, UserID: userID})
+				if err != nil {
+					t.Fatalf("unable to create chirp: %v", err)
+				}
+			}
+			search := func(query string, userID uuid.NullUUID, since time.Time) []database.SearchChirpsRow {
+				var all []database.SearchChirpsRow
+				params := database.SearchChirpsParams{
+					Query:      query,
+					UserID:     userID,
+					Since:      since,
+					Until:      time.Now().Add(time.Hour),
+					BeforeRank: math.MaxFloat64,
+					BeforeID:   uuid.Max,
+					Limit:      1,
+				}
+				for {
+					rows, err := s.SearchChirps(ctx, params)
+					if err != nil {
+						t.Fatalf("unable to search %q: %v", query, err)
+					}
+					if len(rows) == 0 {
+						return all
+					}
+					all = append(all, rows...)
+					params.BeforeRank = rows[len(rows)-1].Rank
+					params.BeforeID = rows[len(rows)-1].Chirp.ID
+				}
+			}
+			if got := search("fox", uuid.NullUUID{}, time.Time{}); len(got) != 3 || got[0].Chirp.Body != "fox fox fox" {
+				t.Fatalf("expected 3 fox chirps with the most relevant first, got %+v", got)
+			}
+			if got := search(`"brown fox"`, uuid.NullUUID{}, time.Time{}); len(got) != 1 || got[0].Chirp.Body != "the quick brown fox" {
+				t.Fatalf("expected the phrase to match one chirp, got %+v", got)
+			}
+			if got := search("brown", uuid.NullUUID{UUID: alice.ID, Valid: true}, time.Time{}); len(got) != 2 {
+				t.Fatalf("expected 2 of alice's chirps, got %+v", got)
+			}
+			if got := search("brown", uuid.NullUUID{}, time.Now()); len(got) != 0 {
+				t.Fatalf("expected nothing newer than now, got %+v", got)
+			}
+		})
+	}
+}
+
+func TestStoreEditChirp(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			created := time.Now().Add(-time.Hour).Round(time.Microsecond)
+			original, err := s.CreateChirp(ctx, database.CreateChirpParams{ID: uuid.New(), CreatedAt: created, UpdatedAt: created, Body: "first", UserID: user.ID})
+			if err != nil {
+				t.Fatalf("unable to create chirp: %v", err)
+			}
+			for i, body := range []string{"second", "third"} {
+				edited, err := s.EditChirp(ctx, database.EditChirpParams{
+					RevisionID: uuid.New(),
+					UpdatedAt:  created.Add(time.Duration(i+1) * time.Minute),
+					ID:         original.ID,
+					Body:       body,
+				})
+				if err != nil || edited.Body != body {
+					t.Fatalf("unable to edit chirp: %+v (err %v)", edited, err)
+				}
+			}
+			revisions, err := s.GetChirpRevisions(ctx, original.ID)
+			if err != nil || len(revisions) != 2 {
+				t.Fatalf("expected 2 revisions, got %d (err %v)", len(revisions), err)
+			}
+			if revisions[0].Body != "first" || revisions[1].Body != "second" || !revisions[0].CreatedAt.Equal(created) {
+				t.Fatalf("unexpected revisions %+v", revisions)
+			}
+			if _, err := s.EditChirp(ctx, database.EditChirpParams{RevisionID: uuid.New(), UpdatedAt: time.Now(), ID: uuid.New(), Body: "x"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected sql.ErrNoRows editing a missing chirp, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreReplies(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			created := time.Now().Add(-time.Hour).Round(time.Microsecond)
+			post := func(body string, parent uuid.UUID) database.Chirp {
+				created = created.Add(time.Minute)
+				chrp, err := s.CreateChirp(ctx, database.CreateChirpParams{
+					ID:        uuid.New(),
+					CreatedAt: created,
+					UpdatedAt: created,
+					Body:      body,
+					UserID:    user.ID,
+					InReplyTo: uuid.NullUUID{UUID: parent, Valid: parent != uuid.Nil},
+				})
+				if err != nil {
+					t.Fatalf("unable to create chirp: %v", err)
+				}
+				return chrp
+			}
+			root := post("root", uuid.Nil)
+			first := post("first", root.ID)
+			second := post("second", root.ID)
+			nested := post("nested", first.ID)
+
+			ancestors, err := s.GetChirpAncestors(ctx, nested.ID)
+			if err != nil || len(ancestors) != 2 || ancestors[0].ID != root.ID || ancestors[1].ID != first.ID {
+				t.Fatalf("expected root then first as ancestors, got %+v (err %v)", ancestors, err)
+			}
+			descendants, err := s.GetChirpDescendants(ctx, database.GetChirpDescendantsParams{ID: root.ID, Limit: 10})
+			if err != nil || len(descendants) != 3 {
+				t.Fatalf("expected 3 descendants, got %+v (err %v)", descendants, err)
+			}
+			if descendants[0].ID != first.ID || descendants[1].ID != second.ID || descendants[2].ID != nested.ID {
+				t.Fatalf("expected descendants a level at a time, got %+v", descendants)
+			}
+			counts, err := s.CountReplies(ctx, []uuid.UUID{root.ID, first.ID, nested.ID})
+			if err != nil || len(counts) != 2 {
+				t.Fatalf("expected reply counts for 2 chirps, got %+v (err %v)", counts, err)
+			}
+			for _, row := range counts {
+				if (row.InReplyTo.UUID == root.ID && row.ReplyCount != 2) || (row.InReplyTo.UUID == first.ID && row.ReplyCount != 1) {
+					t.Fatalf("unexpected reply count %+v", row)
+				}
+			}
+
+			//a chirp with replies is tombstoned, a leaf is not
+			if n, err := s.TombstoneChirp(ctx, database.TombstoneChirpParams{DeletedAt: sql.NullTime{Time: time.Now(), Valid: true}, ID: second.ID}); err != nil || n != 0 {
+				t.Fatalf("expected a leaf not to be tombstoned, got %d (err %v)", n, err)
+			}
+			if n, err := s.TombstoneChirp(ctx, database.TombstoneChirpParams{DeletedAt: sql.NullTime{Time: time.Now(), Valid: true}, ID: first.ID}); err != nil || n != 1 {
+				t.Fatalf("expected first to be tombstoned, got %d (err %v)", n, err)
+			}
+			tombstone, err := s.GetChirpById(ctx, first.ID)
+			if err != nil || !tombstone.DeletedAt.Valid || tombstone.Body != "" {
+				t.Fatalf("expected an empty tombstone, got %+v (err %v)", tombstone, err)
+			}
+			listed, _ := s.ListChirpsAsc(ctx, database.ListChirpsAscParams{AfterID: uuid.Nil, Limit: 10})
+			if len(listed) != 3 {
+				t.Fatalf("expected the tombstone to be left out of listings, got %d chirps", len(listed))
+			}
+
+			if err := s.DeleteChirp(ctx, root.ID); err != nil {
+				t.Fatalf("unable to delete root: %v", err)
+			}
+			orphan, err := s.GetChirpById(ctx, second.ID)
+			if err != nil || orphan.InReplyTo.Valid {
+				t.Fatalf("expected the reply to outlive its parent, got %+v (err %v)", orphan, err)
+			}
+		})
+	}
+}
+
+func TestStoreReposts(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			alice, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			bob, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "b"})
+			created := time.Now().Add(-time.Hour).Round(time.Microsecond)
+			post := func(arg database.CreateChirpParams) (database.Chirp, error) {
+				created = created.Add(time.Minute)
+				arg.ID = uuid.New()
+				arg.CreatedAt = created
+				arg.UpdatedAt = created
+				return s.CreateChirp(ctx, arg)
+			}
+			original, _ := post(database.CreateChirpParams{Body: "original", UserID: alice.ID})
+			of := uuid.NullUUID{UUID: original.ID, Valid: true}
+			rechirp, err := post(database.CreateChirpParams{UserID: bob.ID, RechirpOf: of})
+			if err != nil || rechirp.RechirpOf != of {
+				t.Fatalf("unable to rechirp: %+v (err %v)", rechirp, err)
+			}
+			if _, err := post(database.CreateChirpParams{UserID: bob.ID, RechirpOf: of}); err == nil {
+				t.Fatalf("expected rechirping twice to fail")
+			}
+			quote, err := post(database.CreateChirpParams{Body: "so true", UserID: bob.ID, QuoteOf: of})
+			if err != nil || quote.QuoteOf != of {
+				t.Fatalf("unable to quote: %+v (err %v)", quote, err)
+			}
+
+			found, err := s.GetRechirp(ctx, database.GetRechirpParams{UserID: bob.ID, RechirpOf: of})
+			if err != nil || found.ID != rechirp.ID {
+				t.Fatalf("expected to find bob's rechirp, got %+v (err %v)", found, err)
+			}
+			if _, err := s.GetRechirp(ctx, database.GetRechirpParams{UserID: alice.ID, RechirpOf: of}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected sql.ErrNoRows for alice, got %v", err)
+			}
+			byIds, err := s.GetChirpsByIds(ctx, []uuid.UUID{original.ID, quote.ID, uuid.New()})
+			if err != nil || len(byIds) != 2 {
+				t.Fatalf("expected 2 chirps by id, got %+v (err %v)", byIds, err)
+			}
+			rechirps, err := s.CountRechirps(ctx, []uuid.UUID{original.ID, quote.ID})
+			if err != nil || len(rechirps) != 1 || rechirps[0].RechirpOf != of || rechirps[0].RechirpCount != 1 {
+				t.Fatalf("expected 1 rechirp of the original, got %+v (err %v)", rechirps, err)
+			}
+			quotes, err := s.CountQuotes(ctx, []uuid.UUID{original.ID, quote.ID})
+			if err != nil || len(quotes) != 1 || quotes[0].QuoteOf != of || quotes[0].QuoteCount != 1 {
+				t.Fatalf("expected 1 quote of the original, got %+v (err %v)", quotes, err)
+			}
+
+			//a quoted chirp is tombstoned, rechirps alone don't keep it around
+			if n, err := s.TombstoneChirp(ctx, database.TombstoneChirpParams{DeletedAt: sql.NullTime{Time: time.Now(), Valid: true}, ID: original.ID}); err != nil || n != 1 {
+				t.Fatalf("expected the quoted chirp to be tombstoned, got %d (err %v)", n, err)
+			}
+			if err := s.DeleteChirp(ctx, original.ID); err != nil {
+				t.Fatalf("unable to delete original: %v", err)
+			}
+			if _, err := s.GetChirpById(ctx, rechirp.ID); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected the rechirp to go with the original, got %v", err)
+			}
+			kept, err := s.GetChirpById(ctx, quote.ID)
+			if err != nil || kept.QuoteOf.Valid {
+				t.Fatalf("expected the quote to outlive the original, got %+v (err %v)", kept, err)
+			}
+		})
+	}
+}
+
+func TestStoreLikes(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			alice, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			bob, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "b"})
+			created := time.Now().Add(-time.Hour).Round(time.Microsecond)
+			var chirps []database.Chirp
+			for i := 0; i < 3; i++ {
+				chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{ID: uuid.New(), CreatedAt: created, UpdatedAt: created, Body: "chirp", UserID: alice.ID})
+				if err != nil {
+					t.Fatalf("unable to create chirp: %v", err)
+				}
+				chirps = append(chirps, chirp)
+			}
+			like := func(userID, chirpID uuid.UUID) {
+				created = created.Add(time.Minute)
+				if err := s.LikeChirp(ctx, database.LikeChirpParams{UserID: userID, ChirpID: chirpID, CreatedAt: created}); err != nil {
+					t.Fatalf("unable to like chirp: %v", err)
+				}
+			}
+			like(alice.ID, chirps[0].ID)
+			like(bob.ID, chirps[0].ID)
+			like(bob.ID, chirps[0].ID)
+			like(bob.ID, chirps[1].ID)
+
+			counts, err := s.CountLikes(ctx, []uuid.UUID{chirps[0].ID, chirps[1].ID, chirps[2].ID})
+			if err != nil || len(counts) != 2 {
+				t.Fatalf("expected like counts for 2 chirps, got %+v (err %v)", counts, err)
+			}
+			for _, row := range counts {
+				if (row.ChirpID == chirps[0].ID && row.LikeCount != 2) || (row.ChirpID == chirps[1].ID && row.LikeCount != 1) {
+					t.Fatalf("unexpected like count %+v", row)
+				}
+			}
+			liked, err := s.GetLikedChirpIds(ctx, database.GetLikedChirpIdsParams{UserID: alice.ID, ChirpIds: []uuid.UUID{chirps[0].ID, chirps[1].ID}})
+			if err != nil || len(liked) != 1 || liked[0] != chirps[0].ID {
+				t.Fatalf("expected alice to have liked only the first chirp, got %v (err %v)", liked, err)
+			}
+
+			likers, err := s.ListChirpLikes(ctx, database.ListChirpLikesParams{ChirpID: chirps[0].ID, BeforeCreatedAt: time.Now(), BeforeUserID: uuid.Max, Limit: 1})
+			if err != nil || len(likers) != 1 || likers[0].UserID != bob.ID {
+				t.Fatalf("expected bob as the latest liker, got %+v (err %v)", likers, err)
+			}
+			likers, _ = s.ListChirpLikes(ctx, database.ListChirpLikesParams{ChirpID: chirps[0].ID, BeforeCreatedAt: likers[0].CreatedAt, BeforeUserID: likers[0].UserID, Limit: 10})
+			if len(likers) != 1 || likers[0].UserID != alice.ID {
+				t.Fatalf("expected alice on the next page, got %+v", likers)
+			}
+			bobLikes, err := s.ListUserLikes(ctx, database.ListUserLikesParams{UserID: bob.ID, BeforeCreatedAt: time.Now(), BeforeChirpID: uuid.Max, Limit: 10})
+			if err != nil || len(bobLikes) != 2 || bobLikes[0].Chirp.ID != chirps[1].ID || bobLikes[1].Chirp.ID != chirps[0].ID {
+				t.Fatalf("expected bob's likes newest first, got %+v (err %v)", bobLikes, err)
+			}
+
+			if err := s.UnlikeChirp(ctx, database.UnlikeChirpParams{UserID: bob.ID, ChirpID: chirps[0].ID}); err != nil {
+				t.Fatalf("unable to unlike: %v", err)
+			}
+			if err := s.DeleteChirp(ctx, chirps[1].ID); err != nil {
+				t.Fatalf("unable to delete chirp: %v", err)
+			}
+			bobLikes, _ = s.ListUserLikes(ctx, database.ListUserLikesParams{UserID: bob.ID, BeforeCreatedAt: time.Now(), BeforeChirpID: uuid.Max, Limit: 10})
+			if len(bobLikes) != 0 {
+				t.Fatalf("expected bob to have no likes left, got %+v", bobLikes)
+			}
+		})
+	}
+}
+
+func TestStoreFollowsAndTimeline(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			alice, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			bob, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "b"})
+			carol, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "c@example.com", HashedPassword: "hash", Handle: "c"})
+			created := time.Now().Add(-time.Hour).Round(time.Microsecond)
+			follow := func(followerID, followeeID uuid.UUID) {
+				created = created.Add(time.Minute)
+				if err := s.FollowUser(ctx, database.FollowUserParams{FollowerID: followerID, FolloweeID: followeeID, CreatedAt: created}); err != nil {
+					t.Fatalf("unable to follow: %v", err)
+				}
+			}
+			follow(alice.ID, bob.ID)
+			follow(alice.ID, carol.ID)
+			follow(alice.ID, carol.ID)
+			follow(bob.ID, carol.ID)
+			if err := s.FollowUser(ctx, database.FollowUserParams{FollowerID: alice.ID, FolloweeID: alice.ID, CreatedAt: created}); err == nil {
+				t.Fatalf("expected following yourself to fail")
+			}
+
+			following, err := s.ListFollowing(ctx, database.ListFollowingParams{FollowerID: alice.ID, BeforeCreatedAt: time.Now(), BeforeUserID: uuid.Max, Limit: 10})
+			if err != nil || len(following) != 2 || following[0].FolloweeID != carol.ID || following[1].FolloweeID != bob.ID {
+				t.Fatalf("expected alice to follow carol then bob, got %+v (err %v)", following, err)
+			}
+			followers, err := s.ListFollowers(ctx, database.ListFollowersParams{FolloweeID: carol.ID, BeforeCreatedAt: time.Now(), BeforeUserID: uuid.Max, Limit: 1})
+			if err != nil || len(followers) != 1 || followers[0].FollowerID != bob.ID {
+				t.Fatalf("expected bob as carol's newest follower, got %+v (err %v)", followers, err)
+			}
+			followers, _ = s.ListFollowers(ctx, database.ListFollowersParams{FolloweeID: carol.ID, BeforeCreatedAt: followers[0].CreatedAt, BeforeUserID: followers[0].FollowerID, Limit: 10})
+			if len(followers) != 1 || followers[0].FollowerID != alice.ID {
+				t.Fatalf("expected alice on the next page, got %+v", followers)
+			}
+
+			var posted []uuid.UUID
+			for _, author := range []uuid.UUID{bob.ID, carol.ID, alice.ID, bob.ID, carol.ID} {
+				created = created.Add(time.Minute)
+				chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{ID: uuid.New(), CreatedAt: created, UpdatedAt: created, Body: "chirp", UserID: author})
+				if err != nil {
+					t.Fatalf("unable to create chirp: %v", err)
+				}
+				posted = append(posted, chirp.ID)
+			}
+			var timeline []database.Chirp
+			before := database.Chirp{CreatedAt: time.Now(), ID: uuid.Max}
+			for {
+				page, err := s.ListTimeline(ctx, database.ListTimelineParams{BeforeCreatedAt: before.CreatedAt, BeforeID: before.ID, Limit: 3, FollowerID: alice.ID})
+				if err != nil {
+					t.Fatalf("unable to list timeline: %v", err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				timeline = append(timeline, page...)
+				before = page[len(page)-1]
+			}
+			want := []uuid.UUID{posted[4], posted[3], posted[1], posted[0]}
+			if len(timeline) != len(want) {
+				t.Fatalf("expected %d chirps on alice's timeline, got %d", len(want), len(timeline))
+			}
+			for i := range want {
+				if timeline[i].ID != want[i] {
+					t.Fatalf("expected the followed chirps newest first, got %+v", timeline)
+				}
+			}
+
+			if err := s.UnfollowUser(ctx, database.UnfollowUserParams{FollowerID: alice.ID, FolloweeID: bob.ID}); err != nil {
+				t.Fatalf("unable to unfollow: %v", err)
+			}
+			timeline, _ = s.ListTimeline(ctx, database.ListTimelineParams{BeforeCreatedAt: time.Now(), BeforeID: uuid.Max, Limit: 10, FollowerID: alice.ID})
+			if len(timeline) != 2 {
+				t.Fatalf("expected only carol's chirps after unfollowing bob, got %d", len(timeline))
+			}
+		})
+	}
+}
+
+func TestStoreBlocksAndMutes(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			alice, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			bob, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "b"})
+			carol, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "c@example.com", HashedPassword: "hash", Handle: "c"})
+			created := time.Now().Add(-time.Hour).Round(time.Microsecond)
+			for _, blocked := range []uuid.UUID{bob.ID, carol.ID, carol.ID} {
+				created = created.Add(time.Minute)
+				if err := s.BlockUser(ctx, database.BlockUserParams{BlockerID: alice.ID, BlockedID: blocked, CreatedAt: created}); err != nil {
+					t.Fatalf("unable to block: %v", err)
+				}
+			}
+			if err := s.BlockUser(ctx, database.BlockUserParams{BlockerID: alice.ID, BlockedID: alice.ID, CreatedAt: created}); err == nil {
+				t.Fatalf("expected blocking yourself to fail")
+			}
+
+			if blocked, err := s.IsBlocked(ctx, database.IsBlockedParams{BlockerID: alice.ID, BlockedID: bob.ID}); err != nil || !blocked {
+				t.Fatalf("expected alice to block bob (err %v)", err)
+			}
+			if blocked, _ := s.IsBlocked(ctx, database.IsBlockedParams{BlockerID: bob.ID, BlockedID: alice.ID}); blocked {
+				t.Fatalf("expected the block to only go one way")
+			}
+			between, err := s.GetBlockedBetween(ctx, database.GetBlockedBetweenParams{UserID: bob.ID, UserIds: []uuid.UUID{alice.ID, carol.ID}})
+			if err != nil || len(between) != 1 || between[0] != alice.ID {
+				t.Fatalf("expected bob to be cut off from alice only, got %v (err %v)", between, err)
+			}
+
+			blocks, err := s.ListBlocks(ctx, database.ListBlocksParams{BlockerID: alice.ID, BeforeCreatedAt: time.Now(), BeforeUserID: uuid.Max, Limit: 1})
+			if err != nil || len(blocks) != 1 || blocks[0].BlockedID != carol.ID {
+				t.Fatalf("expected carol as alice's newest block, got %+v (err %v)", blocks, err)
+			}
+			blocks, _ = s.ListBlocks(ctx, database.ListBlocksParams{BlockerID: alice.ID, BeforeCreatedAt: blocks[0].CreatedAt, BeforeUserID: blocks[0].BlockedID, Limit: 10})
+			if len(blocks) != 1 || blocks[0].BlockedID != bob.ID {
+				t.Fatalf("expected bob on the next page, got %+v", blocks)
+			}
+			if err := s.UnblockUser(ctx, database.UnblockUserParams{BlockerID: alice.ID, BlockedID: bob.ID}); err != nil {
+				t.Fatalf("unable to unblock: %v", err)
+			}
+			if blocked, _ := s.IsBlocked(ctx, database.IsBlockedParams{BlockerID: alice.ID, BlockedID: bob.ID}); blocked {
+				t.Fatalf("expected bob to be unblocked")
+			}
+
+			if err := s.MuteUser(ctx, database.MuteUserParams{MuterID: bob.ID, MutedID: carol.ID, CreatedAt: created}); err != nil {
+				t.Fatalf("unable to mute: %v", err)
+			}
+			muted, err := s.GetMutedAmong(ctx, database.GetMutedAmongParams{MuterID: bob.ID, UserIds: []uuid.UUID{alice.ID, carol.ID}})
+			if err != nil || len(muted) != 1 || muted[0] != carol.ID {
+				t.Fatalf("expected bob to have muted carol, got %v (err %v)", muted, err)
+			}
+			mutes, _ := s.ListMutes(ctx, database.ListMutesParams{MuterID: bob.ID, BeforeCreatedAt: time.Now(), BeforeUserID: uuid.Max, Limit: 10})
+			if len(mutes) != 1 || mutes[0].MutedID != carol.ID {
+				t.Fatalf("expected carol in bob's mutes, got %+v", mutes)
+			}
+			s.UnmuteUser(ctx, database.UnmuteUserParams{MuterID: bob.ID, MutedID: carol.ID})
+			muted, _ = s.GetMutedAmong(ctx, database.GetMutedAmongParams{MuterID: bob.ID, UserIds: []uuid.UUID{carol.ID}})
+			if len(muted) != 0 {
+				t.Fatalf("expected carol to be unmuted, got %v", muted)
+			}
+		})
+	}
+}
+
+func TestStoreEmailVerifications(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			if user.EmailVerifiedAt.Valid {
+				t.Fatalf("expected a new user to be unverified")
+			}
+			if _, err := s.GetLatestEmailVerification(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected sql.ErrNoRows before any verification, got %v", err)
+			}
+			timeNow := time.Now().Round(time.Microsecond)
+			for hash, createdAt := range map[string]time.Time{
+				"older": timeNow.Add(-time.Minute),
+				"newer": timeNow,
+			} {
+				err := s.CreateEmailVerification(ctx, database.CreateEmailVerificationParams{TokenHash: hash, UserID: user.ID, Email: user.Email, CreatedAt: createdAt, ExpiresAt: createdAt.Add(time.Hour)})
+				if err != nil {
+					t.Fatalf("unable to create verification: %v", err)
+				}
+			}
+			latest, err := s.GetLatestEmailVerification(ctx, user.ID)
+			if err != nil || !latest.Equal(timeNow) {
+				t.Fatalf("expected the newest verification time, got %v (err %v)", latest, err)
+			}
+
+			consumed, err := s.ConsumeEmailVerification(ctx, database.ConsumeEmailVerificationParams{TokenHash: "newer", Now: timeNow})
+			if err != nil || consumed.UserID != user.ID || consumed.Email != "a@example.com" {
+				t.Fatalf("unexpected verification %+v (err %v)", consumed, err)
+			}
+			if _, err := s.ConsumeEmailVerification(ctx, database.ConsumeEmailVerificationParams{TokenHash: "newer", Now: timeNow}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected a used verification to be rejected, got %v", err)
+			}
+			if _, err := s.ConsumeEmailVerification(ctx, database.ConsumeEmailVerificationParams{TokenHash: "older", Now: timeNow.Add(2 * time.Hour)}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected an expired verification to be rejected, got %v", err)
+			}
+
+			if rows, _ := s.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{VerifiedAt: timeNow, ID: user.ID, Email: "old@example.com"}); rows != 0 {
+				t.Fatalf("expected a stale email not to verify the user")
+			}
+			if rows, err := s.MarkEmailVerified(ctx, database.MarkEmailVerifiedParams{VerifiedAt: timeNow, ID: user.ID, Email: user.Email}); err != nil || rows != 1 {
+				t.Fatalf("expected the user to be verified, got %d (err %v)", rows, err)
+			}
+			updated, _ := s.UpdateUser(ctx, database.UpdateUserParams{ID: user.ID, Email: user.Email, HashedPassword: "new hash"})
+			if !updated.EmailVerifiedAt.Valid {
+				t.Fatalf("expected a password change to keep the email verified")
+			}
+			updated, _ = s.UpdateUser(ctx, database.UpdateUserParams{ID: user.ID, Email: "b@example.com", HashedPassword: "new hash"})
+			if updated.EmailVerifiedAt.Valid {
+				t.Fatalf("expected a new email to need verifying again")
+			}
+
+			s.DeleteUserEmailVerifications(ctx, user.ID)
+			if _, err := s.GetLatestEmailVerification(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected the verifications to be deleted, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStorePasswordResets(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			timeNow := time.Now()
+			for hash, expiresAt := range map[string]time.Time{
+				"live":    timeNow.Add(time.Hour),
+				"expired": timeNow.Add(-time.Hour),
+				"spare":   timeNow.Add(time.Hour),
+			} {
+				err := s.CreatePasswordReset(ctx, database.CreatePasswordResetParams{TokenHash: hash, UserID: user.ID, CreatedAt: timeNow, ExpiresAt: expiresAt})
+				if err != nil {
+					t.Fatalf("unable to create reset: %v", err)
+				}
+			}
+			userID, err := s.ConsumePasswordReset(ctx, database.ConsumePasswordResetParams{Now: timeNow, TokenHash: "live"})
+			if err != nil || userID != user.ID {
+				t.Fatalf("expected the reset to belong to the user, got %v (err %v)", userID, err)
+			}
+			if _, err := s.ConsumePasswordReset(ctx, database.ConsumePasswordResetParams{Now: timeNow, TokenHash: "live"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected a used reset to be rejected, got %v", err)
+			}
+			if _, err := s.ConsumePasswordReset(ctx, database.ConsumePasswordResetParams{Now: timeNow, TokenHash: "expired"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected an expired reset to be rejected, got %v", err)
+			}
+			if err := s.DeleteUserPasswordResets(ctx, user.ID); err != nil {
+				t.Fatalf("unable to delete resets: %v", err)
+			}
+			if _, err := s.ConsumePasswordReset(ctx, database.ConsumePasswordResetParams{Now: timeNow, TokenHash: "spare"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected deleted resets to be rejected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreRefreshTokens(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user, err := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			if err != nil {
+				t.Fatalf("unable to create user: %v", err)
+			}
+			timeNow := time.Now()
+			for token, expiresAt := range map[string]time.Time{
+				"live":    timeNow.Add(time.Hour),
+				"expired": timeNow.Add(-time.Hour),
+			} {
+				_, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+					TokenHash: token,
+					CreatedAt: timeNow,
+					UpdatedAt: timeNow,
+					UserID:    user.ID,
+					ExpiresAt: expiresAt,
+				})
+				if err != nil {
+					t.Fatalf("unable to create refresh token: %v", err)
+				}
+			}
+			if got, err := s.GetRefreshToken(ctx, "live"); err != nil || got != "live" {
+				t.Fatalf("expected live token, got %q (err %v)", got, err)
+			}
+			if _, err := s.GetRefreshToken(ctx, "expired"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected expired token to be rejected, got %v", err)
+			}
+			userID, err := s.GetUserFromRefreshToken(ctx, "live")
+			if err != nil || userID != user.ID {
+				t.Fatalf("expected token to belong to user, got %v (err %v)", userID, err)
+			}
+			if err := s.RevokeRefreshToken(ctx, "live"); err != nil {
+				t.Fatalf("unable to revoke token: %v", err)
+			}
+			if _, err := s.GetRefreshToken(ctx, "live"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected revoked token to be rejected, got %v", err)
+			}
+
+			for _, token := range []string{"phone", "laptop"} {
+				s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{TokenHash: token, CreatedAt: timeNow, UpdatedAt: timeNow, UserID: user.ID, ExpiresAt: timeNow.Add(time.Hour)})
+			}
+			if err := s.RevokeUserRefreshTokens(ctx, user.ID); err != nil {
+				t.Fatalf("unable to revoke the user's tokens: %v", err)
+			}
+			for _, token := range []string{"phone", "laptop"} {
+				if _, err := s.GetRefreshToken(ctx, token); !errors.Is(err, sql.ErrNoRows) {
+					t.Fatalf("expected %s to be revoked, got %v", token, err)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreRefreshTokenRotation(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user, err := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			if err != nil {
+				t.Fatalf("unable to create user: %v", err)
+			}
+			timeNow := time.Now()
+			family, other := uuid.New(), uuid.New()
+			for token, familyID := range map[string]uuid.UUID{"first": family, "second": family, "other": other} {
+				_, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+					TokenHash: token,
+					CreatedAt: timeNow,
+					UpdatedAt: timeNow,
+					UserID:    user.ID,
+					ExpiresAt: timeNow.Add(time.Hour),
+					FamilyID:  familyID,
+				})
+				if err != nil {
+					t.Fatalf("unable to create refresh token: %v", err)
+				}
+			}
+
+			rotated, err := s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{Now: timeNow, TokenHash: "first"})
+			if err != nil || rotated.UserID != user.ID || rotated.FamilyID != family {
+				t.Fatalf("expected first token to rotate, got %+v (err %v)", rotated, err)
+			}
+			if _, err := s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{Now: timeNow, TokenHash: "first"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected a rotated token not to rotate again, got %v", err)
+			}
+			if _, err := s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{Now: timeNow.Add(2 * time.Hour), TokenHash: "second"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected an expired token not to rotate, got %v", err)
+			}
+			stale, err := s.GetRefreshTokenByHash(ctx, "first")
+			if err != nil || !stale.RotatedAt.Valid || !stale.RevokedAt.Valid {
+				t.Fatalf("expected first token to be marked rotated, got %+v (err %v)", stale, err)
+			}
+			if _, err := s.GetRefreshTokenByHash(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected missing token to be not found, got %v", err)
+			}
+
+			if err := s.RevokeRefreshTokenFamily(ctx, family); err != nil {
+				t.Fatalf("unable to revoke the family: %v", err)
+			}
+			if _, err := s.GetRefreshToken(ctx, "second"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected second token to be revoked with its family, got %v", err)
+			}
+			second, _ := s.GetRefreshTokenByHash(ctx, "second")
+			if second.RotatedAt.Valid {
+				t.Fatalf("expected a revoked token not to count as rotated")
+			}
+			if _, err := s.GetRefreshToken(ctx, "other"); err != nil {
+				t.Fatalf("expected a token from another family to survive, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreSessions(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			alice, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			bob, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "b"})
+			timeNow := time.Now()
+			families := map[string]uuid.UUID{"phone": uuid.New(), "laptop": uuid.New(), "old": uuid.New()}
+			for i, token := range []string{"phone", "laptop", "old"} {
+				expiresAt := timeNow.Add(time.Hour)
+				if token == "old" {
+					expiresAt = timeNow.Add(-time.Hour)
+				}
+				_, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+					TokenHash:  token,
+					CreatedAt:  timeNow,
+					UpdatedAt:  timeNow,
+					UserID:     alice.ID,
+					ExpiresAt:  expiresAt,
+					FamilyID:   families[token],
+					UserAgent:  token + "-agent",
+					Ip:         "127.0.0.1",
+					LastUsedAt: timeNow.Add(time.Duration(i) * time.Minute),
+				})
+				if err != nil {
+					t.Fatalf("unable to create refresh token: %v", err)
+				}
+			}
+
+			sessions, err := s.ListUserSessions(ctx, alice.ID)
+			if err != nil || len(sessions) != 2 {
+				t.Fatalf("expected 2 live sessions, got %d (err %v)", len(sessions), err)
+			}
+			if sessions[0].TokenHash != "laptop" || sessions[0].UserAgent != "laptop-agent" || sessions[0].Ip != "127.0.0.1" {
+				t.Fatalf("expected the most recently used session first, got %+v", sessions[0])
+			}
+
+			rotated, err := s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{Now: timeNow.Add(time.Hour / 2), TokenHash: "phone"})
+			if err != nil || !rotated.LastUsedAt.After(timeNow.Add(2*time.Minute)) {
+				t.Fatalf("expected rotating to touch last_used_at, got %v (err %v)", rotated.LastUsedAt, err)
+			}
+
+			revoked, err := s.RevokeUserSession(ctx, database.RevokeUserSessionParams{UserID: bob.ID, FamilyID: families["laptop"]})
+			if err != nil || revoked != 0 {
+				t.Fatalf("expected bob not to revoke alice's session, got %d (err %v)", revoked, err)
+			}
+			revoked, err = s.RevokeUserSession(ctx, database.RevokeUserSessionParams{UserID: alice.ID, FamilyID: families["laptop"]})
+			if err != nil || revoked != 1 {
+				t.Fatalf("expected 1 token revoked, got %d (err %v)", revoked, err)
+			}
+			//phone was rotated without a new token being stored, so nothing is left
+			sessions, _ = s.ListUserSessions(ctx, alice.ID)
+			if len(sessions) != 0 {
+				t.Fatalf("expected no live sessions, got %+v", sessions)
+			}
+		})
+	}
+}
+
+func TestStorePersonalAccessTokens(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			alice, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			bob, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "b"})
+			timeNow := time.Now()
+			tokens := map[string]database.CreatePersonalAccessTokenParams{
+				"bot":     {Name: "bot", ExpiresAt: sql.NullTime{}},
+				"ci":      {Name: "ci", ExpiresAt: sql.NullTime{Time: timeNow.Add(time.Hour), Valid: true}},
+				"expired": {Name: "expired", ExpiresAt: sql.NullTime{Time: timeNow.Add(-time.Hour), Valid: true}},
+			}
+			for i, hash := range []string{"bot", "ci", "expired"} {
+				arg := tokens[hash]
+				arg.ID = uuid.New()
+				arg.UserID = alice.ID
+				arg.TokenHash = hash
+				arg.Scopes = "chirps:read chirps:write"
+				arg.CreatedAt = timeNow.Add(time.Duration(i) * time.Minute)
+				if _, err := s.CreatePersonalAccessToken(ctx, arg); err != nil {
+					t.Fatalf("unable to create token: %v", err)
+				}
+				tokens[hash] = arg
+			}
+			dup := tokens["bot"]
+			dup.ID = uuid.New()
+			if _, err := s.CreatePersonalAccessToken(ctx, dup); err == nil {
+				t.Fatalf("expected a duplicate token hash to fail")
+			}
+
+			used, err := s.UsePersonalAccessToken(ctx, database.UsePersonalAccessTokenParams{Now: timeNow, TokenHash: "ci"})
+			if err != nil || used.UserID != alice.ID || used.Scopes != "chirps:read chirps:write" || !used.LastUsedAt.Valid {
+				t.Fatalf("expected ci token to be usable, got %+v (err %v)", used, err)
+			}
+			if _, err := s.UsePersonalAccessToken(ctx, database.UsePersonalAccessTokenParams{Now: timeNow, TokenHash: "expired"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected expired token to be rejected, got %v", err)
+			}
+
+			listed, err := s.ListPersonalAccessTokens(ctx, alice.ID)
+			if err != nil || len(listed) != 3 || listed[0].Name != "expired" || listed[2].Name != "bot" {
+				t.Fatalf("expected alice's tokens newest first, got %+v (err %v)", listed, err)
+			}
+
+			revoked, err := s.RevokePersonalAccessToken(ctx, database.RevokePersonalAccessTokenParams{UserID: bob.ID, ID: tokens["bot"].ID})
+			if err != nil || revoked != 0 {
+				t.Fatalf("expected bob not to revoke alice's token, got %d (err %v)", revoked, err)
+			}
+			revoked, err = s.RevokePersonalAccessToken(ctx, database.RevokePersonalAccessTokenParams{UserID: alice.ID, ID: tokens["bot"].ID})
+			if err != nil || revoked != 1 {
+				t.Fatalf("expected 1 token revoked, got %d (err %v)", revoked, err)
+			}
+			if _, err := s.UsePersonalAccessToken(ctx, database.UsePersonalAccessTokenParams{Now: timeNow, TokenHash: "bot"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected revoked token to be rejected, got %v", err)
+			}
+			listed, _ = s.ListPersonalAccessTokens(ctx, alice.ID)
+			if len(listed) != 2 {
+				t.Fatalf("expected revoked tokens to be left out, got %d", len(listed))
+			}
+		})
+	}
+}
+
+func TestStoreOAuth(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			alice, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			bob, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "b"})
+			timeNow := time.Now()
+			client, err := s.CreateOAuthClient(ctx, database.CreateOAuthClientParams{
+				ID:           uuid.New(),
+				UserID:       alice.ID,
+				Name:         "app",
+				SecretHash:   sql.NullString{String: "secret", Valid: true},
+				RedirectUris: "https://app.example.com/callback",
+				CreatedAt:    timeNow,
+			})
+			if err != nil || client.Name != "app" || client.SecretHash.String != "secret" {
+				t.Fatalf("unable to create client: %+v (err %v)", client, err)
+			}
+			got, err := s.GetOAuthClient(ctx, client.ID)
+			if err != nil || got.RedirectUris != client.RedirectUris {
+				t.Fatalf("expected to get the client back, got %+v (err %v)", got, err)
+			}
+			listed, err := s.ListOAuthClients(ctx, alice.ID)
+			if err != nil || len(listed) != 1 || listed[0].ID != client.ID {
+				t.Fatalf("expected alice's client listed, got %+v (err %v)", listed, err)
+			}
+
+			code := database.CreateOAuthAuthorizationCodeParams{
+				CodeHash:      "code",
+				ClientID:      client.ID,
+				UserID:        bob.ID,
+				RedirectUri:   "https://app.example.com/callback",
+				Scopes:        "chirps:read",
+				CodeChallenge: "challenge",
+				FamilyID:      uuid.New(),
+				CreatedAt:     timeNow,
+				ExpiresAt:     timeNow.Add(10 * time.Minute),
+			}
+			if err := s.CreateOAuthAuthorizationCode(ctx, code); err != nil {
+				t.Fatalf("unable to create code: %v", err)
+			}
+			used, err := s.UseOAuthAuthorizationCode(ctx, database.UseOAuthAuthorizationCodeParams{Now: timeNow, CodeHash: "code"})
+			if err != nil || used.UserID != bob.ID || used.FamilyID != code.FamilyID || !used.UsedAt.Valid {
+				t.Fatalf("expected the code to be usable once, got %+v (err %v)", used, err)
+			}
+			if _, err := s.UseOAuthAuthorizationCode(ctx, database.UseOAuthAuthorizationCodeParams{Now: timeNow, CodeHash: "code"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected a used code to be rejected, got %v", err)
+			}
+			stale, err := s.GetOAuthAuthorizationCode(ctx, "code")
+			if err != nil || !stale.UsedAt.Valid {
+				t.Fatalf("expected to find the used code, got %+v (err %v)", stale, err)
+			}
+			code.CodeHash = "expired"
+			code.ExpiresAt = timeNow.Add(-time.Minute)
+			s.CreateOAuthAuthorizationCode(ctx, code)
+			if _, err := s.UseOAuthAuthorizationCode(ctx, database.UseOAuthAuthorizationCodeParams{Now: timeNow, CodeHash: "expired"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected an expired code to be rejected, got %v", err)
+			}
+
+			//refresh tokens only rotate for the client they were issued to
+			_, err = s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+				TokenHash:  "client-token",
+				CreatedAt:  timeNow,
+				UpdatedAt:  timeNow,
+				UserID:     bob.ID,
+				ExpiresAt:  timeNow.Add(time.Hour),
+				FamilyID:   code.FamilyID,
+				LastUsedAt: timeNow,
+				ClientID:   uuid.NullUUID{UUID: client.ID, Valid: true},
+				Scopes:     "chirps:read",
+			})
+			if err != nil {
+				t.Fatalf("unable to create refresh token: %v", err)
+			}
+			if _, err := s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{Now: timeNow, TokenHash: "client-token"}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected a client's token not to rotate without the client, got %v", err)
+			}
+			rotated, err := s.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{Now: timeNow, TokenHash: "client-token", ClientID: uuid.NullUUID{UUID: client.ID, Valid: true}})
+			if err != nil || rotated.Scopes != "chirps:read" || rotated.ClientID.UUID != client.ID {
+				t.Fatalf("expected the client's token to rotate, got %+v (err %v)", rotated, err)
+			}
+
+			deleted, err := s.DeleteOAuthClient(ctx, database.DeleteOAuthClientParams{UserID: bob.ID, ID: client.ID})
+			if err != nil || deleted != 0 {
+				t.Fatalf("expected bob not to delete alice's client, got %d (err %v)", deleted, err)
+			}
+			deleted, err = s.DeleteOAuthClient(ctx, database.DeleteOAuthClientParams{UserID: alice.ID, ID: client.ID})
+			if err != nil || deleted != 1 {
+				t.Fatalf("expected 1 client deleted, got %d (err %v)", deleted, err)
+			}
+			if _, err := s.GetRefreshTokenByHash(ctx, "client-token"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected the client's tokens to go with it, got %v", err)
+			}
+			if _, err := s.GetOAuthAuthorizationCode(ctx, "code"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected the client's codes to go with it, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreTwoFactor(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			timeNow := time.Now()
+			totp, err := s.StartTOTPEnrollment(ctx, database.StartTOTPEnrollmentParams{UserID: user.ID, Secret: "first", CreatedAt: timeNow})
+			if err != nil || totp.Secret != "first" || totp.ConfirmedAt.Valid {
+				t.Fatalf("unable to start enrollment: %+v (err %v)", totp, err)
+			}
+			totp, err = s.StartTOTPEnrollment(ctx, database.StartTOTPEnrollmentParams{UserID: user.ID, Secret: "second", CreatedAt: timeNow})
+			if err != nil || totp.Secret != "second" {
+				t.Fatalf("expected enrolling again to replace the secret, got %+v (err %v)", totp, err)
+			}
+			confirmed, err := s.ConfirmUserTOTP(ctx, database.ConfirmUserTOTPParams{
+				UserID:       user.ID,
+				ConfirmedAt:  sql.NullTime{Time: timeNow, Valid: true},
+				LastUsedStep: 100,
+			})
+			if err != nil || confirmed != 1 {
+				t.Fatalf("unable to confirm: %d (err %v)", confirmed, err)
+			}
+			if _, err := s.StartTOTPEnrollment(ctx, database.StartTOTPEnrollmentParams{UserID: user.ID, Secret: "third", CreatedAt: timeNow}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected enrolling with 2FA on to be refused, got %v", err)
+			}
+			totp, err = s.GetUserTOTP(ctx, user.ID)
+			if err != nil || totp.Secret != "second" || !totp.ConfirmedAt.Valid || totp.LastUsedStep != 100 {
+				t.Fatalf("expected the confirmed secret, got %+v (err %v)", totp, err)
+			}
+			for _, step := range []int64{100, 99} {
+				if used, _ := s.UseTOTPStep(ctx, database.UseTOTPStepParams{UserID: user.ID, LastUsedStep: step}); used != 0 {
+					t.Fatalf("expected step %d to be refused", step)
+				}
+			}
+			if used, err := s.UseTOTPStep(ctx, database.UseTOTPStepParams{UserID: user.ID, LastUsedStep: 101}); err != nil || used != 1 {
+				t.Fatalf("expected a newer step to be accepted: %d (err %v)", used, err)
+			}
+
+			if err := s.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{CodeHash: "code", UserID: user.ID, CreatedAt: timeNow}); err != nil {
+				t.Fatalf("unable to create recovery code: %v", err)
+			}
+			use := database.UseRecoveryCodeParams{UserID: user.ID, CodeHash: "code", UsedAt: sql.NullTime{Time: timeNow, Valid: true}}
+			if used, err := s.UseRecoveryCode(ctx, use); err != nil || used != 1 {
+				t.Fatalf("expected the recovery code to work once: %d (err %v)", used, err)
+			}
+			if used, _ := s.UseRecoveryCode(ctx, use); used != 0 {
+				t.Fatalf("expected a used recovery code to be refused")
+			}
+
+			challenge := database.CreateLoginChallengeParams{TokenHash: "challenge", UserID: user.ID, CreatedAt: timeNow, ExpiresAt: timeNow.Add(5 * time.Minute)}
+			if err := s.CreateLoginChallenge(ctx, challenge); err != nil {
+				t.Fatalf("unable to create challenge: %v", err)
+			}
+			if err := s.FailLoginChallenge(ctx, "challenge"); err != nil {
+				t.Fatalf("unable to fail challenge: %v", err)
+			}
+			got, err := s.GetLoginChallenge(ctx, database.GetLoginChallengeParams{TokenHash: "challenge", Now: timeNow})
+			if err != nil || got.UserID != user.ID || got.FailedAttempts != 1 {
+				t.Fatalf("expected the challenge with one failure, got %+v (err %v)", got, err)
+			}
+			if _, err := s.GetLoginChallenge(ctx, database.GetLoginChallengeParams{TokenHash: "challenge", Now: timeNow.Add(time.Hour)}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected an expired challenge to be gone, got %v", err)
+			}
+			if used, err := s.UseLoginChallenge(ctx, database.UseLoginChallengeParams{Now: timeNow, TokenHash: "challenge"}); err != nil || used != 1 {
+				t.Fatalf("expected the challenge to be used once: %d (err %v)", used, err)
+			}
+			if used, _ := s.UseLoginChallenge(ctx, database.UseLoginChallengeParams{Now: timeNow, TokenHash: "challenge"}); used != 0 {
+				t.Fatalf("expected a used challenge to be refused")
+			}
+			if _, err := s.GetLoginChallenge(ctx, database.GetLoginChallengeParams{TokenHash: "challenge", Now: timeNow}); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected a used challenge to be gone, got %v", err)
+			}
+
+			if err := s.DeleteUserTOTP(ctx, user.ID); err != nil {
+				t.Fatalf("unable to delete totp: %v", err)
+			}
+			if err := s.DeleteUserRecoveryCodes(ctx, user.ID); err != nil {
+				t.Fatalf("unable to delete recovery codes: %v", err)
+			}
+			if _, err := s.GetUserTOTP(ctx, user.ID); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected 2FA to be off, got %v", err)
+			}
+		})
+	}
+}
+
+func TestStoreLoginThrottles(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			timeNow := time.Now()
+			if _, err := s.GetLoginThrottle(ctx, "ip:1.2.3.4"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected no throttle before a failure, got %v", err)
+			}
+			for i := 1; i <= 3; i++ {
+				throttle, err := s.RecordLoginFailure(ctx, database.RecordLoginFailureParams{Key: "ip:1.2.3.4", Now: timeNow, WindowStart: timeNow.Add(-time.Hour)})
+				if err != nil || throttle.Failures != int32(i) {
+					t.Fatalf("expected failure %d, got %+v (err %v)", i, throttle, err)
+				}
+			}
+			lockedUntil := sql.NullTime{Time: timeNow.Add(time.Minute), Valid: true}
+			if err := s.LockLoginThrottle(ctx, database.LockLoginThrottleParams{Key: "ip:1.2.3.4", LockedUntil: lockedUntil}); err != nil {
+				t.Fatalf("unable to lock: %v", err)
+			}
+			throttle, err := s.GetLoginThrottle(ctx, "ip:1.2.3.4")
+			if err != nil || throttle.Failures != 3 || !throttle.LockedUntil.Valid || !throttle.LockedUntil.Time.After(timeNow) {
+				t.Fatalf("expected a locked throttle, got %+v (err %v)", throttle, err)
+			}
+
+			//a failure after the window starts the count over
+			later := timeNow.Add(2 * time.Hour)
+			throttle, err = s.RecordLoginFailure(ctx, database.RecordLoginFailureParams{Key: "ip:1.2.3.4", Now: later, WindowStart: later.Add(-time.Hour)})
+			if err != nil || throttle.Failures != 1 {
+				t.Fatalf("expected the count to start over, got %+v (err %v)", throttle, err)
+			}
+			if _, err := s.RecordLoginFailure(ctx, database.RecordLoginFailureParams{Key: "account:a@example.com", Now: later, WindowStart: later.Add(-time.Hour)}); err != nil {
+				t.Fatalf("unable to record failure: %v", err)
+			}
+
+			if deleted, err := s.DeleteLoginThrottle(ctx, "ip:1.2.3.4"); err != nil || deleted != 1 {
+				t.Fatalf("expected the throttle to be deleted: %d (err %v)", deleted, err)
+			}
+			if deleted, _ := s.DeleteLoginThrottle(ctx, "ip:1.2.3.4"); deleted != 0 {
+				t.Fatalf("expected nothing left to delete")
+			}
+			if throttle, err := s.GetLoginThrottle(ctx, "account:a@example.com"); err != nil || throttle.Failures != 1 {
+				t.Fatalf("expected the other key to be left alone, got %+v (err %v)", throttle, err)
+			}
+		})
+	}
+}
+
+func TestStorePasswordResetThrottles(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			timeNow := time.Now()
+			count := func(now time.Time) (database.PasswordResetThrottle, error) {
+				return s.CountPasswordResetRequest(ctx, database.CountPasswordResetRequestParams{Key: "ip:1.2.3.4", Now: now, WindowStart: now.Add(-time.Hour), MaxRequests: 2})
+			}
+			if _, err := s.GetPasswordResetThrottle(ctx, "ip:1.2.3.4"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected no throttle before a request, got %v", err)
+			}
+			for i := 1; i <= 2; i++ {
+				throttle, err := count(timeNow)
+				if err != nil || throttle.Requests != int32(i) {
+					t.Fatalf("expected request %d, got %+v (err %v)", i, throttle, err)
+				}
+			}
+			//a full window turns requests away without counting them or moving the window
+			if _, err := count(timeNow.Add(30 * time.Minute)); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected a full window to turn the request away, got %v", err)
+			}
+			throttle, err := s.GetPasswordResetThrottle(ctx, "ip:1.2.3.4")
+			if err != nil || throttle.Requests != 2 || throttle.WindowStartedAt.Sub(timeNow).Abs() > time.Second {
+				t.Fatalf("expected the window to be left alone, got %+v (err %v)", throttle, err)
+			}
+
+			//the window ends an hour after it started however many requests came in
+			later := timeNow.Add(time.Hour)
+			throttle, err = count(later)
+			if err != nil || throttle.Requests != 1 {
+				t.Fatalf("expected a new window, got %+v (err %v)", throttle, err)
+			}
+
+			if deleted, err := s.DeletePasswordResetThrottle(ctx, "ip:1.2.3.4"); err != nil || deleted != 1 {
+				t.Fatalf("expected the throttle to be deleted: %d (err %v)", deleted, err)
+			}
+			if deleted, _ := s.DeletePasswordResetThrottle(ctx, "ip:1.2.3.4"); deleted != 0 {
+				t.Fatalf("expected nothing left to delete")
+			}
+		})
+	}
+}
+
+func TestStorePasskeys(t *testing.T) {
+	for name, s := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			alice, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "hash", Handle: "a"})
+			bob, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "hash", Handle: "b"})
+			timeNow := time.Now()
+			params := database.CreateWebAuthnCredentialParams{
+				ID:           uuid.New(),
+				UserID:       alice.ID,
+				CredentialID: "cred",
+				PublicKey:    []byte{0xa5, 0x01, 0x02},
+				Name:         "phone",
+				Transports:   "internal hybrid",
+				CreatedAt:    timeNow,
+			}
+			cred, err := s.CreateWebAuthnCredential(ctx, params)
+			if err != nil || cred.Name != "phone" || string(cred.PublicKey) != string(params.PublicKey) {
+				t.Fatalf("unable to create passkey: %+v (err %v)", cred, err)
+			}
+			params.ID = uuid.New()
+			params.UserID = bob.ID
+			if _, err := s.CreateWebAuthnCredential(ctx, params); err == nil {
+				t.Fatalf("expected a credential id to only be registered once")
+			}
+			got, err := s.GetWebAuthnCredential(ctx, "cred")
+			if err != nil || got.ID != cred.ID || got.UserID != alice.ID {
+				t.Fatalf("expected alice's passkey, got %+v (err %v)", got, err)
+			}
+			err = s.UseWebAuthnCredential(ctx, database.UseWebAuthnCredentialParams{ID: cred.ID, SignCount: 7, LastUsedAt: sql.NullTime{Time: timeNow, Valid: true}})
+			if err != nil {
+				t.Fatalf("unable to use passkey: %v", err)
+			}
+			listed, err := s.ListWebAuthnCredentials(ctx, alice.ID)
+			if err != nil || len(listed) != 1 || listed[0].SignCount != 7 || !listed[0].LastUsedAt.Valid {
+				t.Fatalf("expected the used passkey listed, got %+v (err %v)", listed, err)
+			}
+			if deleted, _ := s.DeleteWebAuthnCredential(ctx, database.DeleteWebAuthnCredentialParams{UserID: bob.ID, ID: cred.ID}); deleted != 0 {
+				t.Fatalf("expected bob not to delete alice's passkey")
+			}
+			if deleted, err := s.DeleteWebAuthnCredential(ctx, database.DeleteWebAuthnCredentialParams{UserID: alice.ID, ID: cred.ID}); err != nil || deleted != 1 {
+				t.Fatalf("unable to delete passkey: %d (err %v)", deleted, err)
+			}
+			if _, err := s.GetWebAuthnCredential(ctx, "cred"); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected the passkey to be gone, got %v", err)
+			}
+
+			ceremony := database.CreateWebAuthnChallengeParams{
+				Challenge: "register",
+				UserID:    uuid.NullUUID{UUID: alice.ID, Valid: true},
+				Kind:      "register",
+				CreatedAt: timeNow,
+				ExpiresAt: timeNow.Add(5 * time.Minute),
+			}
+			if err := s.CreateWebAuthnChallenge(ctx, ceremony); err != nil {
+				t.Fatalf("unable to create challenge: %v", err)
+			}
+			ceremony.Challenge, ceremony.UserID, ceremony.Kind = "login", uuid.NullUUID{}, "login"
+			if err := s.CreateWebAuthnChallenge(ctx, ceremony); err != nil {
+				t.Fatalf("unable to create challenge: %v", err)
+			}
+			use := database.UseWebAuthnChallengeParams{Now: timeNow, Challenge: "register", Kind: "login"}
+			if _, err := s.UseWebAuthnChallenge(ctx, use); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected a challenge to only work for its kind, got %v", err)
+			}
+			use.Kind = "register"
+			if userID, err := s.UseWebAuthnChallenge(ctx, use); err != nil || userID.UUID != alice.ID {
+				t.Fatalf("expected the registration challenge for alice, got %v (err %v)", userID, err)
+			}
+			if _, err := s.UseWebAuthnChallenge(ctx, use); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected a used challenge to be refused, got %v", err)
+			}
+			use = database.UseWebAuthnChallengeParams{Now: timeNow.Add(time.Hour), Challenge: "login", Kind: "login"}
+			if _, err := s.UseWebAuthnChallenge(ctx, use); !errors.Is(err, sql.ErrNoRows) {
+				t.Fatalf("expected an expired challenge to be refused, got %v", err)
+			}
+			use.Now = timeNow
+			if userID, err := s.UseWebAuthnChallenge(ctx, use); err != nil || userID.Valid {
+				t.Fatalf("expected a login challenge with no user, got %v (err %v)", userID, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package webauthn
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want any
+	}{
+		{name: "small int", in: []byte{0x17}, want: int64(23)},
+		{name: "uint16", in: []byte{0x19, 0x03, 0xe8}, want: int64(1000)},
+		{name: "negative", in: []byte{0x38, 0x63}, want: int64(-100)},
+		{name: "bytes", in: []byte{0x43, 1, 2, 3}, want: []byte{1, 2, 3}},
+		{name: "text", in: []byte{0x64, 'n', 'o', 'n', 'e'}, want: "none"},
+		{name: "array", in: []byte{0x82, 0x01, 0xf5}, want: []any{int64(1), true}},
+		{name: "map", in: []byte{0xa2, 0x01, 0x02, 0x20, 0x41, 0xff}, want: map[any]any{int64(1): int64(2), int64(-1): []byte{0xff}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trailing := []byte{0x00}
+			got, rest, err := decodeCBOR(append(tt.in, trailing...))
+			if err != nil {
+				t.Fatalf("unable to decode: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %#v, got %#v", tt.want, got)
+			}
+			if !bytes.Equal(rest, trailing) {
+				t.Fatalf("expected the trailing byte left over, got %x", rest)
+			}
+		})
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x81}, cborMaxDepth+2)
+	tests := map[string][]byte{
+		"empty":               {},
+		"truncated bytes":     {0x45, 1, 2},
+		"truncated length":    {0x19, 0x03},
+		"array longer":        {0x9a, 0xff, 0xff, 0xff, 0xff},
+		"indefinite length":   {0x5f, 0x41, 0x00, 0xff},
+		"duplicate key":       {0xa2, 0x01, 0x01, 0x01, 0x02},
+		"byte string map key": {0xa1, 0x41, 0x00, 0x01},
+		"tag":                 {0xc0, 0x01},
+		"nested too deeply":   append(deep, 0x00),
+	}
+	for name, in := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(in); !errors.Is(err, errCBOR) {
+				t.Fatalf("expected a cbor error, got %v", err)
+			}
+		})
+	}
+}
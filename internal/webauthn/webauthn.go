@@ -0,0 +1,368 @@
+// Package webauthn checks passkey registrations and sign-ins (WebAuthn Level 2).
+// It asks for no attestation, so it trusts any authenticator the user picks and
+// only has to verify the credential's own signatures.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrVerification is wrapped by every reason a ceremony response is turned away
+var ErrVerification = errors.New("passkey verification failed")
+
+// authenticator data flags (WebAuthn section 6.1)
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// Base64URL is bytes that travel in JSON as unpadded base64url,
+// the way browsers' PublicKeyCredential.toJSON() writes them
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url: %w", err)
+	}
+	*b = decoded
+	return nil
+}
+
+// RelyingParty is the site passkeys are registered to. ID is its domain,
+// and Origins are the exact origins (scheme, host and port) pages are served from.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// User is who a passkey is being registered for, ID should be opaque
+// since the authenticator hands it back when signing in
+type User struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+type RelyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor names a passkey the browser should (or shouldn't) use
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions is the publicKey argument to navigator.credentials.create()
+type CreationOptions struct {
+	RP                     RelyingPartyEntity     `json:"rp"`
+	User                   User                   `json:"user"`
+	Challenge              Base64URL              `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is the publicKey argument to navigator.credentials.get()
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationCredential is what navigator.credentials.create() resolves to, as JSON
+type RegistrationCredential struct {
+	ID       string                   `json:"id"`
+	RawID    Base64URL                `json:"rawId"`
+	Type     string                   `json:"type"`
+	Response AuthenticatorAttestation `json:"response"`
+}
+
+type AuthenticatorAttestation struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject"`
+	Transports        []string  `json:"transports,omitempty"`
+}
+
+// AssertionCredential is what navigator.credentials.get() resolves to, as JSON
+type AssertionCredential struct {
+	ID       string                 `json:"id"`
+	RawID    Base64URL              `json:"rawId"`
+	Type     string                 `json:"type"`
+	Response AuthenticatorAssertion `json:"response"`
+}
+
+type AuthenticatorAssertion struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	UserHandle        Base64URL `json:"userHandle,omitempty"`
+}
+
+// Credential is a passkey that passed registration, to be stored with its user
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// the algorithms offered when registering, in order of preference
+var supportedAlgs = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// NewChallenge is 32 random bytes, enough that a challenge can't be guessed or repeated
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return nil, fmt.Errorf("error generating challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// CreationOptions asks for a discoverable passkey that verifies the user,
+// so it can sign in on its own without a password
+func (rp *RelyingParty) CreationOptions(challenge []byte, user User, exclude []CredentialDescriptor, timeoutMillis int64) CreationOptions {
+	params := make([]CredentialParameter, 0, len(supportedAlgs))
+	for _, alg := range supportedAlgs {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	return CreationOptions{
+		RP:                 RelyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            timeoutMillis,
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions leaves allowCredentials empty so the browser offers
+// every passkey the user has for this site
+func (rp *RelyingParty) RequestOptions(challenge []byte, timeoutMillis int64) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeoutMillis,
+		RPID:             rp.ID,
+		UserVerification: "required",
+	}
+}
+
+// clientData is the JSON the browser signs over (WebAuthn section 5.8.1)
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ClientChallenge reads the challenge out of a response's clientDataJSON,
+// so the server can find the ceremony it belongs to before verifying it
+func ClientChallenge(clientDataJSON []byte) ([]byte, error) {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return nil, fmt.Errorf("%w: client data isn't JSON", ErrVerification)
+	}
+	challenge, err := base64.RawURLEncoding.DecodeString(data.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("%w: client data challenge isn't base64url", ErrVerification)
+	}
+	return challenge, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("%w: client data isn't JSON", ErrVerification)
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: client data is for %q not %q", ErrVerification, data.Type, ceremony)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(data.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: challenge doesn't match", ErrVerification)
+	}
+	if !slices.Contains(rp.Origins, data.Origin) {
+		return fmt.Errorf("%w: origin %q isn't allowed", ErrVerification, data.Origin)
+	}
+	if data.CrossOrigin {
+		return fmt.Errorf("%w: cross origin requests aren't allowed", ErrVerification)
+	}
+	return nil
+}
+
+// authenticatorData is the part of a response the authenticator signs (WebAuthn section 6.1)
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data is too short", ErrVerification)
+	}
+	parsed := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if parsed.flags&flagAttestedCredData == 0 {
+		return parsed, nil
+	}
+	//16 byte aaguid, then the credential id with a 2 byte length, then its COSE_Key
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("%w: attested credential data is too short", ErrVerification)
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, fmt.Errorf("%w: credential id has a bad length", ErrVerification)
+	}
+	parsed.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("%w: credential public key: %v", ErrVerification, err)
+	}
+	parsed.publicKey = rest[:len(rest)-len(after)]
+	return parsed, nil
+}
+
+func (rp *RelyingParty) checkAuthenticatorData(data *authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(data.rpIDHash, rpIDHash[:]) != 1 {
+		return fmt.Errorf("%w: credential is for a different site", ErrVerification)
+	}
+	if data.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user wasn't present", ErrVerification)
+	}
+	if data.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user wasn't verified", ErrVerification)
+	}
+	return nil
+}
+
+// VerifyRegistration checks a new passkey against the challenge its registration was started with
+func (rp *RelyingParty) VerifyRegistration(cred RegistrationCredential, challenge []byte) (*Credential, error) {
+	if cred.Type != "public-key" {
+		return nil, fmt.Errorf("%w: credential type %q isn't public-key", ErrVerification, cred.Type)
+	}
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+	decoded, _, err := decodeCBOR(cred.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: attestation object: %v", ErrVerification, err)
+	}
+	attestation, ok := decoded.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object isn't a map", ErrVerification)
+	}
+	//only "none" is asked for, and what a statement would prove isn't used anyway
+	if format, _ := attestation["fmt"].(string); format != "none" {
+		return nil, fmt.Errorf("%w: attestation format %q isn't supported", ErrVerification, format)
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object has no authenticator data", ErrVerification)
+	}
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(authData); err != nil {
+		return nil, err
+	}
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: no credential was created", ErrVerification)
+	}
+	if !bytes.Equal(authData.credentialID, cred.RawID) {
+		return nil, fmt.Errorf("%w: credential id doesn't match", ErrVerification)
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	return &Credential{
+		ID:        slices.Clone(authData.credentialID),
+		PublicKey: slices.Clone(authData.publicKey),
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks a sign-in with a stored passkey and returns the
+// authenticator's new signature count to store in place of the old one
+func (rp *RelyingParty) VerifyAssertion(cred AssertionCredential, challenge, storedPublicKey []byte, storedSignCount uint32) (uint32, error) {
+	if cred.Type != "public-key" {
+		return 0, fmt.Errorf("%w: credential type %q isn't public-key", ErrVerification, cred.Type)
+	}
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	authData, err := parseAuthenticatorData(cred.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.checkAuthenticatorData(authData); err != nil {
+		return 0, err
+	}
+	key, err := parsePublicKey(storedPublicKey)
+	if err != nil {
+		return 0, fmt.Errorf("%w: stored public key: %v", ErrVerification, err)
+	}
+	clientDataHash := sha256.Sum256(cred.Response.ClientDataJSON)
+	signed := append(slices.Clone([]byte(cred.Response.AuthenticatorData)), clientDataHash[:]...)
+	if !key.verify(signed, cred.Response.Signature) {
+		return 0, fmt.Errorf("%w: signature is invalid", ErrVerification)
+	}
+	//authenticators that don't count always send 0, otherwise it only goes up,
+	//and it going backwards means someone has a copy of the key
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return 0, fmt.Errorf("%w: signature counter went backwards, the passkey may have been cloned", ErrVerification)
+	}
+	return authData.signCount, nil
+}
@@ -0,0 +1,144 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/joncaudill/chirpy/internal/webauthn"
+	"github.com/joncaudill/chirpy/internal/webauthn/webauthntest"
+)
+
+func testRP() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{ID: "chirpy.example", Name: "Chirpy", Origins: []string{"https://chirpy.example"}}
+}
+
+// register makes a passkey on authenticator and checks it with rp
+func register(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+	challenge, _ := webauthn.NewChallenge()
+	user := webauthn.User{ID: []byte("user-handle"), Name: "alice@example.com", DisplayName: "Alice"}
+	created, err := authenticator.Create(rp.CreationOptions(challenge, user, nil, 0))
+	if err != nil {
+		t.Fatalf("unable to create passkey: %v", err)
+	}
+	cred, err := rp.VerifyRegistration(created, challenge)
+	if err != nil {
+		t.Fatalf("unable to verify registration: %v", err)
+	}
+	return cred
+}
+
+func TestRegisterAndSignIn(t *testing.T) {
+	for name, alg := range map[string]int64{"ES256": webauthn.AlgES256, "EdDSA": webauthn.AlgEdDSA} {
+		t.Run(name, func(t *testing.T) {
+			rp := testRP()
+			authenticator := webauthntest.New("https://chirpy.example")
+			authenticator.Alg = alg
+			cred := register(t, rp, authenticator)
+
+			signCount := cred.SignCount
+			for range 2 {
+				challenge, _ := webauthn.NewChallenge()
+				assertion, err := authenticator.Get(rp.RequestOptions(challenge, 0))
+				if err != nil {
+					t.Fatalf("unable to sign in: %v", err)
+				}
+				if string(assertion.Response.UserHandle) != "user-handle" || string(assertion.RawID) != string(cred.ID) {
+					t.Fatalf("expected the registered passkey to answer, got %+v", assertion)
+				}
+				newCount, err := rp.VerifyAssertion(assertion, challenge, cred.PublicKey, signCount)
+				if err != nil {
+					t.Fatalf("unable to verify sign in: %v", err)
+				}
+				if newCount <= signCount {
+					t.Fatalf("expected the counter to go up from %d, got %d", signCount, newCount)
+				}
+				signCount = newCount
+			}
+		})
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	user := webauthn.User{ID: []byte("user-handle"), Name: "alice@example.com", DisplayName: "Alice"}
+	tests := []struct {
+		name   string
+		origin string
+		rpID   string
+		// verify against a different challenge than the one signed
+		otherChallenge bool
+	}{
+		{name: "wrong origin", origin: "https://evil.example"},
+		{name: "wrong rp id", rpID: "evil.example"},
+		{name: "wrong challenge", otherChallenge: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := testRP()
+			origin := "https://chirpy.example"
+			if tt.origin != "" {
+				origin = tt.origin
+			}
+			challenge, _ := webauthn.NewChallenge()
+			options := rp.CreationOptions(challenge, user, nil, 0)
+			if tt.rpID != "" {
+				options.RP.ID = tt.rpID
+			}
+			created, err := webauthntest.New(origin).Create(options)
+			if err != nil {
+				t.Fatalf("unable to create passkey: %v", err)
+			}
+			if tt.otherChallenge {
+				challenge, _ = webauthn.NewChallenge()
+			}
+			if _, err := rp.VerifyRegistration(created, challenge); !errors.Is(err, webauthn.ErrVerification) {
+				t.Fatalf("expected registration to be rejected, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSignInRejected(t *testing.T) {
+	rp := testRP()
+	authenticator := webauthntest.New("https://chirpy.example")
+	cred := register(t, rp, authenticator)
+
+	challenge, _ := webauthn.NewChallenge()
+	assertion, _ := authenticator.Get(rp.RequestOptions(challenge, 0))
+	tampered := assertion
+	tampered.Response.Signature = append([]byte(nil), assertion.Response.Signature...)
+	tampered.Response.Signature[len(tampered.Response.Signature)-1] ^= 1
+	if _, err := rp.VerifyAssertion(tampered, challenge, cred.PublicKey, 0); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("expected a bad signature to be rejected, got %v", err)
+	}
+	other := register(t, rp, webauthntest.New("https://chirpy.example"))
+	if _, err := rp.VerifyAssertion(assertion, challenge, other.PublicKey, 0); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("expected another passkey's key to be rejected, got %v", err)
+	}
+	if _, err := rp.VerifyAssertion(assertion, []byte("other challenge"), cred.PublicKey, 0); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("expected the wrong challenge to be rejected, got %v", err)
+	}
+
+	//a second sign in is verified first, then the older one looks like a cloned key
+	second, _ := authenticator.Get(rp.RequestOptions(challenge, 0))
+	count, err := rp.VerifyAssertion(second, challenge, cred.PublicKey, 0)
+	if err != nil {
+		t.Fatalf("unable to verify sign in: %v", err)
+	}
+	if _, err := rp.VerifyAssertion(assertion, challenge, cred.PublicKey, count); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("expected a counter going backwards to be rejected, got %v", err)
+	}
+}
+
+func TestClientChallenge(t *testing.T) {
+	rp := testRP()
+	challenge, _ := webauthn.NewChallenge()
+	created, _ := webauthntest.New("https://chirpy.example").Create(rp.CreationOptions(challenge, webauthn.User{ID: []byte("u")}, nil, 0))
+	got, err := webauthn.ClientChallenge(created.Response.ClientDataJSON)
+	if err != nil || string(got) != string(challenge) {
+		t.Fatalf("expected the challenge back, got %x (err %v)", got, err)
+	}
+	if _, err := webauthn.ClientChallenge([]byte("not json")); !errors.Is(err, webauthn.ErrVerification) {
+		t.Fatalf("expected bad client data to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+// Package webauthntest is a software passkey authenticator for tests,
+// standing in for a browser and a security key or phone.
+package webauthntest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/joncaudill/chirpy/internal/webauthn"
+)
+
+// Authenticator makes and uses passkeys the way a browser and platform authenticator would.
+// Origin is what it puts in client data as the page calling it.
+type Authenticator struct {
+	Origin string
+	// Alg is the key type new passkeys get, webauthn.AlgES256 if unset
+	Alg         int64
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	alg        int64
+	signer     crypto.Signer
+	signCount  uint32
+}
+
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Create answers navigator.credentials.create()
+func (a *Authenticator) Create(options webauthn.CreationOptions) (webauthn.RegistrationCredential, error) {
+	alg := a.Alg
+	if alg == 0 {
+		alg = webauthn.AlgES256
+	}
+	if !slices.ContainsFunc(options.PubKeyCredParams, func(p webauthn.CredentialParameter) bool { return p.Alg == alg }) {
+		return webauthn.RegistrationCredential{}, fmt.Errorf("algorithm %d wasn't offered", alg)
+	}
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RP.ID, excluded.ID) != nil {
+			return webauthn.RegistrationCredential{}, errors.New("a passkey for this account is already on the authenticator")
+		}
+	}
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case webauthn.AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case webauthn.AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("algorithm %d isn't supported", alg)
+	}
+	if err != nil {
+		return webauthn.RegistrationCredential{}, err
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	cred := &credential{
+		id:         id,
+		rpID:       options.RP.ID,
+		userHandle: slices.Clone(options.User.ID),
+		alg:        alg,
+		signer:     signer,
+	}
+	a.credentials = append(a.credentials, cred)
+
+	publicKey, err := cred.coseKey()
+	if err != nil {
+		return webauthn.RegistrationCredential{}, err
+	}
+	attested := binary.BigEndian.AppendUint16(make([]byte, 16), uint16(len(id)))
+	attested = append(append(attested, id...), publicKey...)
+	authData := cred.authenticatorData(0x01|0x04|0x40, attested)
+	attestation := encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", authData},
+	})
+	return webauthn.RegistrationCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(id),
+		RawID: id,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorAttestation{
+			ClientDataJSON:    a.clientData("webauthn.create", options.Challenge),
+			AttestationObject: attestation,
+			Transports:        []string{"internal"},
+		},
+	}, nil
+}
+
+// Get answers navigator.credentials.get(), using the newest passkey it has for the site
+// that allowCredentials lets it
+func (a *Authenticator) Get(options webauthn.RequestOptions) (webauthn.AssertionCredential, error) {
+	var cred *credential
+	for _, c := range slices.Backward(a.credentials) {
+		if c.rpID != options.RPID {
+			continue
+		}
+		if len(options.AllowCredentials) > 0 && !slices.ContainsFunc(options.AllowCredentials, func(d webauthn.CredentialDescriptor) bool { return slices.Equal(d.ID, c.id) }) {
+			continue
+		}
+		cred = c
+		break
+	}
+	if cred == nil {
+		return webauthn.AssertionCredential{}, errors.New("no passkey for this site")
+	}
+	cred.signCount++
+	authData := cred.authenticatorData(0x01|0x04, nil)
+	clientDataJSON := a.clientData("webauthn.get", options.Challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signature, err := cred.sign(append(slices.Clone(authData), clientDataHash[:]...))
+	if err != nil {
+		return webauthn.AssertionCredential{}, err
+	}
+	return webauthn.AssertionCredential{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: slices.Clone(cred.id),
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorAssertion{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: authData,
+			Signature:         signature,
+			UserHandle:        slices.Clone(cred.userHandle),
+		},
+	}, nil
+}
+
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, c := range a.credentials {
+		if c.rpID == rpID && slices.Equal(c.id, id) {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+func (c *credential) authenticatorData(flags byte, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, c.signCount)
+	return append(data, attested...)
+}
+
+func (c *credential) coseKey() ([]byte, error) {
+	switch key := c.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		point := ecdhKey.Bytes()
+		return encodeCBOR(cborMap{{1, 2}, {3, webauthn.AlgES256}, {-1, 1}, {-2, point[1:33]}, {-3, point[33:]}}), nil
+	case ed25519.PublicKey:
+		return encodeCBOR(cborMap{{1, 1}, {3, webauthn.AlgEdDSA}, {-1, 6}, {-2, []byte(key)}}), nil
+	default:
+		return nil, fmt.Errorf("unsupported key %T", key)
+	}
+}
+
+func (c *credential) sign(data []byte) ([]byte, error) {
+	if c.alg == webauthn.AlgEdDSA {
+		return c.signer.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(data)
+	return c.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
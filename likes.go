@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+type chirpLike struct {
+	UserId  uuid.UUID `json:"user_id"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+func (cfg *apiConfig) chirpsLikeHandler(w http.ResponseWriter, r *http.Request) {
+	//likes a chirp, liking it again is a no-op
+	//liking a rechirp likes the original
+	cfg.setLike(w, r, true, func(ctx context.Context, userID, chirpID uuid.UUID) error {
+		return cfg.db.LikeChirp(ctx, database.LikeChirpParams{
+			UserID:    userID,
+			ChirpID:   chirpID,
+			CreatedAt: time.Now(),
+		})
+	})
+}
+
+func (cfg *apiConfig) chirpsUnlikeHandler(w http.ResponseWriter, r *http.Request) {
+	//takes back a like, unliking a chirp that isn't liked is a no-op
+	cfg.setLike(w, r, false, func(ctx context.Context, userID, chirpID uuid.UUID) error {
+		return cfg.db.UnlikeChirp(ctx, database.UnlikeChirpParams{
+			UserID:  userID,
+			ChirpID: chirpID,
+		})
+	})
+}
+
+// setLike does the auth and chirp lookup shared by like and unlike, then hands off to change
+// checkBlocks stops users the chirp's author has blocked, taking a like back is always allowed
+func (cfg *apiConfig) setLike(w http.ResponseWriter, r *http.Request, checkBlocks bool, change func(ctx context.Context, userID, chirpID uuid.UUID) error) {
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, _ := uuid.Parse(chirpID)
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return
+	}
+	validatedUserID, scopes, err := cfg.authorize(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return
+	}
+	if !requireScope(w, scopes, auth.ScopeChirpsWrite) {
+		return
+	}
+	ctx := context.Background()
+	original, err := cfg.originalChirp(ctx, chirpUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return
+	}
+	if checkBlocks && !cfg.allowInteraction(w, ctx, validatedUserID, original) {
+		return
+	}
+	err = change(ctx, validatedUserID, original.ID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error updating like: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) chirpsLikesHandler(w http.ResponseWriter, r *http.Request) {
+	//the users who liked a chirp, most recent like first
+	//a deleted chirp, or one by someone on either side of a block with the viewer, is a 404
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, _ := uuid.Parse(chirpID)
+	page, err := parseNewestFirstPage(r.URL.Query())
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing page: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	chirpData, err := cfg.db.GetChirpById(ctx, chirpUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return
+	}
+	if chirpData.DeletedAt.Valid {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	visible, err := cfg.filterVisible(ctx, cfg.viewerID(r), []database.Chirp{chirpData}, false)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return
+	}
+	if len(visible) == 0 {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	likes, err := cfg.db.ListChirpLikes(ctx, database.ListChirpLikesParams{
+		ChirpID:         chirpUUID,
+		BeforeCreatedAt: page.Cursor.CreatedAt,
+		BeforeUserID:    page.Cursor.ID,
+		Limit:           fetchLimit(page.Limit),
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting likes: %v", err))
+		return
+	}
+	if len(likes) > page.Limit {
+		likes = likes[:page.Limit]
+		last := likes[len(likes)-1]
+		setNextLink(w, r, pageCursor{CreatedAt: last.CreatedAt, ID: last.UserID}.encode())
+	}
+	likesResp := []chirpLike{}
+	for _, like := range likes {
+		likesResp = append(likesResp, chirpLike{UserId: like.UserID, LikedAt: like.CreatedAt})
+	}
+
+	jsonResp, err := json.Marshal(likesResp)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing likes: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
+
+func (cfg *apiConfig) usersLikesHandler(w http.ResponseWriter, r *http.Request) {
+	//the chirps a user has liked, most recent like first
+	userID := r.PathValue("userID")
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing user ID: %v", err), http.StatusBadRequest)
+		return
+	}
+	page, err := parseNewestFirstPage(r.URL.Query())
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing page: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	rows, err := cfg.db.ListUserLikes(ctx, database.ListUserLikesParams{
+		UserID:          userUUID,
+		BeforeCreatedAt: page.Cursor.CreatedAt,
+		BeforeChirpID:   page.Cursor.ID,
+		Limit:           fetchLimit(page.Limit),
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting likes: %v", err))
+		return
+	}
+	if len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+		last := rows[len(rows)-1]
+		setNextLink(w, r, pageCursor{CreatedAt: last.LikedAt, ID: last.Chirp.ID}.encode())
+	}
+	chirps := make([]database.Chirp, 0, len(rows))
+	for _, row := range rows {
+		chirps = append(chirps, row.Chirp)
+	}
+	chirpsResp, err := cfg.listingViews(ctx, cfg.viewerID(r), chirps)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting likes: %v", err))
+		return
+	}
+	if err := cfg.embedAuthors(ctx, r, chirpsResp); err != nil {
+		errHandler(w, fmt.Errorf("error getting likes: %v", err))
+		return
+	}
+
+	jsonResp, err := json.Marshal(chirpsResp)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing chirps: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
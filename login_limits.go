@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// loginLimits is how many failed logins an account or an address gets before
+// it has to wait. the first lockout lasts Lockout and every failure after that
+// doubles it up to MaxLockout. failures older than Window are forgotten
+type loginLimits struct {
+	AccountFailures int
+	IPFailures      int
+	Lockout         time.Duration
+	MaxLockout      time.Duration
+	Window          time.Duration
+}
+
+func defaultLoginLimits() loginLimits {
+	return loginLimits{
+		AccountFailures: 5,
+		IPFailures:      20,
+		Lockout:         time.Minute,
+		MaxLockout:      time.Hour,
+		Window:          24 * time.Hour,
+	}
+}
+
+// loginLimitsFromEnv starts from the defaults and overrides whatever is set,
+// a limit of 0 turns that kind of lockout off
+func loginLimitsFromEnv() (loginLimits, error) {
+	limits := defaultLoginLimits()
+	counts := map[string]*int{
+		"LOGIN_MAX_FAILURES":    &limits.AccountFailures,
+		"LOGIN_IP_MAX_FAILURES": &limits.IPFailures,
+	}
+	for name, limit := range counts {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return limits, fmt.Errorf("error parsing %s: %q is not a count", name, value)
+			}
+			*limit = n
+		}
+	}
+	durations := map[string]*time.Duration{
+		"LOGIN_LOCKOUT":        &limits.Lockout,
+		"LOGIN_MAX_LOCKOUT":    &limits.MaxLockout,
+		"LOGIN_FAILURE_WINDOW": &limits.Window,
+	}
+	for name, duration := range durations {
+		if value := os.Getenv(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return limits, fmt.Errorf("error parsing %s: %q is not a duration", name, value)
+			}
+			*duration = d
+		}
+	}
+	return limits, nil
+}
+
+// lockout is how long to turn a key away after its failures'th failure
+func (l loginLimits) lockout(failures, limit int) time.Duration {
+	if limit <= 0 || failures < limit {
+		return 0
+	}
+	wait := l.Lockout
+	for i := limit; i < failures && wait < l.MaxLockout; i++ {
+		wait *= 2
+	}
+	return min(wait, l.MaxLockout)
+}
+
+// failures are counted against the email as typed rather than the user it belongs to,
+// so an email with no account locks the same way and lockouts don't give away who has signed up
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginLocked reports whether logins for the email or from the address are being turned away
+func (cfg *apiConfig) loginLocked(ctx context.Context, email, ip string) (bool, error) {
+	now := time.Now()
+	for _, key := range []string{accountThrottleKey(email), ipThrottleKey(ip)} {
+		throttle, err := cfg.db.GetLoginThrottle(ctx, key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("error getting login throttle: %v", err)
+		}
+		if throttle.LockedUntil.Valid && throttle.LockedUntil.Time.After(now) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordLoginFailure counts a failed login against the email and the address,
+// locking either one out once it is over its limit
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, email, ip string) error {
+	now := time.Now()
+	keys := map[string]int{
+		accountThrottleKey(email): cfg.loginLimits.AccountFailures,
+		ipThrottleKey(ip):         cfg.loginLimits.IPFailures,
+	}
+	for key, limit := range keys {
+		throttle, err := cfg.db.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Key:         key,
+			Now:         now,
+			WindowStart: now.Add(-cfg.loginLimits.Window),
+		})
+		if err != nil {
+			return fmt.Errorf("error recording failed login: %v", err)
+		}
+		wait := cfg.loginLimits.lockout(int(throttle.Failures), limit)
+		if wait == 0 {
+			continue
+		}
+		err = cfg.db.LockLoginThrottle(ctx, database.LockLoginThrottleParams{
+			Key:         key,
+			LockedUntil: sql.NullTime{Time: now.Add(wait), Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("error locking login: %v", err)
+		}
+	}
+	return nil
+}
+
+// clearLoginFailures forgets an account's failures once its owner gets in,
+// the address keeps its count so one good login can't reset a spray of guesses
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, email string) error {
+	_, err := cfg.db.DeleteLoginThrottle(ctx, accountThrottleKey(email))
+	if err != nil {
+		return fmt.Errorf("error clearing failed logins: %v", err)
+	}
+	return nil
+}
+
+// checkPassword checks a signed in user's password against the same lockout as logging in,
+// so a stolen access token can't be used to guess it. a failure counts towards the lockout
+// and a locked out check fails whatever the password. on failure the error response has already been written
+func (cfg *apiConfig) checkPassword(w http.ResponseWriter, r *http.Request, user database.User, password string) bool {
+	ctx := context.Background()
+	ip := clientIP(r)
+	locked, err := cfg.loginLocked(ctx, user.Email, ip)
+	if err != nil {
+		errHandler(w, err)
+		return false
+	}
+	validated := auth.CheckPasswordHash(password, user.HashedPassword)
+	if !locked && !validated {
+		err = cfg.recordLoginFailure(ctx, user.Email, ip)
+		if err != nil {
+			errHandler(w, err)
+			return false
+		}
+	}
+	if locked || !validated {
+		errHandler(w, fmt.Errorf("incorrect password"), http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// loginFailed is the one answer for a wrong password and a locked out login,
+// so a guesser can't tell when they've been locked out
+func loginFailed(w http.ResponseWriter) {
+	errHandler(w, fmt.Errorf("incorrect email or password"), http.StatusUnauthorized)
+}
+
+type unlockLoginRequest struct {
+	Email string `json:"email"`
+	IP    string `json:"ip"`
+}
+
+func (cfg *apiConfig) unlockLoginHandler(w http.ResponseWriter, r *http.Request) {
+	//clears the failed logins and password reset limits for an email, an address or both
+	//only works with ADMIN_API_KEY set, and the key has to be sent as "ApiKey <key>"
+	if cfg.adminKey == "" {
+		errHandler(w, fmt.Errorf("admin api is disabled"), http.StatusForbidden)
+		return
+	}
+	apiKey, _ := auth.GetAPIKey(r.Header)
+	if subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.adminKey)) != 1 {
+		errHandler(w, fmt.Errorf("invalid admin key"), http.StatusUnauthorized)
+		return
+	}
+	request := unlockLoginRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing unlock request: %v", err), http.StatusBadRequest)
+		return
+	}
+	keys := []string{}
+	if strings.TrimSpace(request.Email) != "" {
+		keys = append(keys, accountThrottleKey(request.Email))
+	}
+	if request.IP != "" {
+		keys = append(keys, ipThrottleKey(request.IP))
+	}
+	if len(keys) == 0 {
+		errHandler(w, fmt.Errorf("an email or an ip is required"), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	cleared := int64(0)
+	for _, key := range keys {
+		deleted, err := cfg.db.DeleteLoginThrottle(ctx, key)
+		if err != nil {
+			errHandler(w, fmt.Errorf("error clearing failed logins: %v", err))
+			return
+		}
+		cleared += deleted
+		deleted, err = cfg.db.DeletePasswordResetThrottle(ctx, key)
+		if err != nil {
+			errHandler(w, fmt.Errorf("error clearing password reset limits: %v", err))
+			return
+		}
+		cleared += deleted
+	}
+	if cleared == 0 {
+		errHandler(w, fmt.Errorf("no failed logins or password reset limits found"), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/pressly/goose/v3"
+)
+
+const migrateUsage = "usage: chirpy migrate up|down|status"
+
+// runMigrate handles `chirpy migrate up|down|status`
+// up applies every pending migration, down rolls back the latest one
+// and status lists each migration and when it was applied
+func runMigrate(ctx context.Context, provider *goose.Provider, args []string) error {
+	if provider == nil {
+		return errors.New("the configured DB_URL has no schema to migrate")
+	}
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+	switch args[0] {
+	case "up":
+		results, err := provider.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("error migrating up: %w", err)
+		}
+		if len(results) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		for _, result := range results {
+			fmt.Println(result)
+		}
+	case "down":
+		result, err := provider.Down(ctx)
+		if err != nil {
+			return fmt.Errorf("error migrating down: %w", err)
+		}
+		fmt.Println(result)
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("error getting migration status: %w", err)
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.State == goose.StateApplied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-19s %s\n", appliedAt, status.Source.Path)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
@@ -0,0 +1,666 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// oauthClient is a third-party app registered to act for chirpy users,
+// Secret is only ever filled in on the response that registers it
+type oauthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+	Secret       string    `json:"client_secret,omitempty"`
+}
+
+type oauthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Public       bool     `json:"public"`
+}
+
+// oauthAuthorizeRequest is the authorization request a client sends the user to chirpy with.
+// the consent screen reads it with GET and sends it back with approve set to the user's answer
+type oauthAuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+
+type oauthConsent struct {
+	ClientID    uuid.UUID `json:"client_id"`
+	ClientName  string    `json:"client_name"`
+	RedirectURI string    `json:"redirect_uri"`
+	Scopes      []string  `json:"scopes"`
+	State       string    `json:"state"`
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+type oauthIntrospection struct {
+	Active   bool   `json:"active"`
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Sub      string `json:"sub,omitempty"`
+	Exp      int64  `json:"exp,omitempty"`
+	Iat      int64  `json:"iat,omitempty"`
+}
+
+// oauthError is the error body from RFC 6749, RedirectTo is set by the authorization
+// endpoint once it trusts the redirect_uri, so the consent screen can send the user back
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	RedirectTo       string `json:"redirect_to,omitempty"`
+}
+
+func oauthErrHandler(w http.ResponseWriter, status int, code, description string) {
+	writeOAuthError(w, status, oauthError{Error: code, ErrorDescription: description})
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, respBody oauthError) {
+	resp, _ := json.Marshal(respBody)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(resp)
+}
+
+const (
+	oauthCodeLifetime   = 10 * time.Minute
+	oauthMaxRedirectURI = 10
+)
+
+func oauthClientFromDB(client database.OauthClient) oauthClient {
+	return oauthClient{
+		ID:           client.ID,
+		Name:         client.Name,
+		RedirectURIs: strings.Fields(client.RedirectUris),
+		Public:       !client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// validRedirectURI accepts https urls, http on the loopback address for apps running on
+// the user's own machine, and private-use schemes like com.example.app:/callback (RFC 8252)
+func validRedirectURI(raw string) bool {
+	if strings.ContainsAny(raw, " \t\r\n") {
+		return false
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || !parsed.IsAbs() || parsed.Fragment != "" {
+		return false
+	}
+	switch parsed.Scheme {
+	case "https":
+		return parsed.Host != ""
+	case "http":
+		host := parsed.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return strings.Contains(parsed.Scheme, ".")
+	}
+}
+
+// isClientToken reports whether a bearer token was issued to an OAuth client,
+// those can't register or approve other clients on the user's behalf
+func (cfg *apiConfig) isClientToken(token string) bool {
+	if strings.HasPrefix(token, auth.PersonalTokenPrefix) {
+		return false
+	}
+	claims, err := cfg.jwtKeys.ParseAccessToken(token)
+	return err == nil && claims.ClientID != ""
+}
+
+func (cfg *apiConfig) oauthClientsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	//registers a client owned by the caller
+	//confidential clients get a secret that is shown once, public ones (mobile and browser apps) rely on PKCE alone
+	validatedUserID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	request := oauthClientRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing client: %v", err), http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 100 {
+		errHandler(w, fmt.Errorf("name is required and can be at most 100 characters"), http.StatusBadRequest)
+		return
+	}
+	if len(request.RedirectURIs) == 0 || len(request.RedirectURIs) > oauthMaxRedirectURI {
+		errHandler(w, fmt.Errorf("between 1 and %d redirect_uris are required", oauthMaxRedirectURI), http.StatusBadRequest)
+		return
+	}
+	for _, redirectURI := range request.RedirectURIs {
+		if !validRedirectURI(redirectURI) {
+			errHandler(w, fmt.Errorf("redirect_uri %q must be https, http on localhost or a private-use scheme, with no fragment", redirectURI), http.StatusBadRequest)
+			return
+		}
+	}
+
+	secret := ""
+	secretHash := sql.NullString{}
+	if !request.Public {
+		secret, err = auth.MakeSecretToken()
+		if err != nil {
+			errHandler(w, fmt.Errorf("error creating client: %v", err))
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+	client, err := cfg.db.CreateOAuthClient(context.Background(), database.CreateOAuthClientParams{
+		ID:           uuid.New(),
+		UserID:       validatedUserID,
+		Name:         request.Name,
+		SecretHash:   secretHash,
+		RedirectUris: strings.Join(request.RedirectURIs, " "),
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error creating client: %v", err))
+		return
+	}
+	created := oauthClientFromDB(client)
+	created.Secret = secret
+
+	resp, _ := json.Marshal(created)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) oauthClientsListHandler(w http.ResponseWriter, r *http.Request) {
+	//lists the clients the caller registered, newest first, without their secrets
+	validatedUserID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	dbClients, err := cfg.db.ListOAuthClients(context.Background(), validatedUserID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting clients: %v", err))
+		return
+	}
+	clients := make([]oauthClient, 0, len(dbClients))
+	for _, client := range dbClients {
+		clients = append(clients, oauthClientFromDB(client))
+	}
+
+	jsonResp, err := json.Marshal(clients)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing clients: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
+
+func (cfg *apiConfig) oauthClientsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	//deletes one of the caller's clients along with every refresh token issued to it
+	clientID := r.PathValue("clientID")
+	clientUUID, _ := uuid.Parse(clientID)
+	validatedUserID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	deleted, err := cfg.db.DeleteOAuthClient(context.Background(), database.DeleteOAuthClientParams{
+		UserID: validatedUserID,
+		ID:     clientUUID,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error deleting client: %v", err))
+		return
+	}
+	if deleted == 0 {
+		errHandler(w, fmt.Errorf("client not found"), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// redirectWith adds params to a registered redirect_uri, keeping any query it already has
+func redirectWith(redirectURI string, params url.Values) string {
+	parsed, _ := url.Parse(redirectURI)
+	query := parsed.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// checkAuthorizeRequest validates an authorization request and returns the client and scopes.
+// until the client and redirect_uri check out, errors go back to the caller only, after
+// that they carry a redirect_to for the client as well. on failure the error response has
+// already been written
+func (cfg *apiConfig) checkAuthorizeRequest(w http.ResponseWriter, ctx context.Context, request oauthAuthorizeRequest) (database.OauthClient, []string, bool) {
+	clientUUID, err := uuid.Parse(request.ClientID)
+	if err != nil {
+		oauthErrHandler(w, http.StatusBadRequest, "invalid_request", "client_id is missing or malformed")
+		return database.OauthClient{}, nil, false
+	}
+	client, err := cfg.db.GetOAuthClient(ctx, clientUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		oauthErrHandler(w, http.StatusBadRequest, "invalid_client", "unknown client")
+		return database.OauthClient{}, nil, false
+	}
+	if err != nil {
+		oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error getting client")
+		return database.OauthClient{}, nil, false
+	}
+	if !slices.Contains(strings.Fields(client.RedirectUris), request.RedirectURI) {
+		oauthErrHandler(w, http.StatusBadRequest, "invalid_request", "redirect_uri isn't registered for this client")
+		return database.OauthClient{}, nil, false
+	}
+
+	fail := func(code, description string) (database.OauthClient, []string, bool) {
+		writeOAuthError(w, http.StatusBadRequest, oauthError{
+			Error:            code,
+			ErrorDescription: description,
+			RedirectTo: redirectWith(request.RedirectURI, url.Values{
+				"error":             {code},
+				"error_description": {description},
+				"state":             {request.State},
+			}),
+		})
+		return database.OauthClient{}, nil, false
+	}
+	if request.ResponseType != "code" {
+		return fail("unsupported_response_type", "only response_type=code is supported")
+	}
+	if request.CodeChallengeMethod != "S256" || !auth.ValidPKCEChallenge(request.CodeChallenge) {
+		return fail("invalid_request", "a PKCE code_challenge with code_challenge_method=S256 is required")
+	}
+	scopes := auth.SplitScopes(request.Scope)
+	if len(scopes) == 0 {
+		scopes = []string{auth.ScopeChirpsRead}
+	}
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return fail("invalid_scope", fmt.Sprintf("unknown scope %q", scope))
+		}
+	}
+	slices.Sort(scopes)
+	return client, slices.Compact(scopes), true
+}
+
+func (cfg *apiConfig) oauthAuthorizeInfoHandler(w http.ResponseWriter, r *http.Request) {
+	//checks an authorization request and says what the consent screen should ask the user
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return
+	}
+	_, err = cfg.validateToken(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return
+	}
+	query := r.URL.Query()
+	request := oauthAuthorizeRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+	client, scopes, ok := cfg.checkAuthorizeRequest(w, context.Background(), request)
+	if !ok {
+		return
+	}
+
+	resp, _ := json.Marshal(oauthConsent{
+		ClientID:    client.ID,
+		ClientName:  client.Name,
+		RedirectURI: request.RedirectURI,
+		Scopes:      scopes,
+		State:       request.State,
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) oauthAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	//records the user's answer to the consent screen and says where to send them next
+	//approving makes a single use authorization code bound to the client, redirect_uri and PKCE challenge
+	//only a token from logging in can approve, a personal access token or an app's token can't hand out a grant
+	validatedUserID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	request := oauthAuthorizeRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing authorization request: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	client, scopes, ok := cfg.checkAuthorizeRequest(w, ctx, request)
+	if !ok {
+		return
+	}
+
+	params := url.Values{}
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	if !request.Approve {
+		params.Set("error", "access_denied")
+		params.Set("error_description", "the user denied the request")
+	} else {
+		code, err := auth.MakeSecretToken()
+		if err != nil {
+			errHandler(w, fmt.Errorf("error creating authorization code: %v", err))
+			return
+		}
+		timeNow := time.Now()
+		err = cfg.db.CreateOAuthAuthorizationCode(ctx, database.CreateOAuthAuthorizationCodeParams{
+			CodeHash:      auth.HashToken(code),
+			ClientID:      client.ID,
+			UserID:        validatedUserID,
+			RedirectUri:   request.RedirectURI,
+			Scopes:        auth.JoinScopes(scopes),
+			CodeChallenge: request.CodeChallenge,
+			FamilyID:      uuid.New(),
+			CreatedAt:     timeNow,
+			ExpiresAt:     timeNow.Add(oauthCodeLifetime),
+		})
+		if err != nil {
+			errHandler(w, fmt.Errorf("error creating authorization code: %v", err))
+			return
+		}
+		params.Set("code", code)
+	}
+
+	resp, _ := json.Marshal(map[string]string{"redirect_to": redirectWith(request.RedirectURI, params)})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// authenticateClient finds the client a token, revocation or introspection request comes from.
+// confidential clients send their secret with HTTP Basic auth or as client_secret in the form,
+// public clients only send client_id. on failure the error response has already been written
+func (cfg *apiConfig) authenticateClient(w http.ResponseWriter, r *http.Request) (database.OauthClient, bool) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		//RFC 6749 form encodes both halves before they go into the header
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	fail := func(description string) (database.OauthClient, bool) {
+		if basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+		oauthErrHandler(w, http.StatusUnauthorized, "invalid_client", description)
+		return database.OauthClient{}, false
+	}
+	clientUUID, err := uuid.Parse(clientID)
+	if err != nil {
+		return fail("client_id is missing or malformed")
+	}
+	client, err := cfg.db.GetOAuthClient(context.Background(), clientUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fail("unknown client")
+	}
+	if err != nil {
+		oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error getting client")
+		return database.OauthClient{}, false
+	}
+	if !client.SecretHash.Valid {
+		if secret != "" {
+			return fail("public clients don't have a secret")
+		}
+		return client, true
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return fail("wrong client secret")
+	}
+	return client, true
+}
+
+// parseOAuthForm reads the form encoded body the token, revocation and introspection endpoints take
+func parseOAuthForm(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		oauthErrHandler(w, http.StatusBadRequest, "invalid_request", "the body must be application/x-www-form-urlencoded")
+		return false
+	}
+	if err := r.ParseForm(); err != nil {
+		oauthErrHandler(w, http.StatusBadRequest, "invalid_request", "unable to parse the body")
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) oauthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	//swaps an authorization code or a refresh token for an access token and a new refresh token
+	//both are bound to the client they were issued to
+	if !parseOAuthForm(w, r) {
+		return
+	}
+	client, ok := cfg.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	clientID := uuid.NullUUID{UUID: client.ID, Valid: true}
+	var userID, familyID uuid.UUID
+	var scopes []string
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		//the code is checked against the client, redirect_uri and code_verifier before it is used up,
+		//so someone who only saw the code can't burn it for the client it was meant for
+		codeHash := auth.HashToken(r.PostForm.Get("code"))
+		code, err := cfg.db.GetOAuthAuthorizationCode(ctx, codeHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			oauthErrHandler(w, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+			return
+		}
+		if err != nil {
+			oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error getting authorization code")
+			return
+		}
+		if code.ClientID != client.ID || code.RedirectUri != r.PostForm.Get("redirect_uri") {
+			oauthErrHandler(w, http.StatusBadRequest, "invalid_grant", "authorization code was issued to another client or redirect_uri")
+			return
+		}
+		if !auth.CheckPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+			oauthErrHandler(w, http.StatusBadRequest, "invalid_grant", "code_verifier doesn't match the code_challenge")
+			return
+		}
+		code, err = cfg.db.UseOAuthAuthorizationCode(ctx, database.UseOAuthAuthorizationCodeParams{
+			Now:      time.Now(),
+			CodeHash: codeHash,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			//a code that comes back after it was used was intercepted somewhere,
+			//so the tokens it was already swapped for can't be trusted either
+			stale, lookupErr := cfg.db.GetOAuthAuthorizationCode(ctx, codeHash)
+			if lookupErr == nil && stale.UsedAt.Valid {
+				err = cfg.db.RevokeRefreshTokenFamily(ctx, stale.FamilyID)
+				if err != nil {
+					oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error revoking tokens")
+					return
+				}
+				oauthErrHandler(w, http.StatusBadRequest, "invalid_grant", "authorization code was already used")
+				return
+			}
+			oauthErrHandler(w, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+			return
+		}
+		if err != nil {
+			oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error getting authorization code")
+			return
+		}
+		userID, familyID, scopes = code.UserID, code.FamilyID, auth.SplitScopes(code.Scopes)
+	case "refresh_token":
+		tokenHash := auth.HashToken(r.PostForm.Get("refresh_token"))
+		rotated, err := cfg.db.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{
+			Now:       time.Now(),
+			TokenHash: tokenHash,
+			ClientID:  clientID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			stale, lookupErr := cfg.db.GetRefreshTokenByHash(ctx, tokenHash)
+			if lookupErr == nil && stale.RotatedAt.Valid && stale.ClientID == clientID {
+				err = cfg.db.RevokeRefreshTokenFamily(ctx, stale.FamilyID)
+				if err != nil {
+					oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error revoking tokens")
+					return
+				}
+				oauthErrHandler(w, http.StatusBadRequest, "invalid_grant", "refresh token reuse detected")
+				return
+			}
+			oauthErrHandler(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+		if err != nil {
+			oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error getting refresh token")
+			return
+		}
+		userID, familyID, scopes = rotated.UserID, rotated.FamilyID, auth.SplitScopes(rotated.Scopes)
+	default:
+		oauthErrHandler(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		return
+	}
+
+	accessToken, err := cfg.jwtKeys.MakeClientJWT(userID, client.ID.String(), time.Hour, scopes...)
+	if err != nil {
+		oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error creating token")
+		return
+	}
+	refToken, err := cfg.storeRefreshToken(ctx, r, userID, familyID, clientID, scopes)
+	if err != nil {
+		oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error creating refresh token")
+		return
+	}
+	resp, _ := json.Marshal(oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(time.Hour.Seconds()),
+		RefreshToken: refToken,
+		Scope:        auth.JoinScopes(scopes),
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) oauthRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	//revokes a refresh token and everything else from the same grant (RFC 7009)
+	//access tokens can't be revoked and run out within the hour, and like unknown tokens
+	//they get the same 200 so a client can't probe for tokens that aren't its own
+	if !parseOAuthForm(w, r) {
+		return
+	}
+	client, ok := cfg.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	refToken, err := cfg.db.GetRefreshTokenByHash(ctx, auth.HashToken(r.PostForm.Get("token")))
+	if err == nil && refToken.ClientID.Valid && refToken.ClientID.UUID == client.ID {
+		err = cfg.db.RevokeRefreshTokenFamily(ctx, refToken.FamilyID)
+		if err != nil {
+			oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error revoking token")
+			return
+		}
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error getting token")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *apiConfig) oauthIntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	//says whether an access or refresh token is live and what it is for (RFC 7662)
+	//only confidential clients can ask, and only about tokens issued to them
+	if !parseOAuthForm(w, r) {
+		return
+	}
+	client, ok := cfg.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+	if !client.SecretHash.Valid {
+		oauthErrHandler(w, http.StatusUnauthorized, "invalid_client", "public clients can't introspect tokens")
+		return
+	}
+	token := r.PostForm.Get("token")
+	result := oauthIntrospection{}
+	if claims, err := cfg.jwtKeys.ParseAccessToken(token); err == nil {
+		if claims.ClientID == client.ID.String() {
+			result = oauthIntrospection{
+				Active:   true,
+				Scope:    claims.Scope,
+				ClientID: claims.ClientID,
+				Sub:      claims.Subject,
+				Exp:      claims.ExpiresAt.Unix(),
+				Iat:      claims.IssuedAt.Unix(),
+			}
+		}
+	} else {
+		refToken, err := cfg.db.GetRefreshTokenByHash(context.Background(), auth.HashToken(token))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			oauthErrHandler(w, http.StatusInternalServerError, "server_error", "error getting token")
+			return
+		}
+		live := err == nil && !refToken.RevokedAt.Valid && refToken.ExpiresAt.After(time.Now())
+		if live && refToken.ClientID.Valid && refToken.ClientID.UUID == client.ID {
+			result = oauthIntrospection{
+				Active:   true,
+				Scope:    refToken.Scopes,
+				ClientID: client.ID.String(),
+				Sub:      refToken.UserID.String(),
+				Exp:      refToken.ExpiresAt.Unix(),
+				Iat:      refToken.CreatedAt.Unix(),
+			}
+		}
+	}
+
+	resp, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
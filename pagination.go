@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// pageCursor is the keyset position a page of results continues from
+// it's handed to clients as an opaque base64 string
+type pageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// firstPageCursor returns a position that sorts before (asc) or after
+// (desc) every row, so the first page can use the same keyset query
+func firstPageCursor(desc bool) pageCursor {
+	if desc {
+		return pageCursor{CreatedAt: time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC), ID: uuid.Max}
+	}
+	return pageCursor{CreatedAt: time.Time{}, ID: uuid.Nil}
+}
+
+func (c pageCursor) encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor")
+	}
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return pageCursor{}, fmt.Errorf("invalid cursor")
+	}
+	parsedTime, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor")
+	}
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("invalid cursor")
+	}
+	return pageCursor{CreatedAt: parsedTime, ID: parsedID}, nil
+}
+
+// pageRequest holds the limit, sort and cursor query parameters
+// shared by the paginated listing endpoints
+type pageRequest struct {
+	Limit  int
+	Desc   bool
+	Cursor pageCursor
+}
+
+// parseLimit reads the limit query parameter, capped at maxPageLimit
+func parseLimit(query url.Values) (int, error) {
+	qlimit := query.Get("limit")
+	if qlimit == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(qlimit)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("limit must be a positive number")
+	}
+	return min(limit, maxPageLimit), nil
+}
+
+func parsePageRequest(query url.Values) (pageRequest, error) {
+	return parsePage(query, query.Get("sort") == "desc")
+}
+
+// parseNewestFirstPage is parsePageRequest for listings that only
+// go newest first and ignore sort
+func parseNewestFirstPage(query url.Values) (pageRequest, error) {
+	return parsePage(query, true)
+}
+
+func parsePage(query url.Values, desc bool) (pageRequest, error) {
+	limit, err := parseLimit(query)
+	if err != nil {
+		return pageRequest{}, err
+	}
+	page := pageRequest{Limit: limit, Desc: desc}
+	page.Cursor = firstPageCursor(page.Desc)
+	if qcursor := query.Get("cursor"); qcursor != "" {
+		cursor, err := decodeCursor(qcursor)
+		if err != nil {
+			return pageRequest{}, err
+		}
+		page.Cursor = cursor
+	}
+	return page, nil
+}
+
+// fetchLimit asks the store for one row more than the page holds
+// so we know whether there is a next page without a count query
+func fetchLimit(limit int) int32 {
+	return int32(limit + 1)
+}
+
+// setNextLink points a Link header at the page that continues from cursor
+func setNextLink(w http.ResponseWriter, r *http.Request, cursor string) {
+	next := *r.URL
+	query := next.Query()
+	query.Set("cursor", cursor)
+	next.RawQuery = query.Encode()
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/database"
+	"github.com/joncaudill/chirpy/internal/webauthn"
+)
+
+const (
+	// how long the browser has between starting and finishing a passkey ceremony
+	passkeyCeremonyTTL = 5 * time.Minute
+
+	passkeyRegister = "register"
+	passkeyLogin    = "login"
+)
+
+// the transports browsers report, anything else in a registration is dropped
+var passkeyTransports = []string{"ble", "hybrid", "internal", "nfc", "smart-card", "usb"}
+
+// passkey is a WebAuthn credential the user registered, without its key
+type passkey struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// the begin endpoints answer with what the browser passes to
+// navigator.credentials.create() or .get()
+type passkeyCreationOptions struct {
+	PublicKey webauthn.CreationOptions `json:"publicKey"`
+}
+
+type passkeyRequestOptions struct {
+	PublicKey webauthn.RequestOptions `json:"publicKey"`
+}
+
+type passkeyRegistration struct {
+	Name       string                          `json:"name"`
+	Credential webauthn.RegistrationCredential `json:"credential"`
+	// a passkey outlives password changes, so adding one needs the password too
+	CurrentPassword string `json:"current_password"`
+}
+
+type passkeyLoginRequest struct {
+	Credential webauthn.AssertionCredential `json:"credential"`
+}
+
+func passkeyFromDB(cred database.WebauthnCredential) passkey {
+	key := passkey{
+		ID:         cred.ID,
+		Name:       cred.Name,
+		Transports: strings.Fields(cred.Transports),
+		CreatedAt:  cred.CreatedAt,
+	}
+	if cred.LastUsedAt.Valid {
+		key.LastUsedAt = &cred.LastUsedAt.Time
+	}
+	return key
+}
+
+// startPasskeyCeremony makes and saves a challenge for a registration or login,
+// a login has no user yet since the passkey says who it is
+func (cfg *apiConfig) startPasskeyCeremony(ctx context.Context, userID uuid.NullUUID, kind string) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	timeNow := time.Now()
+	err = cfg.db.CreateWebAuthnChallenge(ctx, database.CreateWebAuthnChallengeParams{
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		UserID:    userID,
+		Kind:      kind,
+		CreatedAt: timeNow,
+		ExpiresAt: timeNow.Add(passkeyCeremonyTTL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error saving challenge: %v", err)
+	}
+	return challenge, nil
+}
+
+// finishPasskeyCeremony uses up the challenge a response was signed over and returns it
+// with the user it was started for, ok is false when it doesn't exist, expired or was already used
+func (cfg *apiConfig) finishPasskeyCeremony(ctx context.Context, clientDataJSON []byte, kind string) (challenge []byte, userID uuid.NullUUID, ok bool, err error) {
+	challenge, err = webauthn.ClientChallenge(clientDataJSON)
+	if err != nil {
+		return nil, uuid.NullUUID{}, false, nil
+	}
+	userID, err = cfg.db.UseWebAuthnChallenge(ctx, database.UseWebAuthnChallengeParams{
+		Now:       time.Now(),
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Kind:      kind,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, uuid.NullUUID{}, false, nil
+	}
+	if err != nil {
+		return nil, uuid.NullUUID{}, false, fmt.Errorf("error getting challenge: %v", err)
+	}
+	return challenge, userID, true, nil
+}
+
+func (cfg *apiConfig) passkeysRegisterBeginHandler(w http.ResponseWriter, r *http.Request) {
+	//starts adding a passkey, the browser passes the options to navigator.credentials.create()
+	//passkeys the user already has are excluded so the same authenticator isn't registered twice
+	userID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	user, err := cfg.db.GetUserById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("user not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	existing, err := cfg.db.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting passkeys: %v", err))
+		return
+	}
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(existing))
+	for _, cred := range existing {
+		credentialID, err := base64.RawURLEncoding.DecodeString(cred.CredentialID)
+		if err != nil {
+			continue
+		}
+		exclude = append(exclude, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         credentialID,
+			Transports: strings.Fields(cred.Transports),
+		})
+	}
+	challenge, err := cfg.startPasskeyCeremony(ctx, uuid.NullUUID{UUID: userID, Valid: true}, passkeyRegister)
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	displayName := user.DisplayName
+	if displayName == "" {
+		displayName = user.Handle
+	}
+	//the user handle is the user's id, the authenticator hands it back when logging in
+	options := cfg.webauthn.CreationOptions(challenge, webauthn.User{
+		ID:          userID[:],
+		Name:        user.Email,
+		DisplayName: displayName,
+	}, exclude, passkeyCeremonyTTL.Milliseconds())
+
+	resp, _ := json.Marshal(passkeyCreationOptions{PublicKey: options})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) passkeysCreateHandler(w http.ResponseWriter, r *http.Request) {
+	//finishes adding a passkey with what navigator.credentials.create() returned
+	//the current password is checked like a login, so a stolen access token alone can't add one
+	userID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	request := passkeyRegistration{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing passkey: %v", err), http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		request.Name = "Passkey"
+	}
+	if len(request.Name) > 100 {
+		errHandler(w, fmt.Errorf("name can be at most 100 characters"), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	user, err := cfg.db.GetUserById(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	if !cfg.checkPassword(w, r, user, request.CurrentPassword) {
+		return
+	}
+	challenge, ceremonyUser, ok, err := cfg.finishPasskeyCeremony(ctx, request.Credential.Response.ClientDataJSON, passkeyRegister)
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	if !ok || ceremonyUser.UUID != userID {
+		errHandler(w, fmt.Errorf("passkey registration expired or wasn't started"), http.StatusBadRequest)
+		return
+	}
+	verified, err := cfg.webauthn.VerifyRegistration(request.Credential, challenge)
+	if err != nil {
+		errHandler(w, err, http.StatusBadRequest)
+		return
+	}
+	credentialID := base64.RawURLEncoding.EncodeToString(verified.ID)
+	_, err = cfg.db.GetWebAuthnCredential(ctx, credentialID)
+	if err == nil {
+		errHandler(w, fmt.Errorf("passkey is already registered"), http.StatusConflict)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("error getting passkey: %v", err))
+		return
+	}
+	var transports []string
+	for _, transport := range request.Credential.Response.Transports {
+		if slices.Contains(passkeyTransports, transport) && !slices.Contains(transports, transport) {
+			transports = append(transports, transport)
+		}
+	}
+	cred, err := cfg.db.CreateWebAuthnCredential(ctx, database.CreateWebAuthnCredentialParams{
+		ID:           uuid.New(),
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    verified.PublicKey,
+		Name:         request.Name,
+		SignCount:    int64(verified.SignCount),
+		Transports:   strings.Join(transports, " "),
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error saving passkey: %v", err))
+		return
+	}
+
+	resp, _ := json.Marshal(passkeyFromDB(cred))
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) passkeysListHandler(w http.ResponseWriter, r *http.Request) {
+	//lists the caller's passkeys, newest first
+	userID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	creds, err := cfg.db.ListWebAuthnCredentials(context.Background(), userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting passkeys: %v", err))
+		return
+	}
+	passkeys := make([]passkey, 0, len(creds))
+	for _, cred := range creds {
+		passkeys = append(passkeys, passkeyFromDB(cred))
+	}
+
+	resp, _ := json.Marshal(passkeys)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) passkeysDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	//removes one of the caller's passkeys, it can't be used to log in after this
+	passkeyUUID, _ := uuid.Parse(r.PathValue("passkeyID"))
+	userID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	deleted, err := cfg.db.DeleteWebAuthnCredential(context.Background(), database.DeleteWebAuthnCredentialParams{
+		UserID: userID,
+		ID:     passkeyUUID,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error deleting passkey: %v", err))
+		return
+	}
+	if deleted == 0 {
+		errHandler(w, fmt.Errorf("passkey not found"), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) loginPasskeyBeginHandler(w http.ResponseWriter, r *http.Request) {
+	//starts logging in with a passkey, the browser passes the options to navigator.credentials.get()
+	//no email is needed, the browser offers whichever passkeys it has for the site
+	challenge, err := cfg.startPasskeyCeremony(context.Background(), uuid.NullUUID{}, passkeyLogin)
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	options := cfg.webauthn.RequestOptions(challenge, passkeyCeremonyTTL.Milliseconds())
+
+	resp, _ := json.Marshal(passkeyRequestOptions{PublicKey: options})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) loginPasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	//finishes logging in with what navigator.credentials.get() returned
+	//and hands out tokens the same as a password login
+	request := passkeyLoginRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing login info: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	challenge, _, ok, err := cfg.finishPasskeyCeremony(ctx, request.Credential.Response.ClientDataJSON, passkeyLogin)
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	if !ok {
+		errHandler(w, fmt.Errorf("passkey login expired or wasn't started"), http.StatusUnauthorized)
+		return
+	}
+	cred, err := cfg.db.GetWebAuthnCredential(ctx, base64.RawURLEncoding.EncodeToString(request.Credential.RawID))
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("passkey isn't registered"), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting passkey: %v", err))
+		return
+	}
+	userHandle := request.Credential.Response.UserHandle
+	if len(userHandle) > 0 && !bytes.Equal(userHandle, cred.UserID[:]) {
+		errHandler(w, fmt.Errorf("passkey belongs to a different user"), http.StatusUnauthorized)
+		return
+	}
+	signCount, err := cfg.webauthn.VerifyAssertion(request.Credential, challenge, cred.PublicKey, uint32(cred.SignCount))
+	if err != nil {
+		errHandler(w, err, http.StatusUnauthorized)
+		return
+	}
+	err = cfg.db.UseWebAuthnCredential(ctx, database.UseWebAuthnCredentialParams{
+		ID:         cred.ID,
+		SignCount:  int64(signCount),
+		LastUsedAt: sql.NullTime{Time: time.Now(), Valid: true},
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error updating passkey: %v", err))
+		return
+	}
+	user, err := cfg.db.GetUserById(ctx, cred.UserID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	returningUser := userFromDB(user)
+	returningUser.TokenJWT, returningUser.RefreshToken, err = cfg.issueTokens(ctx, r, user.ID)
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	resp, _ := json.Marshal(returningUser)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
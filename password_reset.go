@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+	"github.com/joncaudill/chirpy/internal/mailer"
+)
+
+// how long a password reset token stays usable
+const passwordResetTTL = time.Hour
+
+// how many resets can be asked for per email and per address in each
+// passwordResetWindow, which starts with the first request after the last one ended
+const (
+	passwordResetsPerEmail = 3
+	passwordResetsPerIP    = 20
+	passwordResetWindow    = time.Hour
+)
+
+type passwordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type passwordResetConfirm struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+func (cfg *apiConfig) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	//emails a reset token to the address if it belongs to a user
+	//the response is the same either way so this can't be used to find accounts, and the
+	//lookup and email happen after responding so the timing doesn't give it away either
+	resetReq := passwordResetRequest{}
+	err := json.NewDecoder(r.Body).Decode(&resetReq)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing reset request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if resetReq.Email == "" {
+		errHandler(w, fmt.Errorf("email is required"), http.StatusBadRequest)
+		return
+	}
+	wait, err := cfg.countPasswordReset(context.Background(), resetReq.Email, clientIP(r))
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		errHandler(w, fmt.Errorf("too many password reset requests, try again later"), http.StatusTooManyRequests)
+		return
+	}
+	cfg.background.Add(1)
+	go func() {
+		defer cfg.background.Done()
+		if err := cfg.sendPasswordReset(context.Background(), resetReq.Email); err != nil {
+			log.Printf("error sending password reset: %v", err)
+		}
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// countPasswordReset counts a reset request against the email and the address. if either
+// is already at its limit nothing is counted and it returns how long until that window ends.
+// emails without an account count the same
+func (cfg *apiConfig) countPasswordReset(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := time.Now()
+	limits := []struct {
+		key string
+		max int32
+	}{
+		{accountThrottleKey(email), passwordResetsPerEmail},
+		{ipThrottleKey(ip), passwordResetsPerIP},
+	}
+	//both are checked before either is counted, so a request turned away for one doesn't use up the other
+	for _, limit := range limits {
+		throttle, err := cfg.db.GetPasswordResetThrottle(ctx, limit.key)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error getting password reset throttle: %v", err)
+		}
+		if wait := throttle.WindowStartedAt.Add(passwordResetWindow).Sub(now); wait > 0 && throttle.Requests >= limit.max {
+			return wait, nil
+		}
+	}
+	for _, limit := range limits {
+		_, err := cfg.db.CountPasswordResetRequest(ctx, database.CountPasswordResetRequestParams{
+			Key:         limit.key,
+			Now:         now,
+			WindowStart: now.Add(-passwordResetWindow),
+			MaxRequests: limit.max,
+		})
+		//another request filled the window since the check above
+		if errors.Is(err, sql.ErrNoRows) {
+			return passwordResetWindow, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error counting password reset request: %v", err)
+		}
+	}
+	return 0, nil
+}
+
+// sendPasswordReset mails a reset token if email belongs to a user and does nothing if it doesn't
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := cfg.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+	token, err := auth.MakeSecretToken()
+	if err != nil {
+		return fmt.Errorf("error creating reset token: %w", err)
+	}
+	//only the hash is stored, the token itself only ever goes out in the email
+	timeNow := time.Now()
+	err = cfg.db.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		CreatedAt: timeNow,
+		ExpiresAt: timeNow.Add(passwordResetTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating reset token: %w", err)
+	}
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your chirpy account.\n\n"+
+			"Your reset token is %s\n\n"+
+			"It works once and expires in %s. If this wasn't you, you can ignore this email.", token, passwordResetTTL),
+	})
+	if err != nil {
+		return fmt.Errorf("error sending password reset to user %s: %w", user.ID, err)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) confirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	//sets a new password given a reset token from requestPasswordReset
+	//every refresh token the user has is revoked, so all their sessions have to log in again
+	confirm := passwordResetConfirm{}
+	err := json.NewDecoder(r.Body).Decode(&confirm)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing reset: %v", err), http.StatusBadRequest)
+		return
+	}
+	if confirm.Token == "" || confirm.NewPassword == "" {
+		errHandler(w, fmt.Errorf("token and new password are required"), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	userID, err := cfg.db.ConsumePasswordReset(ctx, database.ConsumePasswordResetParams{
+		Now:       time.Now(),
+		TokenHash: auth.HashToken(confirm.Token),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("invalid or expired reset token"), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error checking reset token: %v", err))
+		return
+	}
+	user, err := cfg.db.GetUserById(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	hashedPassword, err := auth.HashPassword(confirm.NewPassword)
+	if err != nil {
+		errHandler(w, fmt.Errorf("unable to hash password: %v", err))
+		return
+	}
+	_, err = cfg.db.UpdateUser(ctx, database.UpdateUserParams{
+		ID:             userID,
+		Email:          user.Email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error updating password: %v", err))
+		return
+	}
+	//any other reset tokens that went out are dead now too
+	err = cfg.db.DeleteUserPasswordResets(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error clearing reset tokens: %v", err))
+		return
+	}
+	err = cfg.db.RevokeUserRefreshTokens(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error revoking refresh tokens: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
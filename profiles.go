@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// limits on the free text parts of a profile
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+)
+
+// handles are letters, digits and underscores, compared without case
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// profile is the public face of a user, it never includes the email
+type profile struct {
+	Id          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// profileFields are the optional profile parts of a signup or update,
+// a field left out of the request is left alone
+type profileFields struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+}
+
+func (p profileFields) empty() bool {
+	return p.Handle == nil && p.DisplayName == nil && p.Bio == nil
+}
+
+func profileFromDB(user database.User) profile {
+	return profile{
+		Id:          user.ID,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		IsChirpyRed: user.IsChirpyRed,
+		CreatedAt:   user.CreatedAt,
+	}
+}
+
+// normalizeHandle strips an optional leading @ and checks what's left
+func normalizeHandle(handle string) (string, error) {
+	handle = strings.TrimPrefix(handle, "@")
+	if !handlePattern.MatchString(handle) {
+		return "", fmt.Errorf("handle must be 3 to 30 letters, digits or underscores")
+	}
+	return handle, nil
+}
+
+// defaultHandle is the placeholder handle given to a signup that didn't pick one
+func defaultHandle() string {
+	return "user" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12]
+}
+
+// applyProfile merges the fields that were sent over the current profile and
+// validates the result. on failure the error response has already been written
+func (cfg *apiConfig) applyProfile(w http.ResponseWriter, ctx context.Context, userID uuid.UUID, current profile, fields profileFields) (profile, bool) {
+	if fields.Handle != nil {
+		handle, err := normalizeHandle(*fields.Handle)
+		if err != nil {
+			errHandler(w, err, http.StatusBadRequest)
+			return profile{}, false
+		}
+		//checked up front so a taken handle is a 409 and not a constraint error
+		owner, err := cfg.db.GetUserByHandle(ctx, handle)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			errHandler(w, fmt.Errorf("error checking handle: %v", err))
+			return profile{}, false
+		}
+		if err == nil && owner.ID != userID {
+			errHandler(w, fmt.Errorf("handle is already taken"), http.StatusConflict)
+			return profile{}, false
+		}
+		current.Handle = handle
+	}
+	if fields.DisplayName != nil {
+		if len(*fields.DisplayName) > maxDisplayNameLength {
+			errHandler(w, fmt.Errorf("display name is too long"), http.StatusBadRequest)
+			return profile{}, false
+		}
+		current.DisplayName = *fields.DisplayName
+	}
+	if fields.Bio != nil {
+		if len(*fields.Bio) > maxBioLength {
+			errHandler(w, fmt.Errorf("bio is too long"), http.StatusBadRequest)
+			return profile{}, false
+		}
+		current.Bio = *fields.Bio
+	}
+	return current, true
+}
+
+func (cfg *apiConfig) usersGetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	//returns a user's public profile given their handle, with or without the @
+	handle := strings.TrimPrefix(r.PathValue("handle"), "@")
+	user, err := cfg.db.GetUserByHandle(context.Background(), handle)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("user not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	resp, err := json.Marshal(profileFromDB(user))
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing user: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+// embedAuthors adds each author's public profile to the chirps, and to any
+// originals they repost, when the request asks for it with expand=author
+func (cfg *apiConfig) embedAuthors(ctx context.Context, r *http.Request, views []chirp) error {
+	if !slices.Contains(strings.Split(r.URL.Query().Get("expand"), ","), "author") || len(views) == 0 {
+		return nil
+	}
+	targets := make([]*chirp, 0, len(views))
+	authorIDs := make([]uuid.UUID, 0, len(views))
+	for idx := range views {
+		targets = append(targets, &views[idx])
+		authorIDs = append(authorIDs, views[idx].UserId)
+		if original := views[idx].Original; original != nil {
+			targets = append(targets, original)
+			authorIDs = append(authorIDs, original.UserId)
+		}
+	}
+	users, err := cfg.db.GetUsersByIds(ctx, authorIDs)
+	if err != nil {
+		return fmt.Errorf("error getting authors: %w", err)
+	}
+	authors := map[uuid.UUID]*profile{}
+	for _, user := range users {
+		author := profileFromDB(user)
+		authors[user.ID] = &author
+	}
+	for _, target := range targets {
+		target.Author = authors[target.UserId]
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) chirpsRechirpHandler(w http.ResponseWriter, r *http.Request) {
+	//reposts someone's chirp as a new chirp with no body
+	//rechirping a rechirp reposts the original, and each user can only rechirp a chirp once
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, _ := uuid.Parse(chirpID)
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return
+	}
+	validatedUserID, scopes, err := cfg.authorize(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return
+	}
+	if !requireScope(w, scopes, auth.ScopeChirpsWrite) {
+		return
+	}
+	ctx := context.Background()
+	if !cfg.allowPosting(w, ctx, validatedUserID) {
+		return
+	}
+	original, err := cfg.originalChirp(ctx, chirpUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return
+	}
+	if !cfg.allowInteraction(w, ctx, validatedUserID, original) {
+		return
+	}
+	rechirpOf := uuid.NullUUID{UUID: original.ID, Valid: true}
+	_, err = cfg.db.GetRechirp(ctx, database.GetRechirpParams{
+		UserID:    validatedUserID,
+		RechirpOf: rechirpOf,
+	})
+	if err == nil {
+		errHandler(w, fmt.Errorf("chirp already rechirped"), http.StatusConflict)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("error getting rechirp: %v", err))
+		return
+	}
+
+	timeNow := time.Now()
+	rechirp, err := cfg.db.CreateChirp(ctx, database.CreateChirpParams{
+		ID:        uuid.New(),
+		CreatedAt: timeNow,
+		UpdatedAt: timeNow,
+		UserID:    validatedUserID,
+		RechirpOf: rechirpOf,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error creating rechirp: %v", err))
+		return
+	}
+	respChirps, err := cfg.chirpViews(ctx, uuid.NullUUID{UUID: validatedUserID, Valid: true}, []database.Chirp{rechirp})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error creating rechirp: %v", err))
+		return
+	}
+
+	resp, _ := json.Marshal(respChirps[0])
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) rechirpsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	//undoes a rechirp, same ownership rules as deleting a chirp
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, _ := uuid.Parse(chirpID)
+	rechirp, ok := cfg.authorizeChirpOwner(w, r, chirpUUID, "undo")
+	if !ok {
+		return
+	}
+	if !rechirp.RechirpOf.Valid {
+		errHandler(w, fmt.Errorf("rechirp not found"), http.StatusNotFound)
+		return
+	}
+	err := cfg.removeChirp(context.Background(), chirpUUID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error undoing rechirp: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+}
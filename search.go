@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// searchCursor is the keyset position within relevance ranked results
+type searchCursor struct {
+	Rank float64
+	ID   uuid.UUID
+}
+
+func (c searchCursor) encode() string {
+	raw := strconv.FormatFloat(c.Rank, 'g', -1, 64) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSearchCursor(cursor string) (searchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return searchCursor{}, fmt.Errorf("invalid cursor")
+	}
+	rank, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return searchCursor{}, fmt.Errorf("invalid cursor")
+	}
+	parsedRank, err := strconv.ParseFloat(rank, 64)
+	if err != nil {
+		return searchCursor{}, fmt.Errorf("invalid cursor")
+	}
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return searchCursor{}, fmt.Errorf("invalid cursor")
+	}
+	return searchCursor{Rank: parsedRank, ID: parsedID}, nil
+}
+
+// parseTimeParam reads an optional RFC3339 query parameter
+func parseTimeParam(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (cfg *apiConfig) chirpsSearchHandler(w http.ResponseWriter, r *http.Request) {
+	//q is required and supports "quoted phrases"
+	//author_id, since and until (RFC3339) narrow the results
+	//results come back most relevant first, limit and cursor page through them
+	query := r.URL.Query()
+	qtext := strings.TrimSpace(query.Get("q"))
+	if qtext == "" {
+		errHandler(w, fmt.Errorf("missing search query"), http.StatusBadRequest)
+		return
+	}
+	limit, err := parseLimit(query)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing page: %v", err), http.StatusBadRequest)
+		return
+	}
+	params := database.SearchChirpsParams{
+		Query:      qtext,
+		BeforeRank: math.MaxFloat64,
+		BeforeID:   uuid.Max,
+		Limit:      fetchLimit(limit),
+	}
+	if qauthor := query.Get("author_id"); qauthor != "" {
+		authorID, err := uuid.Parse(qauthor)
+		if err != nil {
+			errHandler(w, fmt.Errorf("error parsing author ID: %v", err), http.StatusBadRequest)
+			return
+		}
+		params.UserID = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+	params.Since, err = parseTimeParam(query.Get("since"), time.Time{})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing since: %v", err), http.StatusBadRequest)
+		return
+	}
+	params.Until, err = parseTimeParam(query.Get("until"), time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing until: %v", err), http.StatusBadRequest)
+		return
+	}
+	if qcursor := query.Get("cursor"); qcursor != "" {
+		cursor, err := decodeSearchCursor(qcursor)
+		if err != nil {
+			errHandler(w, fmt.Errorf("error parsing page: %v", err), http.StatusBadRequest)
+			return
+		}
+		params.BeforeRank = cursor.Rank
+		params.BeforeID = cursor.ID
+	}
+
+	ctx := context.Background()
+	results, err := cfg.db.SearchChirps(ctx, params)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error searching chirps: %v", err))
+		return
+	}
+	if len(results) > limit {
+		results = results[:limit]
+		last := results[len(results)-1]
+		setNextLink(w, r, searchCursor{Rank: last.Rank, ID: last.Chirp.ID}.encode())
+	}
+	chirps := make([]database.Chirp, 0, len(results))
+	for _, result := range results {
+		chirps = append(chirps, result.Chirp)
+	}
+	chirpsResp, err := cfg.listingViews(ctx, cfg.viewerID(r), chirps)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error searching chirps: %v", err))
+		return
+	}
+	if err := cfg.embedAuthors(ctx, r, chirpsResp); err != nil {
+		errHandler(w, fmt.Errorf("error searching chirps: %v", err))
+		return
+	}
+
+	jsonResp, err := json.Marshal(chirpsResp)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing chirps: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
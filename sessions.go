@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// a session is one login, it lives on through every refresh token rotated out of it.
+// ClientID is set when the session is an OAuth client the user let in
+type session struct {
+	ID         uuid.UUID  `json:"id"`
+	ClientID   *uuid.UUID `json:"client_id,omitempty"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+// clientIP is the address the request came from, without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (cfg *apiConfig) sessionsListHandler(w http.ResponseWriter, r *http.Request) {
+	//lists the caller's logged in devices, most recently used first
+	validatedUserID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	refTokens, err := cfg.db.ListUserSessions(context.Background(), validatedUserID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting sessions: %v", err))
+		return
+	}
+	sessions := make([]session, 0, len(refTokens))
+	for _, refToken := range refTokens {
+		userSession := session{
+			ID:         refToken.FamilyID,
+			UserAgent:  refToken.UserAgent,
+			IP:         refToken.Ip,
+			LastUsedAt: refToken.LastUsedAt,
+			ExpiresAt:  refToken.ExpiresAt,
+		}
+		if refToken.ClientID.Valid {
+			userSession.ClientID = &refToken.ClientID.UUID
+		}
+		sessions = append(sessions, userSession)
+	}
+
+	jsonResp, err := json.Marshal(sessions)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing sessions: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
+
+func (cfg *apiConfig) sessionsDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	//logs one of the caller's devices out by revoking its refresh token
+	//access tokens it already has keep working until they expire
+	sessionID := r.PathValue("sessionID")
+	sessionUUID, _ := uuid.Parse(sessionID)
+	validatedUserID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	revoked, err := cfg.db.RevokeUserSession(context.Background(), database.RevokeUserSessionParams{
+		UserID:   validatedUserID,
+		FamilyID: sessionUUID,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error revoking session: %v", err))
+		return
+	}
+	//someone else's session looks the same as one that doesn't exist
+	if revoked == 0 {
+		errHandler(w, fmt.Errorf("session not found"), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) sessionsDeleteAllHandler(w http.ResponseWriter, r *http.Request) {
+	//logs the caller out everywhere, including the device making the request
+	validatedUserID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	err := cfg.db.RevokeUserRefreshTokens(context.Background(), validatedUserID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error revoking sessions: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+}
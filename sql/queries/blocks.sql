@@ -0,0 +1,61 @@
+-- name: BlockUser :exec
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (blocker_id, blocked_id) DO NOTHING;
+
+-- name: UnblockUser :exec
+DELETE FROM blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: IsBlocked :one
+SELECT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE blocker_id = $1 AND blocked_id = $2
+);
+
+-- name: ListBlocks :many
+SELECT * FROM blocks
+WHERE blocker_id = sqlc.arg(blocker_id)
+  AND (created_at, blocked_id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_user_id)::uuid)
+ORDER BY created_at DESC, blocked_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetBlockedBetween :many
+-- which of user_ids have blocked the user or been blocked by them
+SELECT blocked_id AS user_id FROM blocks
+WHERE blocker_id = sqlc.arg(user_id)
+  AND blocked_id = ANY(sqlc.arg(user_ids)::uuid[])
+UNION
+SELECT blocker_id AS user_id FROM blocks
+WHERE blocked_id = sqlc.arg(user_id)
+  AND blocker_id = ANY(sqlc.arg(user_ids)::uuid[]);
+
+-- name: MuteUser :exec
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (muter_id, muted_id) DO NOTHING;
+
+-- name: UnmuteUser :exec
+DELETE FROM mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: ListMutes :many
+SELECT * FROM mutes
+WHERE muter_id = sqlc.arg(muter_id)
+  AND (created_at, muted_id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_user_id)::uuid)
+ORDER BY created_at DESC, muted_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetMutedAmong :many
+-- which of user_ids the user has muted
+SELECT muted_id FROM mutes
+WHERE muter_id = sqlc.arg(muter_id)
+  AND muted_id = ANY(sqlc.arg(user_ids)::uuid[]);
@@ -0,0 +1,19 @@
+-- name: EditChirp :one
+-- the cte sees the row as it was before the update, so the old body
+-- lands in chirp_revisions in the same statement that replaces it
+WITH revision AS (
+    INSERT INTO chirp_revisions (id, chirp_id, body, created_at, replaced_at)
+    SELECT sqlc.arg(revision_id), chirps.id, chirps.body, chirps.updated_at, sqlc.arg(updated_at)
+    FROM chirps
+    WHERE chirps.id = sqlc.arg(id)
+)
+UPDATE chirps
+SET body = sqlc.arg(body),
+    updated_at = sqlc.arg(updated_at)
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: GetChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY replaced_at ASC;
@@ -1,30 +1,139 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to, rechirp_of, quote_of)
 VALUES (
     $1,
     $2,
     $3,
     $4,
-    $5
+    $5,
+    $6,
+    $7,
+    $8
 )
 RETURNING *;
 
--- name: GetAllChirps :many
-SELECT * FROM chirps
-ORDER BY created_at ASC;
-
 -- name: GetChirpById :one
 SELECT * FROM chirps
 WHERE id = $1;
 
--- name: GetChirpsByUserId :many
+-- name: GetChirpsByIds :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: GetRechirp :one
 SELECT * FROM chirps
 WHERE user_id = $1
-ORDER BY created_at ASC;
+  AND rechirp_of = $2;
+
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND (created_at, id) > (sqlc.arg(after_created_at)::timestamp, sqlc.arg(after_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND (created_at, id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_id)::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsByUserAsc :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+  AND deleted_at IS NULL
+  AND (created_at, id) > (sqlc.arg(after_created_at)::timestamp, sqlc.arg(after_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsByUserDesc :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+  AND deleted_at IS NULL
+  AND (created_at, id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_id)::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
 
+-- name: TombstoneChirp :execrows
+-- a chirp with replies or quotes is blanked out instead of deleted so
+-- threads and quotes keep their shape, returns 0 when there are none
+UPDATE chirps
+SET body = '',
+    deleted_at = sqlc.arg(deleted_at),
+    updated_at = sqlc.arg(deleted_at)
+WHERE id = sqlc.arg(id)
+  AND EXISTS (
+    SELECT 1 FROM chirps AS children
+    WHERE children.in_reply_to = sqlc.arg(id) OR children.quote_of = sqlc.arg(id)
+  );
+
+-- name: CountReplies :many
+SELECT in_reply_to, count(*) AS reply_count
+FROM chirps
+WHERE in_reply_to = ANY(sqlc.arg(chirp_ids)::uuid[])
+  AND deleted_at IS NULL
+GROUP BY in_reply_to;
+
+-- name: CountRechirps :many
+SELECT rechirp_of, count(*) AS rechirp_count
+FROM chirps
+WHERE rechirp_of = ANY(sqlc.arg(chirp_ids)::uuid[])
+GROUP BY rechirp_of;
+
+-- name: CountQuotes :many
+SELECT quote_of, count(*) AS quote_count
+FROM chirps
+WHERE quote_of = ANY(sqlc.arg(chirp_ids)::uuid[])
+  AND deleted_at IS NULL
+GROUP BY quote_of;
+
+-- name: GetChirpAncestors :many
+-- the chain of parents above a chirp, root first
+WITH RECURSIVE ancestors AS (
+    SELECT chirps.in_reply_to AS id, 1 AS depth
+    FROM chirps
+    WHERE chirps.id = sqlc.arg(id)
+    UNION ALL
+    SELECT chirps.in_reply_to, ancestors.depth + 1
+    FROM chirps
+    JOIN ancestors ON chirps.id = ancestors.id
+)
+SELECT chirps.* FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC;
+
+-- name: GetChirpDescendants :many
+-- every reply under a chirp, a level at a time, oldest first within a level
+WITH RECURSIVE descendants AS (
+    SELECT chirps.id, 1 AS depth
+    FROM chirps
+    WHERE chirps.in_reply_to = sqlc.arg(id)
+    UNION ALL
+    SELECT chirps.id, descendants.depth + 1
+    FROM chirps
+    JOIN descendants ON chirps.in_reply_to = descendants.id
+)
+SELECT chirps.* FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+ORDER BY descendants.depth, chirps.created_at, chirps.id
+LIMIT sqlc.arg('limit');
+
 -- name: ResetChirps :exec
-DELETE FROM chirps;
\ No newline at end of file
+DELETE FROM chirps;
+
+-- name: SearchChirps :many
+SELECT sqlc.embed(chirps), ts_rank(chirps.body_tsv, query)::float8 AS rank
+FROM chirps, websearch_to_tsquery('english', sqlc.arg(query)) AS query
+WHERE chirps.body_tsv @@ query
+  AND chirps.deleted_at IS NULL
+  AND (sqlc.narg(user_id)::uuid IS NULL OR chirps.user_id = sqlc.narg(user_id)::uuid)
+  AND chirps.created_at >= sqlc.arg(since)::timestamp
+  AND chirps.created_at < sqlc.arg(until)::timestamp
+  AND (ts_rank(chirps.body_tsv, query)::float8, chirps.id) < (sqlc.arg(before_rank)::float8, sqlc.arg(before_id)::uuid)
+ORDER BY rank DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
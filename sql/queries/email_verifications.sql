@@ -0,0 +1,26 @@
+-- name: CreateEmailVerification :exec
+INSERT INTO email_verifications (token_hash, user_id, email, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+);
+
+-- name: ConsumeEmailVerification :one
+-- deleting the token as it's read keeps it single use
+DELETE FROM email_verifications
+WHERE token_hash = @token_hash
+  AND expires_at > @now::timestamp
+RETURNING user_id, email;
+
+-- name: GetLatestEmailVerification :one
+SELECT created_at FROM email_verifications
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: DeleteUserEmailVerifications :exec
+DELETE FROM email_verifications
+WHERE user_id = $1;
@@ -0,0 +1,45 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (follower_id, followee_id) DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: ListFollowers :many
+SELECT * FROM follows
+WHERE followee_id = sqlc.arg(followee_id)
+  AND (created_at, follower_id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_user_id)::uuid)
+ORDER BY created_at DESC, follower_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListFollowing :many
+SELECT * FROM follows
+WHERE follower_id = sqlc.arg(follower_id)
+  AND (created_at, followee_id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_user_id)::uuid)
+ORDER BY created_at DESC, followee_id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: ListTimeline :many
+-- the newest chirps from everyone a user follows. the lateral join reads
+-- at most a page of chirps per followee off chirps_user_id_created_at_id_idx
+-- instead of every chirp they have ever posted, so the cost stays bounded
+-- for users who follow thousands of accounts
+SELECT chirps.* FROM follows
+CROSS JOIN LATERAL (
+    SELECT followed.id FROM chirps AS followed
+    WHERE followed.user_id = follows.followee_id
+      AND followed.deleted_at IS NULL
+      AND (followed.created_at, followed.id) < (sqlc.arg(before_created_at)::timestamp, sqlc.arg(before_id)::uuid)
+    ORDER BY followed.created_at DESC, followed.id DESC
+    LIMIT sqlc.arg('limit')
+) AS recent
+JOIN chirps ON chirps.id = recent.id
+WHERE follows.follower_id = sqlc.arg(follower_id)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
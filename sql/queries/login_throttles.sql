@@ -0,0 +1,28 @@
+-- name: GetLoginThrottle :one
+SELECT * FROM login_throttles
+WHERE key = $1;
+
+-- name: RecordLoginFailure :one
+-- counts a failed login, starting over if the last one was before the window
+INSERT INTO login_throttles (key, failures, last_failed_at)
+VALUES (
+    sqlc.arg(key),
+    1,
+    sqlc.arg(now)::timestamp
+)
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+        WHEN login_throttles.last_failed_at < sqlc.arg(window_start)::timestamp THEN 1
+        ELSE login_throttles.failures + 1
+    END,
+    last_failed_at = EXCLUDED.last_failed_at
+RETURNING *;
+
+-- name: LockLoginThrottle :exec
+UPDATE login_throttles
+SET locked_until = $2
+WHERE key = $1;
+
+-- name: DeleteLoginThrottle :execrows
+DELETE FROM login_throttles
+WHERE key = $1;
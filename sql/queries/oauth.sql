@@ -0,0 +1,52 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, user_id, name, secret_hash, redirect_uris, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE id = $1;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE user_id = $1 AND id = $2;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, family_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9
+);
+
+-- name: UseOAuthAuthorizationCode :one
+-- marks a live code used and returns it in one statement, so a code can only be exchanged once
+UPDATE oauth_authorization_codes
+SET used_at = @now::timestamp
+WHERE code_hash = @code_hash
+  AND used_at IS NULL
+  AND expires_at > @now::timestamp
+RETURNING *;
+
+-- name: GetOAuthAuthorizationCode :one
+-- finds a code in any state, used to check a code before it is used up and to tell a replayed code from an unknown one
+SELECT * FROM oauth_authorization_codes
+WHERE code_hash = $1;
@@ -0,0 +1,29 @@
+-- name: GetPasswordResetThrottle :one
+SELECT * FROM password_reset_throttles
+WHERE key = $1;
+
+-- name: CountPasswordResetRequest :one
+-- counts a reset request, starting a new window if the key's has ended
+-- returns no row when the window is already full, so that request isn't counted
+INSERT INTO password_reset_throttles (key, requests, window_started_at)
+VALUES (
+    sqlc.arg(key),
+    1,
+    sqlc.arg(now)::timestamp
+)
+ON CONFLICT (key) DO UPDATE
+SET requests = CASE
+        WHEN password_reset_throttles.window_started_at <= sqlc.arg(window_start)::timestamp THEN 1
+        ELSE password_reset_throttles.requests + 1
+    END,
+    window_started_at = CASE
+        WHEN password_reset_throttles.window_started_at <= sqlc.arg(window_start)::timestamp THEN EXCLUDED.window_started_at
+        ELSE password_reset_throttles.window_started_at
+    END
+WHERE password_reset_throttles.window_started_at <= sqlc.arg(window_start)::timestamp
+   OR password_reset_throttles.requests < sqlc.arg(max_requests)::integer
+RETURNING *;
+
+-- name: DeletePasswordResetThrottle :execrows
+DELETE FROM password_reset_throttles
+WHERE key = $1;
@@ -0,0 +1,22 @@
+-- name: CreatePasswordReset :exec
+INSERT INTO password_resets (token_hash, user_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+);
+
+-- name: ConsumePasswordReset :one
+-- marks the token used and returns its user in one statement,
+-- so two requests racing with the same token can't both win
+UPDATE password_resets
+SET used_at = @now::timestamp
+WHERE token_hash = @token_hash
+  AND used_at IS NULL
+  AND expires_at > @now::timestamp
+RETURNING user_id;
+
+-- name: DeleteUserPasswordResets :exec
+DELETE FROM password_resets
+WHERE user_id = $1;
@@ -0,0 +1,31 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, user_id, name, token_hash, scopes, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+)
+RETURNING *;
+
+-- name: UsePersonalAccessToken :one
+-- looks up a live token and records that it was used in one statement
+UPDATE personal_access_tokens
+SET last_used_at = @now::timestamp
+WHERE token_hash = @token_hash
+  AND revoked_at IS NULL
+  AND (expires_at IS NULL OR expires_at > @now::timestamp)
+RETURNING *;
+
+-- name: ListPersonalAccessTokens :many
+SELECT * FROM personal_access_tokens
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1 AND id = $2 AND revoked_at IS NULL;
@@ -1,27 +1,71 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, last_used_at, client_id, scopes)
 VALUES (
     $1,
     $2,
     $3,
     $4,
     $5,
-    $6
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11,
+    $12
 )
 RETURNING *;
 
 -- name: GetRefreshToken :one
-SELECT token FROM refresh_tokens
-WHERE token = $1 AND expires_at > NOW() AND revoked_at IS NULL;
+SELECT token_hash FROM refresh_tokens
+WHERE token_hash = $1 AND expires_at > NOW() AND revoked_at IS NULL;
+
+-- name: GetRefreshTokenByHash :one
+-- finds a token in any state, used to tell a replayed token from an unknown one
+SELECT * FROM refresh_tokens
+WHERE token_hash = $1;
 
 -- name: GetUserFromRefreshToken :one
 SELECT user_id FROM refresh_tokens
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: ListUserSessions :many
+-- a session is a token family, and only its newest token is still live
+SELECT * FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY last_used_at DESC;
+
+-- name: RotateRefreshToken :one
+-- retires a live token and returns it in one statement,
+-- so the same token can't be rotated twice. a token only rotates for the
+-- OAuth client it was issued to, or with no client for a chirpy login
+UPDATE refresh_tokens
+SET rotated_at = @now::timestamp, revoked_at = @now::timestamp, updated_at = @now::timestamp, last_used_at = @now::timestamp
+WHERE token_hash = @token_hash
+  AND client_id IS NOT DISTINCT FROM sqlc.narg(client_id)::uuid
+  AND revoked_at IS NULL
+  AND expires_at > @now::timestamp
+RETURNING *;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
-WHERE token = $1;
+WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserSession :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL;
 
 -- name: ResetTokens :exec
-DELETE FROM refresh_tokens;
\ No newline at end of file
+DELETE FROM refresh_tokens;
@@ -0,0 +1,73 @@
+-- name: StartTOTPEnrollment :one
+-- stores a new secret unless 2FA is already on, so enrolling again
+-- can't swap the secret out from under a confirmed authenticator
+INSERT INTO user_totp (user_id, secret, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, created_at = EXCLUDED.created_at
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp
+WHERE user_id = $1;
+
+-- name: ConfirmUserTOTP :execrows
+UPDATE user_totp
+SET confirmed_at = $2, last_used_step = $3
+WHERE user_id = $1 AND confirmed_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+-- accepts a code's step only if it is newer than the last one used
+UPDATE user_totp
+SET last_used_step = $2
+WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp
+WHERE user_id = $1;
+
+-- name: CreateRecoveryCode :exec
+INSERT INTO totp_recovery_codes (code_hash, user_id, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+);
+
+-- name: UseRecoveryCode :execrows
+UPDATE totp_recovery_codes
+SET used_at = $3
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;
+
+-- name: DeleteUserRecoveryCodes :exec
+DELETE FROM totp_recovery_codes
+WHERE user_id = $1;
+
+-- name: CreateLoginChallenge :exec
+INSERT INTO login_challenges (token_hash, user_id, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4
+);
+
+-- name: GetLoginChallenge :one
+SELECT * FROM login_challenges
+WHERE token_hash = @token_hash AND used_at IS NULL AND expires_at > @now::timestamp;
+
+-- name: FailLoginChallenge :exec
+UPDATE login_challenges
+SET failed_attempts = failed_attempts + 1
+WHERE token_hash = $1;
+
+-- name: UseLoginChallenge :execrows
+-- a challenge is only swapped for tokens once, even if two requests race
+UPDATE login_challenges
+SET used_at = @now::timestamp
+WHERE token_hash = @token_hash AND used_at IS NULL;
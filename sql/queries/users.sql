@@ -1,28 +1,66 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle, display_name, bio)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4,
+    $5
 )
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, email_verified_at;
 
 -- name: UpdateUser :one
+-- a new email has to be verified again
 UPDATE users
 SET updated_at = NOW(),
+    email_verified_at = CASE WHEN email = $2 THEN email_verified_at END,
     email = $2,
     hashed_password = $3
 WHERE id = $1
-RETURNING id, created_at, updated_at, email, is_chirpy_red;
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, email_verified_at;
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET updated_at = NOW(),
+    handle = $2,
+    display_name = $3,
+    bio = $4
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, is_chirpy_red, handle, display_name, bio, email_verified_at;
 
 
 -- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, email_verified_at
 FROM users
 WHERE email = $1;
 
+-- name: GetUserById :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, email_verified_at
+FROM users
+WHERE id = $1;
+
+-- name: GetUserByHandle :one
+-- handles are unique regardless of case, so lookups ignore it too
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, email_verified_at
+FROM users
+WHERE lower(handle) = lower(sqlc.arg(handle));
+
+-- name: GetUsersByIds :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, display_name, bio, email_verified_at
+FROM users
+WHERE id = ANY($1::uuid[]);
+
+-- name: MarkEmailVerified :execrows
+-- only verifies the address the token was sent to, so a token
+-- mailed before an email change can't verify the new one
+UPDATE users
+SET email_verified_at = @verified_at::timestamp
+WHERE id = @id
+  AND email = @email;
+
 -- name: UpdateUserToRed :exec
 UPDATE users
 SET updated_at = NOW(),
@@ -30,4 +68,4 @@ SET updated_at = NOW(),
 WHERE id = $1;
 
 -- name: ResetUsers :exec
-DELETE FROM users;
\ No newline at end of file
+DELETE FROM users;
@@ -0,0 +1,49 @@
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (id, user_id, credential_id, public_key, name, sign_count, transports, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+RETURNING *;
+
+-- name: GetWebAuthnCredential :one
+SELECT * FROM webauthn_credentials
+WHERE credential_id = $1;
+
+-- name: ListWebAuthnCredentials :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = $1
+ORDER BY created_at DESC;
+
+-- name: UseWebAuthnCredential :exec
+UPDATE webauthn_credentials
+SET sign_count = $2, last_used_at = $3
+WHERE id = $1;
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials
+WHERE user_id = $1 AND id = $2;
+
+-- name: CreateWebAuthnChallenge :exec
+INSERT INTO webauthn_challenges (challenge, user_id, kind, created_at, expires_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+);
+
+-- name: UseWebAuthnChallenge :one
+-- a challenge is good for one ceremony of the kind it was made for
+UPDATE webauthn_challenges
+SET used_at = sqlc.arg(now)::timestamp
+WHERE challenge = sqlc.arg(challenge) AND kind = sqlc.arg(kind)
+    AND used_at IS NULL AND expires_at > sqlc.arg(now)::timestamp
+RETURNING user_id;
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+-- accounts from before verification existed stay usable
+UPDATE users SET email_verified_at = NOW();
+CREATE TABLE email_verifications (
+    token_hash TEXT PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX email_verifications_user_id_idx ON email_verifications (user_id, created_at);
+
+-- +goose Down
+DROP TABLE email_verifications;
+ALTER TABLE users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,39 @@
+-- +goose Up
+CREATE TABLE oauth_clients (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    -- NULL for public clients, which only have PKCE to prove who they are
+    secret_hash TEXT,
+    -- space separated, a redirect_uri has to match one of them exactly
+    redirect_uris TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX oauth_clients_user_id_idx ON oauth_clients (user_id, created_at);
+
+CREATE TABLE oauth_authorization_codes (
+    code_hash TEXT PRIMARY KEY,
+    client_id uuid NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    -- the refresh token family the code is exchanged for, revoked if the code is replayed
+    family_id uuid NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+ALTER TABLE refresh_tokens
+ADD COLUMN client_id uuid REFERENCES oauth_clients(id) ON DELETE CASCADE,
+ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
+-- every token so far came from logging in, which grants every scope
+UPDATE refresh_tokens SET scopes = 'chirps:read chirps:write profile:write';
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN scopes,
+DROP COLUMN client_id;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_clients;
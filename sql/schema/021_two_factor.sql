@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE user_totp (
+    user_id uuid PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    -- base32, it has to be readable to check codes so it can't be hashed
+    secret TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    -- NULL until the user proves their app has the secret, 2FA is only on after that
+    confirmed_at TIMESTAMP,
+    -- the last 30 second step a code was accepted for, so a code can't be used twice
+    last_used_step BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE totp_recovery_codes (
+    code_hash TEXT PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+CREATE INDEX totp_recovery_codes_user_id_idx ON totp_recovery_codes (user_id);
+
+-- the first step of a login for a user with 2FA, swapped for tokens with a code
+CREATE TABLE login_challenges (
+    token_hash TEXT PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    used_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE login_challenges;
+DROP TABLE totp_recovery_codes;
+DROP TABLE user_totp;
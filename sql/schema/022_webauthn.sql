@@ -0,0 +1,33 @@
+-- +goose Up
+-- passkeys, a user can have several (a phone, a laptop, a security key)
+CREATE TABLE webauthn_credentials (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- the id the authenticator gave the credential, base64url
+    credential_id TEXT NOT NULL UNIQUE,
+    -- a COSE_Key, it is public so it is stored as is
+    public_key BYTEA NOT NULL,
+    name TEXT NOT NULL,
+    -- the authenticator's signature counter, one going backwards means a cloned key
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    -- space separated hints for the browser like usb or internal
+    transports TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP
+);
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+-- the challenge for a registration or login that has been started,
+-- user_id is NULL for a login since the passkey says who the user is
+CREATE TABLE webauthn_challenges (
+    challenge TEXT PRIMARY KEY,
+    user_id uuid REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE webauthn_challenges;
+DROP TABLE webauthn_credentials;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- failed logins counted per account ("account:<email>") and per address ("ip:<address>")
+CREATE TABLE login_throttles (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failed_at TIMESTAMP NOT NULL,
+    -- logins for the key are turned away until then, NULL while under the limit
+    locked_until TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE login_throttles;
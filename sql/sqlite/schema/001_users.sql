@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE users (
+  id TEXT PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  email TEXT NOT NULL UNIQUE
+);
+
+-- +goose Down
+DROP TABLE users;
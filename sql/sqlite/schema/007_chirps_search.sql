@@ -0,0 +1,34 @@
+-- +goose Up
+-- sqlite has no tsvector, so the search index is an fts5 table kept in
+-- step with chirps by triggers
+CREATE VIRTUAL TABLE chirps_fts USING fts5(
+  chirp_id UNINDEXED,
+  body,
+  tokenize = 'porter unicode61'
+);
+INSERT INTO chirps_fts (chirp_id, body) SELECT id, body FROM chirps;
+
+-- +goose StatementBegin
+CREATE TRIGGER chirps_fts_insert AFTER INSERT ON chirps BEGIN
+  INSERT INTO chirps_fts (chirp_id, body) VALUES (new.id, new.body);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER chirps_fts_update AFTER UPDATE OF body ON chirps BEGIN
+  DELETE FROM chirps_fts WHERE chirp_id = old.id;
+  INSERT INTO chirps_fts (chirp_id, body) VALUES (new.id, new.body);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER chirps_fts_delete AFTER DELETE ON chirps BEGIN
+  DELETE FROM chirps_fts WHERE chirp_id = old.id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER chirps_fts_delete;
+DROP TRIGGER chirps_fts_update;
+DROP TRIGGER chirps_fts_insert;
+DROP TABLE chirps_fts;
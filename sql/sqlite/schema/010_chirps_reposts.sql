@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN rechirp_of TEXT REFERENCES chirps(id) ON DELETE CASCADE;
+ALTER TABLE chirps
+ADD COLUMN quote_of TEXT REFERENCES chirps(id) ON DELETE SET NULL;
+CREATE UNIQUE INDEX chirps_rechirp_of_user_idx ON chirps (rechirp_of, user_id);
+CREATE INDEX chirps_quote_of_idx ON chirps (quote_of);
+
+-- +goose Down
+DROP INDEX chirps_quote_of_idx;
+DROP INDEX chirps_rechirp_of_user_idx;
+ALTER TABLE chirps
+DROP COLUMN quote_of;
+ALTER TABLE chirps
+DROP COLUMN rechirp_of;
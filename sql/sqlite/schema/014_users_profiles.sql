@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN handle TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+-- existing users get the same kind of placeholder handle a signup without one does
+UPDATE users SET handle = 'user' || substr(replace(id, '-', ''), 1, 12);
+CREATE UNIQUE INDEX users_handle_key ON users (lower(handle));
+
+-- +goose Down
+DROP INDEX users_handle_key;
+ALTER TABLE users DROP COLUMN bio;
+ALTER TABLE users DROP COLUMN display_name;
+ALTER TABLE users DROP COLUMN handle;
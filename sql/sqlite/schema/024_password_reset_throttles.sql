@@ -0,0 +1,11 @@
+-- +goose Up
+-- password reset requests counted per email ("account:<email>") and per address ("ip:<address>")
+-- in fixed windows, requests turned away aren't counted so they can't push the window out
+CREATE TABLE password_reset_throttles (
+    key TEXT PRIMARY KEY,
+    requests INTEGER NOT NULL,
+    window_started_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE password_reset_throttles;
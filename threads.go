@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// caps how many replies a single thread response will walk
+const maxThreadReplies = 1000
+
+type threadNode struct {
+	chirp
+	Replies []*threadNode `json:"replies"`
+}
+
+type threadResponse struct {
+	Ancestors []chirp     `json:"ancestors"`
+	Chirp     *threadNode `json:"chirp"`
+}
+
+func (cfg *apiConfig) chirpsThreadHandler(w http.ResponseWriter, r *http.Request) {
+	//returns the chain of parents above a chirp, root first,
+	//and the tree of replies below it, oldest first at each level
+	chirpID := r.PathValue("chirpID")
+	chirpUUID, err := uuid.Parse(chirpID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("invalid chirp id: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	chirpData, err := cfg.db.GetChirpById(ctx, chirpUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting chirp: %v", err))
+		return
+	}
+	ancestors, err := cfg.db.GetChirpAncestors(ctx, chirpUUID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting thread: %v", err))
+		return
+	}
+	descendants, err := cfg.db.GetChirpDescendants(ctx, database.GetChirpDescendantsParams{
+		ID:    chirpUUID,
+		Limit: maxThreadReplies,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting thread: %v", err))
+		return
+	}
+
+	//blocked users drop out of the thread, along with the replies under them
+	viewer := cfg.viewerID(r)
+	tree, err := cfg.filterVisible(ctx, viewer, append([]database.Chirp{chirpData}, descendants...), false)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting thread: %v", err))
+		return
+	}
+	if len(tree) == 0 || tree[0].ID != chirpUUID {
+		errHandler(w, fmt.Errorf("chirp not found"), http.StatusNotFound)
+		return
+	}
+	ancestors, err = cfg.filterVisible(ctx, viewer, ancestors, false)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting thread: %v", err))
+		return
+	}
+	ancestorViews, err := cfg.chirpViews(ctx, viewer, ancestors)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting thread: %v", err))
+		return
+	}
+	if err := cfg.embedAuthors(ctx, r, ancestorViews); err != nil {
+		errHandler(w, fmt.Errorf("error getting thread: %v", err))
+		return
+	}
+	//descendants come back a level at a time, so a parent is always seen before its replies
+	treeViews, err := cfg.chirpViews(ctx, viewer, tree)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting thread: %v", err))
+		return
+	}
+	if err := cfg.embedAuthors(ctx, r, treeViews); err != nil {
+		errHandler(w, fmt.Errorf("error getting thread: %v", err))
+		return
+	}
+	nodes := map[uuid.UUID]*threadNode{}
+	for _, view := range treeViews {
+		node := &threadNode{chirp: view, Replies: []*threadNode{}}
+		nodes[view.Id] = node
+		if view.InReplyTo == nil || view.Id == chirpUUID {
+			continue
+		}
+		if parent, ok := nodes[*view.InReplyTo]; ok {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+
+	jsonResp, err := json.Marshal(threadResponse{
+		Ancestors: ancestorViews,
+		Chirp:     nodes[chirpUUID],
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error marshalling thread: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
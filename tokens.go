@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// personalToken is a long lived token a user makes for a script or bot,
+// Token is only ever filled in on the response that creates it
+type personalToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+type personalTokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+func personalTokenFromDB(pat database.PersonalAccessToken) personalToken {
+	token := personalToken{
+		ID:        pat.ID,
+		Name:      pat.Name,
+		Scopes:    auth.SplitScopes(pat.Scopes),
+		CreatedAt: pat.CreatedAt,
+	}
+	if pat.ExpiresAt.Valid {
+		token.ExpiresAt = &pat.ExpiresAt.Time
+	}
+	if pat.LastUsedAt.Valid {
+		token.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	return token
+}
+
+// authorize checks a bearer token, either an access JWT or a personal access token,
+// and returns the user it speaks for and the scopes it carries
+func (cfg *apiConfig) authorize(token string) (uuid.UUID, []string, error) {
+	if !strings.HasPrefix(token, auth.PersonalTokenPrefix) {
+		return cfg.jwtKeys.ValidateAccessToken(token)
+	}
+	pat, err := cfg.db.UsePersonalAccessToken(context.Background(), database.UsePersonalAccessTokenParams{
+		Now:       time.Now(),
+		TokenHash: auth.HashToken(token),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, nil, auth.ErrTokenUnknown
+	}
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("error checking token: %v", err)
+	}
+	return pat.UserID, auth.SplitScopes(pat.Scopes), nil
+}
+
+// validateToken is authorize for handlers that work with any scope
+func (cfg *apiConfig) validateToken(token string) (uuid.UUID, error) {
+	userID, _, err := cfg.authorize(token)
+	return userID, err
+}
+
+// requireScope writes a 403 and returns false when a token is missing scope
+func requireScope(w http.ResponseWriter, scopes []string, scope string) bool {
+	if auth.HasScope(scopes, scope) {
+		return true
+	}
+	resp, _ := json.Marshal(chirpError{Error: fmt.Sprintf("token needs the %s scope", scope), Code: "insufficient_scope"})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+	w.WriteHeader(http.StatusForbidden)
+	w.Write(resp)
+	return false
+}
+
+// loginTokenUser checks a bearer token for handlers that change how the user signs in or
+// manage the user's sessions, tokens and apps. only a token from logging in will do,
+// not a personal access token or one an app was given
+func (cfg *apiConfig) loginTokenUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return uuid.Nil, false
+	}
+	userID, err := cfg.validateToken(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return uuid.Nil, false
+	}
+	if !cfg.isLoginToken(token) {
+		loginTokenRequired(w)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// isLoginToken reports whether a token came from logging in,
+// rather than being a personal access token or one an app was given
+func (cfg *apiConfig) isLoginToken(token string) bool {
+	return !strings.HasPrefix(token, auth.PersonalTokenPrefix) && !cfg.isClientToken(token)
+}
+
+func loginTokenRequired(w http.ResponseWriter) {
+	errHandler(w, fmt.Errorf("this needs a token from logging in, not a personal access token or an app's token"), http.StatusForbidden)
+}
+
+func (cfg *apiConfig) tokensCreateHandler(w http.ResponseWriter, r *http.Request) {
+	//makes a personal access token for the caller
+	//only a token from logging in can do this, a personal access token or one an app was
+	//given could otherwise mint a token that outlives its own revocation
+	validatedUserID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	request := personalTokenRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing token request: %v", err), http.StatusBadRequest)
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 100 {
+		errHandler(w, fmt.Errorf("name is required and can be at most 100 characters"), http.StatusBadRequest)
+		return
+	}
+	if len(request.Scopes) == 0 {
+		errHandler(w, fmt.Errorf("at least one scope is required"), http.StatusBadRequest)
+		return
+	}
+	for _, scope := range request.Scopes {
+		if !auth.ValidScope(scope) {
+			errHandler(w, fmt.Errorf("unknown scope %q", scope), http.StatusBadRequest)
+			return
+		}
+	}
+	if request.ExpiresInDays < 0 {
+		errHandler(w, fmt.Errorf("expires_in_days can't be negative"), http.StatusBadRequest)
+		return
+	}
+	slices.Sort(request.Scopes)
+	request.Scopes = slices.Compact(request.Scopes)
+
+	secret, err := auth.MakeSecretToken()
+	if err != nil {
+		errHandler(w, fmt.Errorf("error creating token: %v", err))
+		return
+	}
+	secret = auth.PersonalTokenPrefix + secret
+	timeNow := time.Now()
+	expiresAt := sql.NullTime{}
+	if request.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: timeNow.AddDate(0, 0, request.ExpiresInDays), Valid: true}
+	}
+	pat, err := cfg.db.CreatePersonalAccessToken(context.Background(), database.CreatePersonalAccessTokenParams{
+		ID:        uuid.New(),
+		UserID:    validatedUserID,
+		Name:      request.Name,
+		TokenHash: auth.HashToken(secret),
+		Scopes:    auth.JoinScopes(request.Scopes),
+		CreatedAt: timeNow,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error creating token: %v", err))
+		return
+	}
+	created := personalTokenFromDB(pat)
+	created.Token = secret
+
+	resp, _ := json.Marshal(created)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) tokensListHandler(w http.ResponseWriter, r *http.Request) {
+	//lists the caller's personal access tokens, newest first, without the secrets
+	validatedUserID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	pats, err := cfg.db.ListPersonalAccessTokens(context.Background(), validatedUserID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting tokens: %v", err))
+		return
+	}
+	tokens := make([]personalToken, 0, len(pats))
+	for _, pat := range pats {
+		tokens = append(tokens, personalTokenFromDB(pat))
+	}
+
+	jsonResp, err := json.Marshal(tokens)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing tokens: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonResp)
+}
+
+func (cfg *apiConfig) tokensDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	//revokes one of the caller's personal access tokens
+	tokenID := r.PathValue("tokenID")
+	tokenUUID, _ := uuid.Parse(tokenID)
+	validatedUserID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	revoked, err := cfg.db.RevokePersonalAccessToken(context.Background(), database.RevokePersonalAccessTokenParams{
+		UserID: validatedUserID,
+		ID:     tokenUUID,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error revoking token: %v", err))
+		return
+	}
+	if revoked == 0 {
+		errHandler(w, fmt.Errorf("token not found"), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+}
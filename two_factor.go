@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+const (
+	totpIssuer = "Chirpy"
+	// how many recovery codes a user gets when they turn 2FA on
+	recoveryCodeCount = 10
+	// how long the second step of a login has, and how many wrong codes it takes
+	// before the password has to be entered again
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+)
+
+type totpEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type totpRecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// secondFactor is a TOTP code or one of the user's recovery codes
+type secondFactor struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type totpDisableRequest struct {
+	Password string `json:"password"`
+	secondFactor
+}
+
+// loginChallenge is what logging in returns in place of tokens when the user has 2FA on
+type loginChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+type loginChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	secondFactor
+}
+
+// checkSecondFactor reports whether a TOTP code or recovery code is good for the user,
+// using it up so the same code can't be played back
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, userID uuid.UUID, factor secondFactor) (bool, error) {
+	timeNow := time.Now()
+	if factor.RecoveryCode != "" {
+		used, err := cfg.db.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(factor.RecoveryCode)),
+			UsedAt:   sql.NullTime{Time: timeNow, Valid: true},
+		})
+		if err != nil {
+			return false, fmt.Errorf("error checking recovery code: %v", err)
+		}
+		return used == 1, nil
+	}
+	totp, err := cfg.db.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error getting two factor auth: %v", err)
+	}
+	step, ok := auth.CheckTOTP(totp.Secret, factor.Code, timeNow)
+	if !ok {
+		return false, nil
+	}
+	used, err := cfg.db.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+	if err != nil {
+		return false, fmt.Errorf("error checking code: %v", err)
+	}
+	return used == 1, nil
+}
+
+// startLoginChallenge writes a challenge in place of tokens when the user has 2FA on,
+// and reports whether it did
+func (cfg *apiConfig) startLoginChallenge(ctx context.Context, w http.ResponseWriter, userID uuid.UUID) (bool, error) {
+	totp, err := cfg.db.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !totp.ConfirmedAt.Valid {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error getting two factor auth: %v", err)
+	}
+	challengeToken, err := auth.MakeSecretToken()
+	if err != nil {
+		return false, fmt.Errorf("error creating challenge: %v", err)
+	}
+	timeNow := time.Now()
+	challenge := loginChallenge{
+		TwoFactorRequired: true,
+		ChallengeToken:    challengeToken,
+		ExpiresAt:         timeNow.Add(loginChallengeTTL),
+	}
+	err = cfg.db.CreateLoginChallenge(ctx, database.CreateLoginChallengeParams{
+		TokenHash: auth.HashToken(challengeToken),
+		UserID:    userID,
+		CreatedAt: timeNow,
+		ExpiresAt: challenge.ExpiresAt,
+	})
+	if err != nil {
+		return false, fmt.Errorf("error creating challenge: %v", err)
+	}
+	resp, _ := json.Marshal(challenge)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+	return true, nil
+}
+
+func (cfg *apiConfig) totpEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	//starts turning on 2FA with a fresh secret for the user's authenticator app
+	//it isn't used for logging in until a code from the app is confirmed,
+	//enrolling again before then just replaces the secret
+	userID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	ctx := context.Background()
+	user, err := cfg.db.GetUserById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("user not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	secret, err := auth.MakeTOTPSecret()
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	_, err = cfg.db.StartTOTPEnrollment(ctx, database.StartTOTPEnrollmentParams{
+		UserID:    userID,
+		Secret:    secret,
+		CreatedAt: time.Now(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("two factor auth is already on"), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error starting two factor auth: %v", err))
+		return
+	}
+
+	resp, _ := json.Marshal(totpEnrollment{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(secret, totpIssuer, user.Email),
+	})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) totpConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	//turns 2FA on once the user shows a code from their app,
+	//and hands back recovery codes, which are only stored hashed so this is the one time they are shown
+	userID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	request := secondFactor{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing code: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	totp, err := cfg.db.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("two factor auth hasn't been started"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting two factor auth: %v", err))
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		errHandler(w, fmt.Errorf("two factor auth is already on"), http.StatusConflict)
+		return
+	}
+	timeNow := time.Now()
+	step, ok := auth.CheckTOTP(totp.Secret, request.Code, timeNow)
+	if !ok {
+		errHandler(w, fmt.Errorf("incorrect code"), http.StatusBadRequest)
+		return
+	}
+	confirmed, err := cfg.db.ConfirmUserTOTP(ctx, database.ConfirmUserTOTPParams{
+		UserID:       userID,
+		ConfirmedAt:  sql.NullTime{Time: timeNow, Valid: true},
+		LastUsedStep: step,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error confirming two factor auth: %v", err))
+		return
+	}
+	if confirmed == 0 {
+		errHandler(w, fmt.Errorf("two factor auth is already on"), http.StatusConflict)
+		return
+	}
+	err = cfg.db.DeleteUserRecoveryCodes(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error creating recovery codes: %v", err))
+		return
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := auth.MakeRecoveryCode()
+		if err != nil {
+			errHandler(w, err)
+			return
+		}
+		err = cfg.db.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			CodeHash:  auth.HashToken(code),
+			UserID:    userID,
+			CreatedAt: timeNow,
+		})
+		if err != nil {
+			errHandler(w, fmt.Errorf("error creating recovery codes: %v", err))
+			return
+		}
+		codes = append(codes, code)
+	}
+
+	resp, _ := json.Marshal(totpRecoveryCodes{RecoveryCodes: codes})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) totpDisableHandler(w http.ResponseWriter, r *http.Request) {
+	//turns 2FA off, a stolen access token alone isn't enough
+	//so the caller has to give their password and a current code or recovery code
+	userID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	request := totpDisableRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing request: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	user, err := cfg.db.GetUserById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("user not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	if !cfg.checkPassword(w, r, user, request.Password) {
+		return
+	}
+	totp, err := cfg.db.GetUserTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("two factor auth isn't on"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting two factor auth: %v", err))
+		return
+	}
+	//an enrollment that was never confirmed can be dropped with just the password
+	if totp.ConfirmedAt.Valid {
+		ok, err := cfg.checkSecondFactor(ctx, userID, request.secondFactor)
+		if err != nil {
+			errHandler(w, err)
+			return
+		}
+		if !ok {
+			errHandler(w, fmt.Errorf("incorrect code"), http.StatusUnauthorized)
+			return
+		}
+	}
+	err = cfg.db.DeleteUserTOTP(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error turning off two factor auth: %v", err))
+		return
+	}
+	err = cfg.db.DeleteUserRecoveryCodes(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error deleting recovery codes: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) loginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	//second step of logging in with 2FA on, swaps a challenge and a code for tokens
+	//after too many wrong codes the challenge stops working and the user has to log in again
+	request := loginChallengeRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing login info: %v", err), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	challengeHash := auth.HashToken(request.ChallengeToken)
+	challenge, err := cfg.db.GetLoginChallenge(ctx, database.GetLoginChallengeParams{
+		TokenHash: challengeHash,
+		Now:       time.Now(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("challenge is invalid or expired, log in again"), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting challenge: %v", err))
+		return
+	}
+	if challenge.FailedAttempts >= loginChallengeMaxAttempts {
+		errHandler(w, fmt.Errorf("too many incorrect codes, log in again"), http.StatusUnauthorized)
+		return
+	}
+	user, err := cfg.db.GetUserById(ctx, challenge.UserID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	//wrong codes count towards the account's lockout too, otherwise logging in
+	//again for a fresh challenge would give unlimited guesses at the code
+	ip := clientIP(r)
+	locked, err := cfg.loginLocked(ctx, user.Email, ip)
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	ok := false
+	if !locked {
+		ok, err = cfg.checkSecondFactor(ctx, challenge.UserID, request.secondFactor)
+		if err != nil {
+			errHandler(w, err)
+			return
+		}
+	}
+	if !ok {
+		err = cfg.db.FailLoginChallenge(ctx, challengeHash)
+		if err != nil {
+			errHandler(w, fmt.Errorf("error updating challenge: %v", err))
+			return
+		}
+		if !locked {
+			if err := cfg.recordLoginFailure(ctx, user.Email, ip); err != nil {
+				errHandler(w, err)
+				return
+			}
+		}
+		errHandler(w, fmt.Errorf("incorrect code"), http.StatusUnauthorized)
+		return
+	}
+	used, err := cfg.db.UseLoginChallenge(ctx, database.UseLoginChallengeParams{
+		Now:       time.Now(),
+		TokenHash: challengeHash,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error updating challenge: %v", err))
+		return
+	}
+	if used == 0 {
+		errHandler(w, fmt.Errorf("challenge is invalid or expired, log in again"), http.StatusUnauthorized)
+		return
+	}
+	err = cfg.clearLoginFailures(ctx, user.Email)
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	returningUser := userFromDB(user)
+	returningUser.TokenJWT, returningUser.RefreshToken, err = cfg.issueTokens(ctx, r, user.ID)
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	resp, _ := json.Marshal(returningUser)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+
+	"github.com/google/uuid"
+	"github.com/joncaudill/chirpy/internal/auth"
+	"github.com/joncaudill/chirpy/internal/database"
+)
+
+// userChanges is a partial update to your own user, anything left nil is kept
+type userChanges struct {
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+	// needed to change the email or set a new password
+	CurrentPassword string `json:"current_password"`
+	profileFields
+}
+
+type passwordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// validateEmail accepts a bare address like name@example.com and
+// nothing else, so no display names or angle brackets
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("invalid email address")
+	}
+	return nil
+}
+
+func userFromDB(user database.User) User {
+	return User{
+		ID:            user.ID,
+		Email:         user.Email,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		IsChirpyRed:   user.IsChirpyRed,
+		Handle:        user.Handle,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}
+}
+
+func (cfg *apiConfig) patchUser(w http.ResponseWriter, r *http.Request) {
+	//updates only the fields that are sent, passwords go through /api/users/password
+	//changing the email needs a token from logging in and current_password, profile:write alone only covers the profile
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting token: %v", err), http.StatusUnauthorized)
+		return
+	}
+	userID, scopes, err := cfg.authorize(token)
+	if err != nil {
+		tokenErrHandler(w, err)
+		return
+	}
+	if !requireScope(w, scopes, auth.ScopeProfileWrite) {
+		return
+	}
+	changes := userChanges{}
+	err = json.NewDecoder(r.Body).Decode(&changes)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing user info: %v", err), http.StatusBadRequest)
+		return
+	}
+	if changes.Password != nil {
+		errHandler(w, fmt.Errorf("use POST /api/users/password to change your password"), http.StatusBadRequest)
+		return
+	}
+	if changes.Email != nil && !cfg.isLoginToken(token) {
+		loginTokenRequired(w)
+		return
+	}
+	cfg.saveUserChanges(w, r, userID, changes)
+}
+
+// saveUserChanges checks and applies a partial update to a user and writes the
+// updated user back. everything is validated before anything is written, so a bad
+// handle or a taken email doesn't leave a half done update behind
+func (cfg *apiConfig) saveUserChanges(w http.ResponseWriter, r *http.Request, userID uuid.UUID, changes userChanges) {
+	ctx := context.Background()
+	if changes.Email == nil && changes.Password == nil && changes.profileFields.empty() {
+		errHandler(w, fmt.Errorf("nothing to update"), http.StatusBadRequest)
+		return
+	}
+	current, err := cfg.db.GetUserById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("user not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	returningUser := userFromDB(current)
+
+	//the email and password are how the account is recovered, so changing either one
+	//needs the current password, checked before anything else is looked at
+	emailChanged := changes.Email != nil && *changes.Email != current.Email
+	if (emailChanged || changes.Password != nil) && !cfg.checkPassword(w, r, current, changes.CurrentPassword) {
+		return
+	}
+
+	email := current.Email
+	if emailChanged {
+		if err := validateEmail(*changes.Email); err != nil {
+			errHandler(w, err, http.StatusBadRequest)
+			return
+		}
+		owner, err := cfg.db.GetUserByEmail(ctx, *changes.Email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			errHandler(w, fmt.Errorf("error checking email: %v", err))
+			return
+		}
+		if err == nil && owner.ID != userID {
+			errHandler(w, fmt.Errorf("email is already in use"), http.StatusConflict)
+			return
+		}
+		email = *changes.Email
+	}
+	newProfile := profileFromDB(current)
+	if !changes.profileFields.empty() {
+		var ok bool
+		newProfile, ok = cfg.applyProfile(w, ctx, userID, newProfile, changes.profileFields)
+		if !ok {
+			return
+		}
+	}
+
+	//the password is only rehashed when a new one is sent
+	hashedPassword := current.HashedPassword
+	if changes.Password != nil {
+		hashedPassword, err = auth.HashPassword(*changes.Password)
+		if err != nil {
+			errHandler(w, fmt.Errorf("unable to hash password: %v", err))
+			return
+		}
+	}
+	if email != current.Email || changes.Password != nil {
+		updatedUser, err := cfg.db.UpdateUser(ctx, database.UpdateUserParams{
+			ID:             userID,
+			Email:          email,
+			HashedPassword: hashedPassword,
+		})
+		if err != nil {
+			//someone else took the email between the check above and here
+			if owner, lookupErr := cfg.db.GetUserByEmail(ctx, email); lookupErr == nil && owner.ID != userID {
+				errHandler(w, fmt.Errorf("email is already in use"), http.StatusConflict)
+				return
+			}
+			errHandler(w, fmt.Errorf("error updating user: %v", err))
+			return
+		}
+		returningUser.UpdatedAt = updatedUser.UpdatedAt
+		returningUser.Email = updatedUser.Email
+		returningUser.EmailVerified = updatedUser.EmailVerifiedAt.Valid
+		if email != current.Email {
+			cfg.sendVerificationOrLog(ctx, userID, email)
+		}
+	}
+	if !changes.profileFields.empty() {
+		updatedUser, err := cfg.db.UpdateUserProfile(ctx, database.UpdateUserProfileParams{
+			ID:          userID,
+			Handle:      newProfile.Handle,
+			DisplayName: newProfile.DisplayName,
+			Bio:         newProfile.Bio,
+		})
+		if err != nil {
+			errHandler(w, fmt.Errorf("error updating profile: %v", err))
+			return
+		}
+		returningUser.UpdatedAt = updatedUser.UpdatedAt
+		returningUser.Handle = updatedUser.Handle
+		returningUser.DisplayName = updatedUser.DisplayName
+		returningUser.Bio = updatedUser.Bio
+	}
+	resp, _ := json.Marshal(returningUser)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}
+
+func (cfg *apiConfig) changePassword(w http.ResponseWriter, r *http.Request) {
+	//changes the caller's password given the current one
+	//every refresh token the user has is revoked and the caller gets a fresh pair,
+	//so this session carries on and every other one has to log in again
+	userID, ok := cfg.loginTokenUser(w, r)
+	if !ok {
+		return
+	}
+	change := passwordChange{}
+	err := json.NewDecoder(r.Body).Decode(&change)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error parsing password change: %v", err), http.StatusBadRequest)
+		return
+	}
+	if change.NewPassword == "" {
+		errHandler(w, fmt.Errorf("new password is required"), http.StatusBadRequest)
+		return
+	}
+	ctx := context.Background()
+	user, err := cfg.db.GetUserById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errHandler(w, fmt.Errorf("user not found"), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		errHandler(w, fmt.Errorf("error getting user: %v", err))
+		return
+	}
+	if !cfg.checkPassword(w, r, user, change.CurrentPassword) {
+		return
+	}
+	hashedPassword, err := auth.HashPassword(change.NewPassword)
+	if err != nil {
+		errHandler(w, fmt.Errorf("unable to hash password: %v", err))
+		return
+	}
+	updatedUser, err := cfg.db.UpdateUser(ctx, database.UpdateUserParams{
+		ID:             userID,
+		Email:          user.Email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		errHandler(w, fmt.Errorf("error updating password: %v", err))
+		return
+	}
+	err = cfg.db.RevokeUserRefreshTokens(ctx, userID)
+	if err != nil {
+		errHandler(w, fmt.Errorf("error revoking refresh tokens: %v", err))
+		return
+	}
+	returningUser := userFromDB(user)
+	returningUser.UpdatedAt = updatedUser.UpdatedAt
+	returningUser.TokenJWT, returningUser.RefreshToken, err = cfg.issueTokens(ctx, r, userID)
+	if err != nil {
+		errHandler(w, err)
+		return
+	}
+	resp, _ := json.Marshal(returningUser)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp)
+}